@@ -4,8 +4,14 @@ package adder
 
 func fromRedirectStorageToRedirectResult(i RedirectStorage) RedirectResult {
 	return RedirectResult{
-		Code:  i.Code,
-		URL:   i.URL,
-		Token: i.Token,
+		Code:        i.Code,
+		URL:         i.URL,
+		Token:       i.Token,
+		ExpiresAt:   i.ExpiresAt,
+		MaxUses:     i.MaxUses,
+		NotBefore:   i.NotBefore,
+		Passthrough: i.Passthrough,
+		Preview:     i.Preview,
+		StatusCode:  i.StatusCode,
 	}
 }
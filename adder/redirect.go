@@ -3,28 +3,101 @@ package adder
 // TODO: use go generate to generate transformers that copy from the storage->application and application->storage
 
 import (
+	"hex-microservice/targeting"
 	"time"
 )
 
 // RedirectStorage is the storage view of a redirect for the adder service.
 type RedirectStorage struct {
-	Code       string
-	URL        string
+	// Domain is the namespace of the code, empty for the default domain.
+	Domain string
+	Code   string
+	URL    string
+	// Token is the salted hash of the token, see package hashed.
 	Token      string
 	ClientInfo string
 	CreatedAt  time.Time
+	// ExpiresAt is the zero time if the redirect never expires.
+	ExpiresAt time.Time
+	// Password is the hash of the password, empty if the redirect isn't
+	// protected.
+	Password string
+	// MaxUses limits the number of redirects, zero is unlimited.
+	MaxUses int
+	// NotBefore is the zero time if the redirect is active immediately.
+	NotBefore time.Time
+	// Rules are the conditional destinations, the URL is the fallback.
+	Rules targeting.Rules
+	// Variants split the visitors across weighted destinations.
+	Variants targeting.Variants
+	// Passthrough appends the path and merges the query of a request into
+	// the destination.
+	Passthrough bool
+	// Preview shows the preview page instead of redirecting.
+	Preview bool
+	// StatusCode is the status code of the redirect, e.g. 301.
+	StatusCode int
+	// Owner is the id of the API key the redirect was created with, empty
+	// for an anonymous redirect.
+	Owner string
 }
 
 // RedirectCommand is the request for the adder service.
 type RedirectCommand struct {
+	// Domain is the namespace of the code, empty for the default domain.
+	Domain     string
 	URL        string
 	CustomCode string
 	ClientInfo string
+	// TTL is the optional time to live relative to the creation.
+	TTL time.Duration
+	// ExpiresAt is the optional absolute point in time the redirect expires.
+	ExpiresAt time.Time
+	// Password optionally protects the redirect, it's bcrypt hashed and
+	// therefore limited to 72 bytes.
+	Password string `validate:"empty=true | gte=4 & lte=72"`
+	// MaxUses optionally limits the number of redirects, e.g. 1 for a
+	// one-time link.
+	MaxUses int `validate:"gte=0"`
+	// NotBefore is the optional point in time the redirect is activated.
+	NotBefore time.Time
+	// Rules are the optional conditional destinations in their order.
+	Rules targeting.Rules
+	// Variants are the optional weighted destinations of an experiment,
+	// they apply if no rule matches.
+	Variants targeting.Variants
+	// Passthrough optionally appends the path after the code and merges the
+	// query of a request into the destination.
+	Passthrough bool
+	// Preview optionally shows every visitor the preview page with the
+	// destination instead of redirecting.
+	Preview bool
+	// StatusCode optionally chooses the status code of the redirect, zero
+	// is the configured default.
+	StatusCode int
+	// Owner is the id of the authenticated API key, empty for an anonymous
+	// request.
+	Owner string
 }
 
 // RedirectResult is the result for the adder service.
 type RedirectResult struct {
-	Code  string
-	URL   string
-	Token string
+	Code string
+	URL  string
+	// Token is the plaintext token, it's handed out only once.
+	Token     string
+	ExpiresAt time.Time
+	MaxUses   int
+	NotBefore time.Time
+	// Passthrough signals that the path and the query of a request are
+	// passed to the destination.
+	Passthrough bool
+	// Preview signals that the visitors are shown the preview page.
+	Preview    bool
+	StatusCode int
+	// Reused signals that an existing redirect is returned, its token is
+	// omitted.
+	Reused bool
+	// Err is the error of the redirect within a batch.
+	Err error
 }
@@ -4,7 +4,13 @@ package adder
 import (
 	"errors"
 	"fmt"
+	"hex-microservice/canonical"
+	"hex-microservice/event"
+	"hex-microservice/hashed"
+	"hex-microservice/targeting"
+	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -16,19 +22,112 @@ import (
 var (
 	ErrRedirectInvalid = errors.New("Redirect Invalid")
 	ErrDuplicate       = errors.New("Redirect already exists")
+	ErrNotFound        = errors.New("Redirect not found")
+	// ErrCollision signals that every generated code of a redirect already
+	// existed, it's distinct from ErrDuplicate that is used for custom codes.
+	ErrCollision = errors.New("Redirect code collision")
+	// ErrBatchAborted signals that a redirect was not persisted, because
+	// another redirect of the same all-or-nothing batch failed.
+	ErrBatchAborted = errors.New("Redirect batch aborted")
+	// ErrPolicyViolation signals that the url of a redirect is valid, but
+	// not accepted by the policy.
+	ErrPolicyViolation = errors.New("Redirect violates the policy")
 )
 
+// ItemError is the error of a single redirect within a batch.
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("redirect %d: %v", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
 // Repository defines the methods the service expects from
 // a repository implementation.
 type Repository interface {
 	Store(RedirectStorage) error
+	// StoreAll persists either all redirects or none of them. Errors of a
+	// single redirect are reported as *ItemError.
+	StoreAll([]RedirectStorage) error
+	// LookupByURL returns an active redirect of the url on the domain that
+	// never expires, isn't protected by a password, has no max uses, no
+	// activation, no rules and no variants.
+	LookupByURL(domain, url string) (RedirectStorage, error)
+}
+
+// PreviewSuffix is appended to the code of a redirect to preview it, the
+// custom codes therefore never end with it.
+const PreviewSuffix = "+"
+
+// Generator is the port that generates the codes of the redirects.
+type Generator interface {
+	Generate() (string, error)
+}
+
+// GeneratorFunc adapts a function to a Generator.
+type GeneratorFunc func() (string, error)
+
+// Generate calls the function.
+func (fn GeneratorFunc) Generate() (string, error) {
+	return fn()
+}
+
+// Policy is the port that decides whether a url is accepted as destination.
+type Policy interface {
+	Check(url string) error
 }
 
 // Service describes the methods the service offers.
 type Service interface {
-	// Add takes a list of redirects for persistence.
-	// May raise errors if the redirect is not valid.
+	// Add takes a list of redirects for persistence. Either all redirects
+	// are persisted or none of them.
+	// May raise errors if a redirect is not valid, the error of each
+	// redirect is reported by its result.
 	Add(...RedirectCommand) ([]RedirectResult, error)
+	// AddEach takes a list of redirects and persists each of them
+	// independently. The error of each redirect is reported by its result.
+	AddEach(...RedirectCommand) []RedirectResult
+	// Stats returns the statistics of the code generation.
+	Stats() Stats
+}
+
+// Stats are the statistics of the code generation. A growing number of
+// collisions signals that the code space is getting crowded.
+type Stats struct {
+	// Collisions counts the generated codes that already existed.
+	Collisions uint64
+	// Exhausted counts the redirects that failed with ErrCollision.
+	Exhausted uint64
+}
+
+// DefaultMaxRetries is the default number of retries with a new code after
+// a generated code collided.
+const DefaultMaxRetries = 3
+
+// DefaultStatusCode is the status code of the redirects that neither the
+// command nor the configuration choose, a temporary redirect.
+const DefaultStatusCode = http.StatusTemporaryRedirect
+
+// IsStatusCode reports whether the status code is supported for redirects.
+func IsStatusCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// isPermanent reports whether browsers may cache the redirect.
+func isPermanent(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
 }
 
 // service implements the Service interface and holds
@@ -36,49 +135,471 @@ type Service interface {
 type service struct {
 	logger     logr.Logger
 	repository Repository
+	events     event.Publisher
+	generator  Generator
+	maxRetries int
+	normalize  bool
+	reuse      bool
+	policy     Policy
+	statusCode int
+
+	collisions uint64
+	exhausted  uint64
+}
+
+// Option configures the optional behavior of the service.
+type Option func(*service)
+
+// WithGenerator sets the generator of the codes, the default uses shortid.
+func WithGenerator(g Generator) Option {
+	return func(s *service) {
+		s.generator = g
+	}
+}
+
+// WithStatusCode sets the status code of the redirects whose command doesn't
+// choose one, the default is DefaultStatusCode.
+func WithStatusCode(code int) Option {
+	return func(s *service) {
+		s.statusCode = code
+	}
+}
+
+// WithMaxRetries sets the number of retries with a new code after a
+// generated code collided, the default is DefaultMaxRetries.
+func WithMaxRetries(n int) Option {
+	return func(s *service) {
+		s.maxRetries = n
+	}
+}
+
+// WithNormalization enables the canonicalization of the urls.
+func WithNormalization() Option {
+	return func(s *service) {
+		s.normalize = true
+	}
+}
+
+// WithReuse enables the reuse of an active redirect of the same url instead
+// of the creation of a new one. Only commands without custom code, expiry,
+// password, max uses, activation, rules, variants, passthrough and preview
+// reuse a redirect that never expires, is neither protected nor limited, is
+// activated, has neither rules nor variants, doesn't pass through and isn't
+// previewed.
+func WithReuse() Option {
+	return func(s *service) {
+		s.reuse = true
+	}
+}
+
+// WithPolicy sets the policy the urls have to comply with, every url is
+// accepted by default.
+func WithPolicy(p Policy) Option {
+	return func(s *service) {
+		s.policy = p
+	}
 }
 
 // New creates a new adder service.
-func New(l logr.Logger, r Repository) Service {
-	return &service{
+func New(l logr.Logger, r Repository, p event.Publisher, opts ...Option) Service {
+	s := &service{
 		logger:     l,
 		repository: r,
+		events:     p,
+		generator:  GeneratorFunc(shortid.Generate),
+		maxRetries: DefaultMaxRetries,
+		statusCode: DefaultStatusCode,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
-// Add takes a list of redirect commands and persists them.
+// Add takes a list of redirect commands and persists all or none of them.
 func (s *service) Add(redirects ...RedirectCommand) ([]RedirectResult, error) {
+	now := time.Now()
 	results := make([]RedirectResult, len(redirects))
 
+	// the indices map the redirects to store back to the commands
+	stores := make([]RedirectStorage, 0, len(redirects))
+	tokens := make([]string, 0, len(redirects))
+	indices := make([]int, 0, len(redirects))
+
 	for i, redirect := range redirects {
-		if err := validate.Validate(redirect); err != nil {
-			return results, fmt.Errorf("service.Redirect: %w", ErrRedirectInvalid)
+		store, token, err := s.prepare(redirect, now)
+		if err != nil {
+			return aborted(len(redirects), &ItemError{Index: i, Err: err})
 		}
 
-		code := redirect.CustomCode
-		if code == "" {
-			var err error
-			code, err = shortid.Generate()
-			if err != nil {
-				return results, err
-			}
+		existing, ok, err := s.reusable(redirect, store)
+		if err != nil {
+			return aborted(len(redirects), &ItemError{Index: i, Err: err})
+		}
+
+		if ok {
+			results[i] = reusedResult(existing)
+			continue
 		}
 
-		// storage view
-		store := RedirectStorage{
-			Code:       code,
-			URL:        redirect.URL,
-			Token:      strings.Replace(uuid.New().String(), "-", "", -1),
-			ClientInfo: redirect.ClientInfo,
-			CreatedAt:  time.Now(),
+		stores = append(stores, store)
+		tokens = append(tokens, token)
+		indices = append(indices, i)
+	}
+
+	// the transaction is repeated with a new code for a collided generated code
+	retries := make([]int, len(stores))
+	for len(stores) > 0 {
+		err := s.repository.StoreAll(stores)
+		if err == nil {
+			break
 		}
-		if err := s.repository.Store(store); err != nil {
+
+		var itemErr *ItemError
+		if !errors.As(err, &itemErr) {
+			for i := range results {
+				results[i] = RedirectResult{Err: err}
+			}
+
 			return results, err
 		}
 
-		// result view
-		results[i] = fromRedirectStorageToRedirectResult(store)
+		j, i := itemErr.Index, indices[itemErr.Index]
+		if redirects[i].CustomCode != "" || !errors.Is(itemErr.Err, ErrDuplicate) {
+			return aborted(len(redirects), &ItemError{Index: i, Err: itemErr.Err})
+		}
+
+		if err := s.collided(retries[j]); err != nil {
+			return aborted(len(redirects), &ItemError{Index: i, Err: err})
+		}
+
+		retries[j]++
+
+		if stores[j].Code, err = s.generator.Generate(); err != nil {
+			return aborted(len(redirects), &ItemError{Index: i, Err: err})
+		}
+	}
+
+	events := make([]event.Event, len(stores))
+
+	for j, store := range stores {
+		results[indices[j]] = createdResult(store, tokens[j])
+		events[j] = created(store, now)
 	}
 
+	s.events.Publish(events...)
+
 	return results, nil
 }
+
+// AddEach takes a list of redirect commands and persists each of them.
+func (s *service) AddEach(redirects ...RedirectCommand) []RedirectResult {
+	now := time.Now()
+	results := make([]RedirectResult, len(redirects))
+
+	for i, redirect := range redirects {
+		store, token, err := s.prepare(redirect, now)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		existing, ok, err := s.reusable(redirect, store)
+		if ok {
+			results[i] = reusedResult(existing)
+			continue
+		}
+
+		if err == nil {
+			err = s.store(redirect, &store)
+		}
+
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		s.events.Publish(created(store, now))
+
+		// result view
+		results[i] = createdResult(store, token)
+	}
+
+	return results
+}
+
+// Stats returns the statistics of the code generation.
+func (s *service) Stats() Stats {
+	return Stats{
+		Collisions: atomic.LoadUint64(&s.collisions),
+		Exhausted:  atomic.LoadUint64(&s.exhausted),
+	}
+}
+
+// reusable returns the active redirect of the same url on the same domain if
+// the reuse is enabled. Only redirects without custom code, expiry, password,
+// max uses, activation, rules, variants, passthrough and preview are reused.
+func (s *service) reusable(redirect RedirectCommand, store RedirectStorage) (RedirectStorage, bool, error) {
+	if !s.reuse || redirect.CustomCode != "" || !store.ExpiresAt.IsZero() || store.Password != "" || store.MaxUses > 0 || !store.NotBefore.IsZero() || len(store.Rules) > 0 || len(store.Variants) > 0 || store.Passthrough || store.Preview {
+		return RedirectStorage{}, false, nil
+	}
+
+	existing, err := s.repository.LookupByURL(store.Domain, store.URL)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return RedirectStorage{}, false, nil
+		}
+
+		return RedirectStorage{}, false, err
+	}
+
+	// the clients of an existing redirect expect its status code and a
+	// redirect isn't handed to another owner
+	if existing.StatusCode != store.StatusCode || existing.Owner != store.Owner {
+		return RedirectStorage{}, false, nil
+	}
+
+	return existing, true, nil
+}
+
+// created returns the event of the created redirect.
+func created(store RedirectStorage, now time.Time) event.Event {
+	e := event.Created(store.Domain, store.Code, store.URL, store.ExpiresAt, now)
+	e.Password = store.Password
+	e.MaxUses = store.MaxUses
+	e.NotBefore = store.NotBefore
+	e.Rules = store.Rules
+	e.Variants = store.Variants
+	e.Passthrough = store.Passthrough
+	e.Preview = store.Preview
+	e.StatusCode = store.StatusCode
+	e.Owner = store.Owner
+
+	return e
+}
+
+// createdResult returns the result view of a created redirect. It's the only
+// place the plaintext token is handed out, the storage holds its hash.
+func createdResult(store RedirectStorage, token string) RedirectResult {
+	result := fromRedirectStorageToRedirectResult(store)
+	result.Token = token
+
+	return result
+}
+
+// reusedResult returns the result view of a reused redirect. The token is
+// omitted, it belongs to the creator of the redirect.
+func reusedResult(existing RedirectStorage) RedirectResult {
+	result := fromRedirectStorageToRedirectResult(existing)
+	result.Token = ""
+	result.Reused = true
+
+	return result
+}
+
+// store persists the redirect, a collided generated code is replaced by a
+// new one.
+func (s *service) store(redirect RedirectCommand, store *RedirectStorage) error {
+	for retries := 0; ; retries++ {
+		err := s.repository.Store(*store)
+		if redirect.CustomCode != "" || !errors.Is(err, ErrDuplicate) {
+			return err
+		}
+
+		if err := s.collided(retries); err != nil {
+			return err
+		}
+
+		if store.Code, err = s.generator.Generate(); err != nil {
+			return err
+		}
+	}
+}
+
+// collided counts a collision of a generated code and returns ErrCollision
+// if there are no retries left.
+func (s *service) collided(retries int) error {
+	atomic.AddUint64(&s.collisions, 1)
+
+	if retries >= s.maxRetries {
+		atomic.AddUint64(&s.exhausted, 1)
+		s.logger.Info("generated code collided, no retries left", "retries", retries)
+
+		return fmt.Errorf("service.Redirect after %d retries: %w", retries, ErrCollision)
+	}
+
+	s.logger.V(1).Info("generated code collided, retrying with a new code", "retries", retries)
+
+	return nil
+}
+
+// aborted returns the results of a failed all-or-nothing batch, the failed
+// redirect carries its error and all others ErrBatchAborted.
+func aborted(n int, itemErr *ItemError) ([]RedirectResult, error) {
+	results := make([]RedirectResult, n)
+	for i := range results {
+		results[i].Err = ErrBatchAborted
+	}
+
+	results[itemErr.Index].Err = itemErr.Err
+
+	return results, itemErr
+}
+
+// prepare validates the command and returns the storage view of the redirect
+// as well as the plaintext token, the storage view holds the hashed token.
+func (s *service) prepare(redirect RedirectCommand, now time.Time) (RedirectStorage, string, error) {
+	if err := validate.Validate(redirect); err != nil {
+		return RedirectStorage{}, "", fmt.Errorf("service.Redirect: %w", ErrRedirectInvalid)
+	}
+
+	if strings.HasSuffix(redirect.CustomCode, PreviewSuffix) {
+		return RedirectStorage{}, "", fmt.Errorf("service.Redirect code with the preview suffix: %w", ErrRedirectInvalid)
+	}
+
+	expiresAt, err := expiry(redirect, now)
+	if err != nil {
+		return RedirectStorage{}, "", err
+	}
+
+	// a redirect that expires before its activation would never resolve
+	if !redirect.NotBefore.IsZero() && !expiresAt.IsZero() && !redirect.NotBefore.Before(expiresAt) {
+		return RedirectStorage{}, "", fmt.Errorf("service.Redirect activation after the expiry: %w", ErrRedirectInvalid)
+	}
+
+	statusCode := redirect.StatusCode
+	if statusCode == 0 {
+		statusCode = s.statusCode
+	}
+
+	if !IsStatusCode(statusCode) {
+		return RedirectStorage{}, "", fmt.Errorf("service.Redirect status code %d: %w", statusCode, ErrRedirectInvalid)
+	}
+
+	// browsers cache a permanent redirect, but the destination of these
+	// redirects is resolved per visit
+	if isPermanent(statusCode) && (redirect.MaxUses > 0 || len(redirect.Rules) > 0 || len(redirect.Variants) > 0 || redirect.Passthrough) {
+		if redirect.StatusCode != 0 {
+			return RedirectStorage{}, "", fmt.Errorf("service.Redirect permanent status code %d of a redirect resolved per visit: %w", statusCode, ErrRedirectInvalid)
+		}
+
+		statusCode = DefaultStatusCode
+	}
+
+	if err := redirect.Rules.Validate(); err != nil {
+		return RedirectStorage{}, "", fmt.Errorf("service.Redirect: %v: %w", err, ErrRedirectInvalid)
+	}
+
+	if err := redirect.Variants.Validate(); err != nil {
+		return RedirectStorage{}, "", fmt.Errorf("service.Redirect: %v: %w", err, ErrRedirectInvalid)
+	}
+
+	// the destinations of the rules and the variants are treated like the url
+	rules := append(targeting.Rules(nil), redirect.Rules...)
+	variants := append(targeting.Variants(nil), redirect.Variants...)
+
+	if s.normalize {
+		if redirect.URL, err = canonical.URL(redirect.URL); err != nil {
+			return RedirectStorage{}, "", fmt.Errorf("service.Redirect: %v: %w", err, ErrRedirectInvalid)
+		}
+
+		for i := range rules {
+			if rules[i].URL, err = canonical.URL(rules[i].URL); err != nil {
+				return RedirectStorage{}, "", fmt.Errorf("service.Redirect rule %d: %v: %w", i, err, ErrRedirectInvalid)
+			}
+		}
+
+		for i := range variants {
+			if variants[i].URL, err = canonical.URL(variants[i].URL); err != nil {
+				return RedirectStorage{}, "", fmt.Errorf("service.Redirect variant %d: %v: %w", i+1, err, ErrRedirectInvalid)
+			}
+		}
+	}
+
+	if s.policy != nil {
+		if err := s.policy.Check(redirect.URL); err != nil {
+			return RedirectStorage{}, "", fmt.Errorf("service.Redirect: %v: %w", err, ErrPolicyViolation)
+		}
+
+		for i, rule := range rules {
+			if err := s.policy.Check(rule.URL); err != nil {
+				return RedirectStorage{}, "", fmt.Errorf("service.Redirect rule %d: %v: %w", i, err, ErrPolicyViolation)
+			}
+		}
+
+		for i, variant := range variants {
+			if err := s.policy.Check(variant.URL); err != nil {
+				return RedirectStorage{}, "", fmt.Errorf("service.Redirect variant %d: %v: %w", i+1, err, ErrPolicyViolation)
+			}
+		}
+	}
+
+	code := redirect.CustomCode
+	if code == "" {
+		code, err = s.generator.Generate()
+		if err != nil {
+			return RedirectStorage{}, "", err
+		}
+	}
+
+	var password string
+	if redirect.Password != "" {
+		if password, err = hashed.Password(redirect.Password); err != nil {
+			return RedirectStorage{}, "", err
+		}
+	}
+
+	token := strings.Replace(uuid.New().String(), "-", "", -1)
+	hashedToken, err := hashed.Token(token)
+	if err != nil {
+		return RedirectStorage{}, "", err
+	}
+
+	return RedirectStorage{
+		Domain:      redirect.Domain,
+		Code:        code,
+		URL:         redirect.URL,
+		Token:       hashedToken,
+		ClientInfo:  redirect.ClientInfo,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+		Password:    password,
+		MaxUses:     redirect.MaxUses,
+		NotBefore:   redirect.NotBefore,
+		Rules:       rules,
+		Variants:    variants,
+		Passthrough: redirect.Passthrough,
+		Preview:     redirect.Preview,
+		StatusCode:  statusCode,
+		Owner:       redirect.Owner,
+	}, token, nil
+}
+
+// expiry returns the point in time a redirect expires. If both, a time to live
+// and an absolute point in time are given, the earlier one wins. The zero time
+// signals that the redirect never expires.
+func expiry(redirect RedirectCommand, now time.Time) (time.Time, error) {
+	var expiresAt time.Time
+
+	if redirect.TTL < 0 {
+		return expiresAt, fmt.Errorf("service.Redirect negative ttl: %w", ErrRedirectInvalid)
+	}
+
+	if redirect.TTL > 0 {
+		expiresAt = now.Add(redirect.TTL)
+	}
+
+	if !redirect.ExpiresAt.IsZero() {
+		if !redirect.ExpiresAt.After(now) {
+			return expiresAt, fmt.Errorf("service.Redirect expiry in the past: %w", ErrRedirectInvalid)
+		}
+
+		if expiresAt.IsZero() || redirect.ExpiresAt.Before(expiresAt) {
+			expiresAt = redirect.ExpiresAt
+		}
+	}
+
+	return expiresAt, nil
+}
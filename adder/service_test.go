@@ -0,0 +1,252 @@
+package adder
+
+import (
+	"errors"
+	"fmt"
+	"hex-microservice/event"
+	"hex-microservice/targeting"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+// takenRepository maps the taken codes to their url.
+type takenRepository map[string]string
+
+func (r takenRepository) Store(red RedirectStorage) error {
+	if _, ok := r[red.Code]; ok {
+		return ErrDuplicate
+	}
+
+	r[red.Code] = red.URL
+
+	return nil
+}
+
+func (r takenRepository) StoreAll(reds []RedirectStorage) error {
+	for i, red := range reds {
+		if _, ok := r[red.Code]; ok {
+			return &ItemError{Index: i, Err: ErrDuplicate}
+		}
+	}
+
+	for _, red := range reds {
+		r[red.Code] = red.URL
+	}
+
+	return nil
+}
+
+func (r takenRepository) LookupByURL(_, url string) (RedirectStorage, error) {
+	for code, u := range r {
+		if u == url {
+			return RedirectStorage{Code: code, URL: url, Token: "secret", StatusCode: DefaultStatusCode}, nil
+		}
+	}
+
+	return RedirectStorage{}, ErrNotFound
+}
+
+type discardingPublisher struct{}
+
+func (discardingPublisher) Publish(...event.Event) {}
+
+// sequence generates the codes "code-0", "code-1", ...
+func sequence() GeneratorFunc {
+	n := 0
+
+	return func() (string, error) {
+		code := fmt.Sprintf("code-%d", n)
+		n++
+
+		return code, nil
+	}
+}
+
+func TestAddRetriesCollisions(t *testing.T) {
+	repository := takenRepository{"code-0": "https://taken.example/", "code-1": "https://taken.example/"}
+	s := New(discardingLogger, repository, discardingPublisher{}, WithGenerator(sequence()))
+
+	results, err := s.Add(RedirectCommand{URL: "https://example.com"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "code-2", results[0].Code)
+		assert.Equal(t, Stats{Collisions: 2}, s.Stats())
+	}
+}
+
+func TestAddEachRetriesCollisions(t *testing.T) {
+	repository := takenRepository{"code-0": "https://taken.example/"}
+	s := New(discardingLogger, repository, discardingPublisher{}, WithGenerator(sequence()))
+
+	results := s.AddEach(RedirectCommand{URL: "https://example.com"}, RedirectCommand{URL: "https://example.org"})
+	if assert.Len(t, results, 2) {
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, "code-1", results[0].Code)
+		assert.NoError(t, results[1].Err)
+		assert.Equal(t, "code-2", results[1].Code)
+		assert.Equal(t, Stats{Collisions: 1}, s.Stats())
+	}
+}
+
+func TestAddCollisionsExhausted(t *testing.T) {
+	repository := takenRepository{"code-0": "https://taken.example/", "code-1": "https://taken.example/", "code-2": "https://taken.example/"}
+	s := New(discardingLogger, repository, discardingPublisher{}, WithGenerator(sequence()), WithMaxRetries(2))
+
+	results := s.AddEach(RedirectCommand{URL: "https://example.com"})
+	if assert.Len(t, results, 1) {
+		assert.ErrorIs(t, results[0].Err, ErrCollision)
+		assert.NotErrorIs(t, results[0].Err, ErrDuplicate)
+		assert.Equal(t, Stats{Collisions: 3, Exhausted: 1}, s.Stats())
+	}
+}
+
+func TestAddCustomCodeIsNotRetried(t *testing.T) {
+	repository := takenRepository{"custom": "https://taken.example/"}
+	s := New(discardingLogger, repository, discardingPublisher{}, WithGenerator(sequence()))
+
+	_, err := s.Add(RedirectCommand{URL: "https://example.com", CustomCode: "custom"})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.Equal(t, Stats{}, s.Stats())
+}
+
+func TestAddCustomCodeWithPreviewSuffix(t *testing.T) {
+	s := New(discardingLogger, takenRepository{}, discardingPublisher{}, WithGenerator(sequence()))
+
+	_, err := s.Add(RedirectCommand{URL: "https://example.com", CustomCode: "custom" + PreviewSuffix})
+	assert.ErrorIs(t, err, ErrRedirectInvalid)
+
+	_, err = s.Add(RedirectCommand{URL: "https://example.com", CustomCode: "cus+tom"})
+	assert.NoError(t, err)
+}
+
+func TestAddReusesNormalizedURL(t *testing.T) {
+	repository := takenRepository{"existing": "https://example.com/?a=1&b=2"}
+	s := New(discardingLogger, repository, discardingPublisher{}, WithGenerator(sequence()), WithNormalization(), WithReuse())
+
+	results, err := s.Add(
+		RedirectCommand{URL: "HTTPS://Example.com:443?b=2&a=1"},
+		RedirectCommand{URL: "https://example.com/?a=1&b=2", CustomCode: "custom"},
+		RedirectCommand{URL: "https://example.org"},
+	)
+	if assert.NoError(t, err) && assert.Len(t, results, 3) {
+		assert.True(t, results[0].Reused)
+		assert.Equal(t, "existing", results[0].Code)
+		assert.Empty(t, results[0].Token)
+
+		assert.False(t, results[1].Reused)
+		assert.Equal(t, "custom", results[1].Code)
+
+		assert.False(t, results[2].Reused)
+		assert.Equal(t, "https://example.org/", results[2].URL)
+	}
+}
+
+func TestAddReusesOnlyRedirectsOfTheOwner(t *testing.T) {
+	repository := takenRepository{"anonymous": "https://example.com/"}
+	s := New(discardingLogger, repository, discardingPublisher{}, WithGenerator(sequence()), WithReuse())
+
+	results, err := s.Add(RedirectCommand{URL: "https://example.com/", Owner: "key"})
+	if assert.NoError(t, err) && assert.Len(t, results, 1) {
+		assert.False(t, results[0].Reused)
+		assert.NotEmpty(t, results[0].Token)
+	}
+}
+
+// denyingPolicy rejects the urls of its set.
+type denyingPolicy map[string]struct{}
+
+func (p denyingPolicy) Check(url string) error {
+	if _, ok := p[url]; ok {
+		return errors.New("denied")
+	}
+
+	return nil
+}
+
+func TestAddPolicyViolation(t *testing.T) {
+	s := New(discardingLogger, takenRepository{}, discardingPublisher{}, WithGenerator(sequence()),
+		WithPolicy(denyingPolicy{"https://denied.example/": {}}))
+
+	results := s.AddEach(
+		RedirectCommand{URL: "https://denied.example/"},
+		RedirectCommand{URL: "https://example.com/"},
+	)
+	if assert.Len(t, results, 2) {
+		assert.ErrorIs(t, results[0].Err, ErrPolicyViolation)
+		assert.NotErrorIs(t, results[0].Err, ErrRedirectInvalid)
+		assert.NoError(t, results[1].Err)
+	}
+}
+
+func TestAddActivationAfterExpiry(t *testing.T) {
+	s := New(discardingLogger, takenRepository{}, discardingPublisher{}, WithGenerator(sequence()))
+
+	results := s.AddEach(
+		RedirectCommand{URL: "https://example.com/", TTL: time.Hour, NotBefore: time.Now().Add(2 * time.Hour)},
+		RedirectCommand{URL: "https://example.com/", TTL: 2 * time.Hour, NotBefore: time.Now().Add(time.Hour)},
+	)
+	if assert.Len(t, results, 2) {
+		assert.ErrorIs(t, results[0].Err, ErrRedirectInvalid)
+		assert.NoError(t, results[1].Err)
+	}
+}
+
+func TestAddStatusCode(t *testing.T) {
+	repository := takenRepository{"existing": "https://example.com/"}
+	s := New(discardingLogger, repository, discardingPublisher{}, WithGenerator(sequence()), WithReuse(), WithStatusCode(http.StatusFound))
+
+	results, err := s.Add(
+		RedirectCommand{URL: "https://example.org/"},
+		RedirectCommand{URL: "https://example.org/", StatusCode: http.StatusPermanentRedirect},
+		// the existing redirect has another status code
+		RedirectCommand{URL: "https://example.com/"},
+	)
+	if assert.NoError(t, err) && assert.Len(t, results, 3) {
+		assert.Equal(t, http.StatusFound, results[0].StatusCode)
+		assert.Equal(t, http.StatusPermanentRedirect, results[1].StatusCode)
+		assert.False(t, results[2].Reused)
+	}
+
+	_, err = s.Add(RedirectCommand{URL: "https://example.org/", StatusCode: http.StatusOK})
+	assert.ErrorIs(t, err, ErrRedirectInvalid)
+}
+
+func TestAddPermanentStatusCode(t *testing.T) {
+	variants := targeting.Variants{{URL: "https://example.org/a", Weight: 1}, {URL: "https://example.org/b", Weight: 1}}
+	rules := targeting.Rules{{Language: "de", URL: "https://example.org/de"}}
+
+	s := New(discardingLogger, takenRepository{}, discardingPublisher{}, WithGenerator(sequence()), WithStatusCode(http.StatusMovedPermanently))
+
+	// a permanent redirect is cached, the redirects resolved per visit can't be permanent
+	for _, command := range []RedirectCommand{
+		{URL: "https://example.org/", MaxUses: 1},
+		{URL: "https://example.org/", Variants: variants},
+		{URL: "https://example.org/", Rules: rules},
+		{URL: "https://example.org/", Passthrough: true},
+	} {
+		command.StatusCode = http.StatusPermanentRedirect
+		_, err := s.Add(command)
+		assert.ErrorIs(t, err, ErrRedirectInvalid)
+
+		command.StatusCode = http.StatusMovedPermanently
+		_, err = s.Add(command)
+		assert.ErrorIs(t, err, ErrRedirectInvalid)
+
+		// the configured permanent default falls back to a temporary redirect
+		command.StatusCode = 0
+		if results, err := s.Add(command); assert.NoError(t, err) && assert.Len(t, results, 1) {
+			assert.Equal(t, DefaultStatusCode, results[0].StatusCode)
+		}
+	}
+
+	if results, err := s.Add(RedirectCommand{URL: "https://example.org/"}); assert.NoError(t, err) && assert.Len(t, results, 1) {
+		assert.Equal(t, http.StatusMovedPermanently, results[0].StatusCode)
+	}
+}
@@ -0,0 +1,61 @@
+// Package apikey offers the API keys the clients authenticate with as bearer
+// tokens. A token consists of the id of its key and a secret, the key store
+// holds only the salted hash of the secret.
+package apikey
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound signals that the key doesn't exist.
+	ErrNotFound = errors.New("api key not found")
+	// ErrUnauthorized signals that the token doesn't belong to an active key.
+	ErrUnauthorized = errors.New("api key unauthorized")
+	// ErrInvalid signals that the key can't be issued, e.g. without a name.
+	ErrInvalid = errors.New("api key invalid")
+)
+
+// Key is an API key, the owner of the redirects created with it.
+type Key struct {
+	ID   string
+	Name string
+	// Hash is the salted hash of the secret, see package hashed.
+	Hash      string
+	CreatedAt time.Time
+	// RevokedAt is the zero time if the key is active.
+	RevokedAt time.Time
+}
+
+// Active reports whether the key isn't revoked.
+func (k Key) Active() bool {
+	return k.RevokedAt.IsZero()
+}
+
+// Store is the port of the key store.
+type Store interface {
+	// Add stores a new key.
+	Add(key Key) error
+	// Get returns the key of the id or ErrNotFound.
+	Get(id string) (Key, error)
+	// List returns all keys in the order of their creation.
+	List() ([]Key, error)
+	// Revoke marks the key as revoked or returns ErrNotFound.
+	Revoke(id string, now time.Time) error
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that carries the authenticated key.
+func NewContext(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the authenticated key of the context, false for an
+// anonymous request.
+func FromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(Key)
+	return key, ok
+}
@@ -0,0 +1,131 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hex-microservice/hashed"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	idSize     = 8
+	secretSize = 24
+	separator  = "."
+)
+
+// Service manages the API keys and authenticates their tokens.
+type Service interface {
+	// Issue creates a new key and returns it with its token, the token is
+	// handed out only once.
+	Issue(name string) (Key, string, error)
+	// Authenticate returns the active key of the token or ErrUnauthorized.
+	Authenticate(token string) (Key, error)
+	// List returns all keys.
+	List() ([]Key, error)
+	// Revoke revokes the key, its token is rejected afterwards.
+	Revoke(id string) error
+}
+
+type service struct {
+	logger logr.Logger
+	store  Store
+}
+
+// New creates a new API key service.
+func New(logger logr.Logger, store Store) Service {
+	return &service{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (s *service) Issue(name string) (Key, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Key{}, "", fmt.Errorf("service.Issue without name: %w", ErrInvalid)
+	}
+
+	id, err := random(idSize)
+	if err != nil {
+		return Key{}, "", fmt.Errorf("service.Issue id: %w", err)
+	}
+
+	secret, err := random(secretSize)
+	if err != nil {
+		return Key{}, "", fmt.Errorf("service.Issue secret: %w", err)
+	}
+
+	hash, err := hashed.Token(secret)
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	key := Key{
+		ID:        id,
+		Name:      name,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.store.Add(key); err != nil {
+		return Key{}, "", fmt.Errorf("service.Issue: %w", err)
+	}
+
+	return key, id + separator + secret, nil
+}
+
+func (s *service) Authenticate(token string) (Key, error) {
+	id, secret, ok := strings.Cut(token, separator)
+	if !ok || id == "" || secret == "" {
+		return Key{}, fmt.Errorf("service.Authenticate malformed token: %w", ErrUnauthorized)
+	}
+
+	key, err := s.store.Get(id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Key{}, fmt.Errorf("service.Authenticate %s: %w", id, ErrUnauthorized)
+		}
+
+		return Key{}, fmt.Errorf("service.Authenticate %s: %w", id, err)
+	}
+
+	if !key.Active() || !hashed.Verify(key.Hash, secret) {
+		return Key{}, fmt.Errorf("service.Authenticate %s: %w", id, ErrUnauthorized)
+	}
+
+	return key, nil
+}
+
+func (s *service) List() ([]Key, error) {
+	keys, err := s.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("service.List: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *service) Revoke(id string) error {
+	if err := s.store.Revoke(id, time.Now()); err != nil {
+		return fmt.Errorf("service.Revoke %s: %w", id, err)
+	}
+
+	s.logger.Info("api key revoked", "id", id)
+
+	return nil
+}
+
+// random returns n random bytes hex encoded.
+func random(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
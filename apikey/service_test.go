@@ -0,0 +1,105 @@
+package apikey
+
+import (
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+// mapStore keeps the keys by their id.
+type mapStore map[string]Key
+
+func (s mapStore) Add(key Key) error {
+	s[key.ID] = key
+	return nil
+}
+
+func (s mapStore) Get(id string) (Key, error) {
+	key, ok := s[id]
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+
+	return key, nil
+}
+
+func (s mapStore) List() ([]Key, error) {
+	keys := make([]Key, 0, len(s))
+	for _, key := range s {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (s mapStore) Revoke(id string, now time.Time) error {
+	key, ok := s[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	key.RevokedAt = now
+	s[id] = key
+
+	return nil
+}
+
+func TestIssueAndAuthenticate(t *testing.T) {
+	store := mapStore{}
+	s := New(discardingLogger, store)
+
+	key, token, err := s.Issue(" ci ")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "ci", key.Name)
+	assert.True(t, strings.HasPrefix(token, key.ID+separator))
+	assert.NotContains(t, store[key.ID].Hash, strings.TrimPrefix(token, key.ID+separator), "the secret is stored hashed")
+
+	authenticated, err := s.Authenticate(token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, key.ID, authenticated.ID)
+	}
+
+	_, err = s.Authenticate(key.ID + separator + "wrong")
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+}
+
+func TestIssueWithoutName(t *testing.T) {
+	_, _, err := New(discardingLogger, mapStore{}).Issue("  ")
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
+
+func TestAuthenticateMalformed(t *testing.T) {
+	s := New(discardingLogger, mapStore{})
+
+	for _, token := range []string{"", "nosecret", ".secret", "id.", "unknown.secret"} {
+		_, err := s.Authenticate(token)
+		assert.True(t, errors.Is(err, ErrUnauthorized), token)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s := New(discardingLogger, mapStore{})
+
+	key, token, err := s.Issue("revoked")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if assert.NoError(t, s.Revoke(key.ID)) {
+		_, err := s.Authenticate(token)
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+	}
+
+	assert.True(t, errors.Is(s.Revoke("unknown"), ErrNotFound))
+}
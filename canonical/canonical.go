@@ -0,0 +1,74 @@
+// Package canonical offers the canonicalization of the destination urls, so
+// that equal destinations are represented by the same string.
+package canonical
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidURL signals that the url can't be canonicalized.
+var ErrInvalidURL = errors.New("invalid url")
+
+// defaultPorts are the ports that are implied by the scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// URL returns the canonical form of the url: the scheme and the host are
+// lowercase, internationalized domain names are converted to punycode,
+// the default port of the scheme is dropped, the query parameters are
+// sorted by their name and an empty path is the root path.
+func URL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("canonical.URL: %v: %w", err, ErrInvalidURL)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("canonical.URL missing scheme or host: %w", ErrInvalidURL)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, port := u.Hostname(), u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	// IPv6 literals are kept as they are
+	if !strings.Contains(host, ":") {
+		if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return "", fmt.Errorf("canonical.URL host: %v: %w", err, ErrInvalidURL)
+		}
+	}
+
+	host = strings.ToLower(host)
+
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if u.Path == "" && u.Opaque == "" {
+		u.Path = "/"
+	}
+
+	// Encode sorts by the name and keeps the order of repeated parameters
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+
+	return u.String(), nil
+}
@@ -0,0 +1,35 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURL(t *testing.T) {
+	for _, tc := range []struct {
+		raw       string
+		canonical string
+	}{
+		{"HTTPS://Example.COM", "https://example.com/"},
+		{"http://example.com:80/path", "http://example.com/path"},
+		{"https://example.com:443/path", "https://example.com/path"},
+		{"https://example.com:8443/path", "https://example.com:8443/path"},
+		{"https://example.com/?b=2&a=1&b=1", "https://example.com/?a=1&b=2&b=1"},
+		{"https://bücher.example/", "https://xn--bcher-kva.example/"},
+		{"http://[::1]:80/", "http://[::1]/"},
+		{"https://example.com/Path#Fragment", "https://example.com/Path#Fragment"},
+	} {
+		canonical, err := URL(tc.raw)
+		if assert.NoError(t, err, tc.raw) {
+			assert.Equal(t, tc.canonical, canonical, tc.raw)
+		}
+	}
+}
+
+func TestURLInvalid(t *testing.T) {
+	for _, raw := range []string{"", "example.com", "https://", "://example.com"} {
+		_, err := URL(raw)
+		assert.ErrorIs(t, err, ErrInvalidURL, raw)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
 	"hex-microservice/meta/value"
+	"hex-microservice/ranker"
+	"hex-microservice/scheduler"
 	"hex-microservice/typeconverter/parser"
 	"path"
 	"reflect"
@@ -54,6 +56,8 @@ func typeConverters(f afero.Fs) ([]converter, error) {
 
 		configForPackage(serviceTemplate, "adder"),
 		configForPackage(serviceTemplate, "lookup"),
+		configForPackage(serviceTemplate, "ranker"),
+		configForPackage(serviceTemplate, "scheduler"),
 	} {
 		parseResult, err := typesFromFile(f, c.typeFilePath)
 		if err != nil {
@@ -112,6 +116,18 @@ func repositoryTemplate(c config, r parser.ParseResult) any {
 				),
 			}
 		}("adder.RedirectStorage", "redirect"),
+		func(fromTypeName, toTypeName string) conversion {
+			return conversion{
+				FromTypeName: fromTypeName,
+				ToTypeName:   toTypeName,
+				MethodName:   methodNameFromTypeNames(fromTypeName, toTypeName),
+				Fields: fields(
+					value.Must(fieldNamesFromParseResults(r, fromTypeName)),
+					// TODO: find a way to infer the type from string
+					value.Must(fieldNameFromType(reflect.TypeOf(&adder.RedirectStorage{}))),
+				),
+			}
+		}("redirect", "adder.RedirectStorage"),
 		func(fromTypeName, toTypeName string) conversion {
 			return conversion{
 				FromTypeName: fromTypeName,
@@ -124,5 +140,29 @@ func repositoryTemplate(c config, r parser.ParseResult) any {
 				),
 			}
 		}("redirect", "invalidator.RedirectStorage"),
+		func(fromTypeName, toTypeName string) conversion {
+			return conversion{
+				FromTypeName: fromTypeName,
+				ToTypeName:   toTypeName,
+				MethodName:   methodNameFromTypeNames(fromTypeName, toTypeName),
+				Fields: fields(
+					value.Must(fieldNamesFromParseResults(r, fromTypeName)),
+					// TODO: find a way to infer the type from string
+					value.Must(fieldNameFromType(reflect.TypeOf(&ranker.RedirectStorage{}))),
+				),
+			}
+		}("redirect", "ranker.RedirectStorage"),
+		func(fromTypeName, toTypeName string) conversion {
+			return conversion{
+				FromTypeName: fromTypeName,
+				ToTypeName:   toTypeName,
+				MethodName:   methodNameFromTypeNames(fromTypeName, toTypeName),
+				Fields: fields(
+					value.Must(fieldNamesFromParseResults(r, fromTypeName)),
+					// TODO: find a way to infer the type from string
+					value.Must(fieldNameFromType(reflect.TypeOf(&scheduler.RedirectStorage{}))),
+				),
+			}
+		}("redirect", "scheduler.RedirectStorage"),
 	}
 }
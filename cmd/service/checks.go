@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"hex-microservice/health"
+	"hex-microservice/repository"
+	"path/filepath"
+	"strings"
+)
+
+// healthChecks returns the readiness checks of the configured dependencies:
+// the repository, the free disk space of the file backed stores and the
+// shutdown of the service.
+func healthChecks(c *configuration, repository repository.RedirectRepository, shutdown *health.Shutdown) []health.Check {
+	checks := []health.Check{
+		{Name: "repository", Probe: repository.Ping},
+		{Name: "shutdown", Probe: shutdown.Probe},
+	}
+
+	if c.MinDiskSpace == 0 {
+		return checks
+	}
+
+	var stores []string
+	if c.Repository.name == "sqlite" {
+		stores = append(stores, c.RepositoryArgs)
+	}
+
+	if c.EventStore != nil && c.EventStore.name == "file" {
+		stores = append(stores, c.EventStoreArgs)
+	}
+
+	if c.KeyStore.name == "sqlite" {
+		stores = append(stores, c.KeyStoreArgs)
+	}
+
+	// the stores in the same directory share a single check
+	seen := map[string]bool{}
+	for _, store := range stores {
+		dir, ok := storageDirectory(store)
+		if !ok || seen[dir] {
+			continue
+		}
+
+		seen[dir] = true
+		checks = append(checks, health.Check{
+			Name:  fmt.Sprintf("disk:%s", dir),
+			Probe: health.DiskSpace(dir, c.MinDiskSpace),
+		})
+	}
+
+	return checks
+}
+
+// storageDirectory returns the directory of the file of a store, e.g. of
+// "sqlite://data/shortener.db?_journal_mode=WAL". The stores in memory have
+// no directory.
+func storageDirectory(dsn string) (string, bool) {
+	if _, path, ok := strings.Cut(dsn, "://"); ok {
+		dsn = path
+	}
+
+	path, query, _ := strings.Cut(dsn, "?")
+	path = strings.TrimPrefix(path, "file:")
+
+	if path == "" || strings.Contains(path, ":memory:") || strings.Contains(query, "mode=memory") {
+		return "", false
+	}
+
+	return filepath.Dir(path), true
+}
+
+// isPersistent reports whether the redirects of the repository outlive the
+// process.
+func isPersistent(repository repositoryImpl, args string) bool {
+	if repository.name == "memory" {
+		return false
+	}
+
+	_, ok := storageDirectory(args)
+
+	return ok
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"hex-microservice/health"
+	"hex-microservice/repository/memory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageDirectory(t *testing.T) {
+	for _, tt := range []struct {
+		dsn      string
+		expected string
+		ok       bool
+	}{
+		{dsn: "sqlite://data/shortener.db?_journal_mode=WAL", expected: "data", ok: true},
+		{dsn: "sqlite://file:/var/lib/shortener.db?cache=shared", expected: "/var/lib", ok: true},
+		{dsn: "file://events.log", expected: ".", ok: true},
+		{dsn: "sqlite://file::memory:?cache=shared"},
+		{dsn: "sqlite://file:keys?mode=memory&cache=shared"},
+		{dsn: "sqlite://"},
+	} {
+		dir, ok := storageDirectory(tt.dsn)
+		assert.Equal(t, tt.ok, ok, tt.dsn)
+		assert.Equal(t, tt.expected, dir, tt.dsn)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	repository, close, err := memory.New(context.Background(), "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer close()
+
+	names := func(checks []health.Check) []string {
+		var names []string
+		for _, check := range checks {
+			names = append(names, check.Name)
+		}
+		return names
+	}
+
+	c := &configuration{
+		Repository:     repositoryImpl{name: "sqlite"},
+		RepositoryArgs: "sqlite://data/shortener.db",
+		EventStore:     &eventStoreImpl{name: "file"},
+		EventStoreArgs: "file://log/events.log",
+		KeyStore:       keyStoreImpl{name: "sqlite"},
+		KeyStoreArgs:   "sqlite://data/shortener.db",
+		MinDiskSpace:   1,
+	}
+
+	// the stores in the same directory share a check
+	assert.Equal(t, []string{"repository", "shutdown", "disk:data", "disk:log"}, names(healthChecks(c, repository, &health.Shutdown{})))
+
+	c.MinDiskSpace = 0
+	assert.Equal(t, []string{"repository", "shutdown"}, names(healthChecks(c, repository, &health.Shutdown{})))
+}
+
+func TestEventStorePersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, tt := range []struct {
+		repository string
+		eventStore string
+		ok         bool
+	}{
+		{repository: "memory", eventStore: "memory", ok: true},
+		{repository: "sqlite://file::memory:?cache=shared", eventStore: "memory", ok: true},
+		{repository: "sqlite://" + dir + "/shortener.db", eventStore: "file://" + dir + "/events.log", ok: true},
+		{repository: "memory", eventStore: "file://" + dir + "/events.log"},
+		{repository: "sqlite://" + dir + "/shortener.db", eventStore: "memory"},
+	} {
+		t.Setenv("REPOSITORY", tt.repository)
+		t.Setenv("EVENTSTORE", tt.eventStore)
+
+		_, err := getConfiguration(discardingLogger)
+		assert.Equal(t, tt.ok, err == nil, "%s, %s: %v", tt.repository, tt.eventStore, err)
+	}
+}
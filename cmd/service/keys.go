@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hex-microservice/apikey"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// commandKeys is the command line argument of the management of the API keys.
+const commandKeys = "keys"
+
+const keysUsage = `usage:
+  keys create <name>  issues a new key, its token is shown only once
+  keys list           lists the keys
+  keys revoke <id>    revokes a key`
+
+// errKeysUsage signals a wrong invocation of the keys command.
+var errKeysUsage = errors.New(keysUsage)
+
+// runKeys manages the API keys of the configured key store.
+func runKeys(parent context.Context, log logr.Logger, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errKeysUsage
+	}
+
+	c, err := getConfiguration(log)
+	if err != nil {
+		return fmt.Errorf("error processing configuration: %w", err)
+	}
+
+	// the keys of a volatile store would be gone with the command
+	if c.KeyStore.name == defaultKeyStore {
+		return fmt.Errorf("the keys of the key store '%s' don't outlive the command, configure '%s'", c.KeyStore, configKeyKeyStore)
+	}
+
+	store, close, err := c.KeyStore.new(parent, c.KeyStoreArgs)
+	if err != nil {
+		return fmt.Errorf("error creating key store: %w", err)
+	}
+
+	defer close()
+
+	keys := apikey.New(log, store)
+
+	switch {
+	case args[0] == "create" && len(args) == 2:
+		key, token, err := keys.Issue(args[1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "id:    %s\ntoken: %s\n", key.ID, token)
+
+	case args[0] == "list" && len(args) == 1:
+		list, err := keys.List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCREATED\tREVOKED")
+
+		for _, key := range list {
+			revoked := "-"
+			if !key.Active() {
+				revoked = key.RevokedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.ID, key.Name, key.CreatedAt.Format(time.RFC3339), revoked)
+		}
+
+		return w.Flush()
+
+	case args[0] == "revoke" && len(args) == 2:
+		return keys.Revoke(args[1])
+
+	default:
+		return errKeysUsage
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+	t.Setenv("KEYSTORE", "sqlite://"+filepath.Join(t.TempDir(), "keys.db"))
+
+	var out bytes.Buffer
+	if !assert.NoError(t, runKeys(context.Background(), discardingLogger, &out, []string{"create", "ci"})) {
+		return
+	}
+
+	var id, token string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if field, value, ok := strings.Cut(line, ":"); ok {
+			switch field {
+			case "id":
+				id = strings.TrimSpace(value)
+			case "token":
+				token = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	if assert.NotEmpty(t, id) && assert.True(t, strings.HasPrefix(token, id+".")) {
+		assert.NoError(t, runKeys(context.Background(), discardingLogger, &out, []string{"revoke", id}))
+
+		out.Reset()
+		if assert.NoError(t, runKeys(context.Background(), discardingLogger, &out, []string{"list"})) {
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if assert.Len(t, lines, 2) {
+				assert.True(t, strings.HasPrefix(lines[1], id))
+				assert.Contains(t, lines[1], "ci")
+				assert.False(t, strings.HasSuffix(lines[1], "-"), "the key is revoked")
+			}
+		}
+	}
+
+	assert.True(t, errors.Is(runKeys(context.Background(), discardingLogger, &out, []string{"unknown"}), errKeysUsage))
+}
+
+func TestKeysVolatileStore(t *testing.T) {
+	t.Setenv("KEYSTORE", "memory")
+
+	assert.Error(t, runKeys(context.Background(), discardingLogger, &bytes.Buffer{}, []string{"list"}))
+}
@@ -10,18 +10,40 @@ import (
 	"errors"
 	"fmt"
 	"hex-microservice/adder"
+	"hex-microservice/apikey"
+	"hex-microservice/counter"
 	"hex-microservice/customcontext"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"hex-microservice/eventstore"
+	eventfile "hex-microservice/eventstore/file"
+	eventmemory "hex-microservice/eventstore/memory"
+	"hex-microservice/generator"
 	"hex-microservice/health"
+	"hex-microservice/http/clientip"
+	"hex-microservice/http/middleware"
+	"hex-microservice/http/page"
 	"hex-microservice/invalidator"
+	"hex-microservice/keystore"
+	keymemory "hex-microservice/keystore/memory"
+	keysqlite "hex-microservice/keystore/sqlite"
 	"hex-microservice/lookup"
 	"hex-microservice/meta/value"
+	"hex-microservice/policy"
+	"hex-microservice/projection"
+	"hex-microservice/purger"
+	"hex-microservice/ranker"
+	"hex-microservice/ratelimit"
 	"hex-microservice/repository"
 	"hex-microservice/repository/memory"
+	"hex-microservice/restorer"
 	"hex-microservice/router/chi"
 	"hex-microservice/router/gin"
 	"hex-microservice/router/gorillamux"
 	"hex-microservice/router/gorouter"
 	"hex-microservice/router/httprouter"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 
 	//"hex-microservice/repository/mongo"
 	//"hex-microservice/repository/redis"
@@ -32,6 +54,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -56,6 +79,34 @@ const (
 	defaultHealthPath     = "health"
 	defaultRepositoryArgs = ""
 
+	defaultHitsFlushInterval  = 5 * time.Second
+	defaultEventFlushInterval = time.Second
+
+	defaultPurgeInterval    = time.Hour
+	defaultPurgeGracePeriod = purger.DefaultGracePeriod
+	defaultRestoreWindow    = restorer.DefaultWindow
+
+	defaultPasswordAttempts      = lookup.DefaultAttemptLimit
+	defaultPasswordAttemptWindow = lookup.DefaultAttemptWindow
+	defaultPassthroughQuery      = lookup.DefaultQueryConflict
+
+	defaultGeneratorLength   = 7
+	defaultGeneratorAlphabet = generator.Base62
+	defaultGeneratorWords    = 3
+	defaultGeneratorRetries  = adder.DefaultMaxRetries
+
+	defaultStatusCode = adder.DefaultStatusCode
+
+	defaultKeyStore  = "memory"
+	defaultAnonymous = true
+
+	defaultCreateLimit     = 60
+	defaultVisitLimit      = 600
+	defaultRateLimitWindow = time.Minute
+
+	defaultMinDiskSpace  = 64 << 20
+	defaultShutdownDrain = 5 * time.Second
+
 	// considder: https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
 	defaultServerIdleTimeout    = 120 * time.Second
 	defaultServerReadTimeout    = 5 * time.Second
@@ -67,11 +118,51 @@ const (
 const (
 	configKeyBind        = "bind"
 	configKeyMappedURL   = "mappedurl"
+	configKeyDomains     = "domains"
 	configKeyMappedPath  = "mappedpath"
 	configKeyServicePath = "service"
 	configKeyHealthPath  = "health"
 	configKeyRouter      = "router"
 	configKeyRepository  = "repository"
+
+	configKeyHitsFlushInterval  = "hitsflushinterval"
+	configKeyEventStore         = "eventstore"
+	configKeyEventFlushInterval = "eventflushinterval"
+
+	configKeyPurgeInterval    = "purgeinterval"
+	configKeyPurgeGracePeriod = "purgegrace"
+	configKeyRestoreWindow    = "restorewindow"
+
+	configKeyPasswordAttempts      = "passwordattempts"
+	configKeyPasswordAttemptWindow = "passwordattemptwindow"
+	configKeyComingSoonURL         = "comingsoonurl"
+	configKeyPassthroughQuery      = "passthroughquery"
+
+	configKeyGenerator         = "generator"
+	configKeyGeneratorLength   = "generatorlength"
+	configKeyGeneratorAlphabet = "generatoralphabet"
+	configKeyGeneratorKey      = "generatorkey"
+	configKeyGeneratorWords    = "generatorwords"
+	configKeyGeneratorRetries  = "generatorretries"
+
+	configKeyNormalize = "normalize"
+	configKeyReuse     = "reuse"
+	configKeyPolicy    = "policy"
+
+	configKeyStatusCode = "statuscode"
+
+	configKeyPreviewTemplate = "previewtemplate"
+
+	configKeyKeyStore  = "keystore"
+	configKeyAnonymous = "anonymous"
+
+	configKeyCreateLimit     = "createlimit"
+	configKeyVisitLimit      = "visitlimit"
+	configKeyRateLimitWindow = "ratelimitwindow"
+	configKeyTrustedProxies  = "trustedproxies"
+
+	configKeyMinDiskSpace  = "mindiskspace"
+	configKeyShutdownDrain = "shutdowndrain"
 )
 
 var (
@@ -79,6 +170,8 @@ var (
 	defaultRepository = repositoryImplementations[0]
 	// used default router implementation
 	defaultRouter = routerImplementations[0]
+	// used default code generator implementation
+	defaultGenerator = generatorImplementations[0]
 )
 
 // repositoryImpl represents a repository implementation that can be instantiated.
@@ -92,7 +185,7 @@ type repositoryImpl struct {
 // String returns the string representation of the routerImpl.
 func (r routerImpl) String() string { return r.name }
 
-type newRouterFn func(log logr.Logger, mappedURL string, mappedPath string, healthPath string, hs health.Service, servicePath string, as adder.Service, ls lookup.Service, is invalidator.Service) http.Handler
+type newRouterFn func(log logr.Logger, mappedURL string, domains []domain.Domain, mappedPath string, healthPath string, hs health.Service, servicePath string, create middleware.Middleware, visit middleware.Middleware, admin middleware.Middleware, as adder.Service, ls lookup.Service, us updater.Service, is invalidator.Service, rss restorer.Service, rs ranker.Service, ss scheduler.Service) http.Handler
 
 // repositoryImpl represents a router implementation that can be instantiated.
 type routerImpl struct {
@@ -103,6 +196,51 @@ type routerImpl struct {
 // String returns the string representation of the repositoryImpl.
 func (r repositoryImpl) String() string { return r.name }
 
+// newEventStoreFn is the factory function of an event store implementation.
+type newEventStoreFn func(context.Context, string) (event.Store, eventstore.Close, error)
+
+// eventStoreImpl represents an event store implementation that can be instantiated.
+type eventStoreImpl struct {
+	name string
+	new  newEventStoreFn
+}
+
+// String returns the string representation of the eventStoreImpl.
+func (e eventStoreImpl) String() string { return e.name }
+
+// newKeyStoreFn is the factory function of an API key store implementation.
+type newKeyStoreFn func(context.Context, string) (apikey.Store, keystore.Close, error)
+
+// keyStoreImpl represents an API key store implementation that can be instantiated.
+type keyStoreImpl struct {
+	name string
+	new  newKeyStoreFn
+}
+
+// String returns the string representation of the keyStoreImpl.
+func (k keyStoreImpl) String() string { return k.name }
+
+// newGeneratorFn is the factory function of a code generator implementation.
+// The sequence is backed by the repository.
+type newGeneratorFn func(c generatorConfiguration, s generator.Sequence) (adder.Generator, error)
+
+// generatorImpl represents a code generator implementation that can be instantiated.
+type generatorImpl struct {
+	name string
+	new  newGeneratorFn
+}
+
+// String returns the string representation of the generatorImpl.
+func (g generatorImpl) String() string { return g.name }
+
+// generatorConfiguration holds the parameters of the code generators.
+type generatorConfiguration struct {
+	Length   int
+	Alphabet string
+	Key      uint64
+	Words    int
+}
+
 // available router implementations
 var routerImplementations = []routerImpl{
 	{"go", gorouter.New},
@@ -120,16 +258,101 @@ var repositoryImplementations = []repositoryImpl{
 	{"sqlite", sqlite.New},
 }
 
+// available event store implementations
+var eventStoreImplementations = []eventStoreImpl{
+	{"memory", eventmemory.New},
+	{"file", eventfile.New},
+}
+
+// available API key store implementations
+var keyStoreImplementations = []keyStoreImpl{
+	{"memory", keymemory.New},
+	{"sqlite", keysqlite.New},
+}
+
+// available code generator implementations
+var generatorImplementations = []generatorImpl{
+	{"shortid", func(generatorConfiguration, generator.Sequence) (adder.Generator, error) {
+		return generator.NewShortID(), nil
+	}},
+	{"random", func(c generatorConfiguration, _ generator.Sequence) (adder.Generator, error) {
+		return generator.NewRandom(c.Length, c.Alphabet)
+	}},
+	{"sequential", func(c generatorConfiguration, s generator.Sequence) (adder.Generator, error) {
+		return generator.NewSequential(s, c.Key), nil
+	}},
+	{"words", func(c generatorConfiguration, _ generator.Sequence) (adder.Generator, error) {
+		return generator.NewWords(c.Words)
+	}},
+}
+
 // configuration describes the user defined configuration options.
 type configuration struct {
-	Bind           string
-	MappedURL      string
+	Bind      string
+	MappedURL string
+	// Domains are the custom domains with their own namespace of codes
+	Domains        []domain.Domain
 	MappedPath     string
 	ServicePath    string
 	HealthPath     string
 	Router         routerImpl
 	Repository     repositoryImpl
 	RepositoryArgs string
+
+	HitsFlushInterval time.Duration
+	// EventFlushInterval is the interval the published events are appended to the event store
+	EventFlushInterval time.Duration
+
+	// PurgeInterval is zero if the invalidated redirects are never purged
+	PurgeInterval    time.Duration
+	PurgeGracePeriod time.Duration
+	RestoreWindow    time.Duration
+
+	// PasswordAttempts limits the wrong passwords of a code within the PasswordAttemptWindow
+	PasswordAttempts      int
+	PasswordAttemptWindow time.Duration
+	// ComingSoonURL is the destination of the redirects before their activation, empty if they are not found
+	ComingSoonURL string
+	// PassthroughQuery resolves a query parameter of a passthrough redirect that the destination and the request both carry
+	PassthroughQuery lookup.QueryConflict
+
+	// EventStore is nil if the event sourcing is disabled
+	EventStore     *eventStoreImpl
+	EventStoreArgs string
+
+	Generator        generatorImpl
+	GeneratorArgs    generatorConfiguration
+	GeneratorRetries int
+
+	// Normalize canonicalizes the urls of the redirects
+	Normalize bool
+	// Reuse returns an existing redirect of the same url instead of a new one
+	Reuse bool
+	// PolicyRules are the rules the destinations of the redirects have to comply with
+	PolicyRules policy.Rules
+	// StatusCode is the status code of the redirects that don't choose one
+	StatusCode int
+
+	// PreviewTemplate is the file of the template of the preview page, empty for the embedded one
+	PreviewTemplate string
+
+	// KeyStore holds the API keys the clients authenticate with
+	KeyStore     keyStoreImpl
+	KeyStoreArgs string
+	// Anonymous allows the creation of redirects without an API key
+	Anonymous bool
+
+	// CreateLimit and VisitLimit are the requests of a client per RateLimitWindow, zero disables the limit
+	CreateLimit     int
+	VisitLimit      int
+	RateLimitWindow time.Duration
+	// ClientIPs resolves the clients behind the trusted proxies
+	ClientIPs clientip.Resolver
+
+	// MinDiskSpace is the free disk space in bytes below which the file backed stores degrade the readiness, zero disables the check
+	MinDiskSpace uint64
+	// ShutdownDrain is the period the readiness fails before the server is shut down, zero shuts down immediately
+	ShutdownDrain time.Duration
 }
 
 // getConfiguration retrieves the configuration of the service.
@@ -149,6 +372,27 @@ func getConfiguration(log logr.Logger) (*configuration, error) {
 	v.SetDefault(configKeyHealthPath, defaultHealthPath)
 	v.SetDefault(configKeyRepository, defaultRepository.String())
 	v.SetDefault(configKeyRouter, defaultRouter.String())
+	v.SetDefault(configKeyHitsFlushInterval, defaultHitsFlushInterval)
+	v.SetDefault(configKeyEventFlushInterval, defaultEventFlushInterval)
+	v.SetDefault(configKeyPurgeInterval, defaultPurgeInterval)
+	v.SetDefault(configKeyPurgeGracePeriod, defaultPurgeGracePeriod)
+	v.SetDefault(configKeyRestoreWindow, defaultRestoreWindow)
+	v.SetDefault(configKeyPasswordAttempts, defaultPasswordAttempts)
+	v.SetDefault(configKeyPasswordAttemptWindow, defaultPasswordAttemptWindow)
+	v.SetDefault(configKeyPassthroughQuery, defaultPassthroughQuery.String())
+	v.SetDefault(configKeyGenerator, defaultGenerator.String())
+	v.SetDefault(configKeyGeneratorLength, defaultGeneratorLength)
+	v.SetDefault(configKeyGeneratorAlphabet, defaultGeneratorAlphabet)
+	v.SetDefault(configKeyGeneratorWords, defaultGeneratorWords)
+	v.SetDefault(configKeyGeneratorRetries, defaultGeneratorRetries)
+	v.SetDefault(configKeyStatusCode, defaultStatusCode)
+	v.SetDefault(configKeyKeyStore, defaultKeyStore)
+	v.SetDefault(configKeyAnonymous, defaultAnonymous)
+	v.SetDefault(configKeyCreateLimit, defaultCreateLimit)
+	v.SetDefault(configKeyVisitLimit, defaultVisitLimit)
+	v.SetDefault(configKeyRateLimitWindow, defaultRateLimitWindow)
+	v.SetDefault(configKeyMinDiskSpace, defaultMinDiskSpace)
+	v.SetDefault(configKeyShutdownDrain, defaultShutdownDrain)
 
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -178,18 +422,154 @@ func getConfiguration(log logr.Logger) (*configuration, error) {
 		log.Info("default configuration value due to unsupported value", "key", configKeyRepository, "provided", v.GetString(configKeyRepository), "using", repository)
 	}
 
+	codeGenerator, ok := value.FirstByString(generatorImplementations, strings.ToLower, v.GetString(configKeyGenerator))
+	if !ok {
+		codeGenerator = defaultGenerator
+		log.Info("default configuration value due to unsupported value", "key", configKeyGenerator, "provided", v.GetString(configKeyGenerator), "using", defaultGenerator)
+	}
+
+	passthroughQuery, ok := value.FirstByString(lookup.QueryConflicts, strings.ToLower, v.GetString(configKeyPassthroughQuery))
+	if !ok {
+		passthroughQuery = defaultPassthroughQuery
+		log.Info("default configuration value due to unsupported value", "key", configKeyPassthroughQuery, "provided", v.GetString(configKeyPassthroughQuery), "using", defaultPassthroughQuery)
+	}
+
+	statusCode := v.GetInt(configKeyStatusCode)
+	if !adder.IsStatusCode(statusCode) {
+		statusCode = defaultStatusCode
+		log.Info("default configuration value due to unsupported value", "key", configKeyStatusCode, "provided", v.GetString(configKeyStatusCode), "using", defaultStatusCode)
+	}
+
+	// the event sourcing is optional
+	var eventStore *eventStoreImpl
+	eventStoreArgs := v.GetString(configKeyEventStore)
+
+	if eventStoreArgs != "" {
+		eventStoreType := eventStoreArgs
+		if parts, err := url.Parse(eventStoreArgs); err == nil && parts.Scheme != "" {
+			eventStoreType = parts.Scheme
+		}
+
+		impl, ok := value.FirstByString(eventStoreImplementations, strings.ToLower, eventStoreType)
+		if !ok {
+			return nil, fmt.Errorf("unsupported value for key '%s': %s", configKeyEventStore, eventStoreArgs)
+		}
+
+		eventStore = &impl
+
+		// the services change the redirects in the repository and publish the
+		// events, the projections must not outlive the repository or vice versa
+		if persistent := eventStore.name != "memory"; persistent != isPersistent(repository, repositoryArgs) {
+			return nil, fmt.Errorf("the event store '%s' and the repository '%s' must both be persistent or both be in memory", eventStore, repository)
+		}
+	}
+
+	keyStoreArgs := v.GetString(configKeyKeyStore)
+	keyStoreType := keyStoreArgs
+	if parts, err := url.Parse(keyStoreArgs); err == nil && parts.Scheme != "" {
+		keyStoreType = parts.Scheme
+	}
+
+	keyStore, ok := value.FirstByString(keyStoreImplementations, strings.ToLower, keyStoreType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported value for key '%s': %s", configKeyKeyStore, keyStoreArgs)
+	}
+
+	clientIPs, err := clientip.New(strings.Split(v.GetString(configKeyTrustedProxies), ",")...)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value for key '%s': %w", configKeyTrustedProxies, err)
+	}
+
+	domains, err := domain.Parse(v.GetString(configKeyDomains))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value for key '%s': %w", configKeyDomains, err)
+	}
+
+	policyRules, err := readPolicyRules(v.GetString(configKeyPolicy))
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+
 	return &configuration{
 		Bind:           v.GetString(configKeyBind),
 		MappedURL:      v.GetString(configKeyMappedURL),
+		Domains:        domains,
 		MappedPath:     v.GetString(configKeyMappedPath),
 		ServicePath:    v.GetString(configKeyServicePath),
 		HealthPath:     v.GetString(configKeyHealthPath),
 		Router:         router,
 		Repository:     repository,
 		RepositoryArgs: repositoryArgs,
+
+		HitsFlushInterval:  v.GetDuration(configKeyHitsFlushInterval),
+		EventFlushInterval: v.GetDuration(configKeyEventFlushInterval),
+
+		PurgeInterval:    v.GetDuration(configKeyPurgeInterval),
+		PurgeGracePeriod: v.GetDuration(configKeyPurgeGracePeriod),
+		RestoreWindow:    v.GetDuration(configKeyRestoreWindow),
+
+		PasswordAttempts:      v.GetInt(configKeyPasswordAttempts),
+		PasswordAttemptWindow: v.GetDuration(configKeyPasswordAttemptWindow),
+		ComingSoonURL:         v.GetString(configKeyComingSoonURL),
+		PassthroughQuery:      passthroughQuery,
+
+		EventStore:     eventStore,
+		EventStoreArgs: eventStoreArgs,
+
+		Generator: codeGenerator,
+		GeneratorArgs: generatorConfiguration{
+			Length:   v.GetInt(configKeyGeneratorLength),
+			Alphabet: v.GetString(configKeyGeneratorAlphabet),
+			Key:      v.GetUint64(configKeyGeneratorKey),
+			Words:    v.GetInt(configKeyGeneratorWords),
+		},
+		GeneratorRetries: v.GetInt(configKeyGeneratorRetries),
+
+		Normalize: v.GetBool(configKeyNormalize),
+		Reuse:     v.GetBool(configKeyReuse),
+
+		PolicyRules: policyRules,
+
+		StatusCode: statusCode,
+
+		PreviewTemplate: v.GetString(configKeyPreviewTemplate),
+
+		KeyStore:     keyStore,
+		KeyStoreArgs: keyStoreArgs,
+		Anonymous:    v.GetBool(configKeyAnonymous),
+
+		CreateLimit:     v.GetInt(configKeyCreateLimit),
+		VisitLimit:      v.GetInt(configKeyVisitLimit),
+		RateLimitWindow: v.GetDuration(configKeyRateLimitWindow),
+		ClientIPs:       clientIPs,
+
+		MinDiskSpace:  v.GetUint64(configKeyMinDiskSpace),
+		ShutdownDrain: v.GetDuration(configKeyShutdownDrain),
 	}, nil
 }
 
+// readPolicyRules reads the rules of the destination policy, the format of the
+// file is derived from its extension. Without a file the default rules apply.
+func readPolicyRules(file string) (policy.Rules, error) {
+	var rules policy.Rules
+	if file == "" {
+		return rules, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(file)
+
+	if err := v.ReadInConfig(); err != nil {
+		return rules, err
+	}
+
+	if err := v.Unmarshal(&rules); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
 // run encloses the program in a function that can take dependencies (parameters) and can return an error.
 func run(parent context.Context, log logr.Logger) error {
 	// process user input
@@ -207,20 +587,237 @@ func run(parent context.Context, log logr.Logger) error {
 
 	defer close()
 
+	codeGenerator, err := c.Generator.new(c.GeneratorArgs, repository)
+	if err != nil {
+		return fmt.Errorf("error creating code generator: %w", err)
+	}
+
+	keyStore, closeKeyStore, err := c.KeyStore.new(parent, c.KeyStoreArgs)
+	if err != nil {
+		return fmt.Errorf("error creating key store: %w", err)
+	}
+
+	defer closeKeyStore()
+
+	keys := apikey.New(log, keyStore)
+
+	// the key store and the anonymous creation are configured together
+	switch {
+	case c.Anonymous:
+		log.Info("Warning: anonymous creation of redirects is enabled, every client can create redirects without an API key", "key", configKeyAnonymous)
+	case c.KeyStore.name == "memory":
+		log.Info("Warning: anonymous creation of redirects is disabled, but the memory key store starts without API keys", "key", configKeyKeyStore)
+	}
+
+	// the creations are limited per API key or client, the visits per client
+	// and the invalid API keys per client, so that the keys can't be guessed
+	var (
+		createLimiter, visitLimiter, failureLimiter *ratelimit.Limiter
+	)
+
+	if c.RateLimitWindow > 0 {
+		limitCtx, limitCancel := context.WithCancel(parent)
+		defer limitCancel()
+
+		if c.CreateLimit > 0 {
+			createLimiter = ratelimit.New(log, c.CreateLimit, c.RateLimitWindow)
+			go createLimiter.Run(limitCtx, c.RateLimitWindow)
+
+			failureLimiter = ratelimit.New(log, c.CreateLimit, c.RateLimitWindow)
+			go failureLimiter.Run(limitCtx, c.RateLimitWindow)
+		}
+
+		if c.VisitLimit > 0 {
+			visitLimiter = ratelimit.New(log, c.VisitLimit, c.RateLimitWindow)
+			go visitLimiter.Run(limitCtx, c.RateLimitWindow)
+		}
+	}
+
+	createMiddleware := middleware.Chain(middleware.ClientIP(c.ClientIPs), middleware.Authenticate(log, keys, c.Anonymous, failureLimiter))
+	if createLimiter != nil {
+		createMiddleware = middleware.Chain(createMiddleware, middleware.RateLimit(createLimiter))
+	}
+
+	visitMiddleware := middleware.ClientIP(c.ClientIPs)
+	if visitLimiter != nil {
+		visitMiddleware = middleware.Chain(visitMiddleware, middleware.RateLimit(visitLimiter))
+	}
+
+	// the listings reveal the destinations of many redirects and always require a key
+	adminMiddleware := middleware.Chain(middleware.ClientIP(c.ClientIPs), middleware.Authenticate(log, keys, false, failureLimiter))
+
+	// purge the invalidated redirects after the grace period in the background,
+	// the job is stopped before the repository is closed
+	if c.PurgeInterval > 0 {
+		purgeCtx, purgeCancel := context.WithCancel(parent)
+
+		var purgeDone sync.WaitGroup
+		purgeDone.Add(1)
+
+		go func() {
+			defer purgeDone.Done()
+			purger.New(log, repository, c.PurgeGracePeriod).Run(purgeCtx, c.PurgeInterval)
+		}()
+
+		defer func() {
+			purgeCancel()
+			purgeDone.Wait()
+		}()
+	}
+
+	// the services publish their domain events to the bus, the read side is
+	// served by the repository unless the event sourcing is enabled
+	var (
+		bus              *event.Bus
+		lookupRepository lookup.Repository = repository
+		rankerRepository ranker.Repository = repository
+	)
+
+	if c.EventStore == nil {
+		// count the hits asynchronously and flush them to the repository
+		// the hits are flushed a last time before the repository is closed
+		hits := counter.New(log, repository)
+		hitsCtx, hitsCancel := context.WithCancel(parent)
+
+		var hitsDone sync.WaitGroup
+		hitsDone.Add(1)
+
+		go func() {
+			defer hitsDone.Done()
+			hits.Run(hitsCtx, c.HitsFlushInterval)
+		}()
+
+		defer func() {
+			hitsCancel()
+			hitsDone.Wait()
+		}()
+
+		bus = event.NewBus(log, nil, hits)
+	} else {
+		store, closeStore, err := c.EventStore.new(parent, c.EventStoreArgs)
+		if err != nil {
+			return fmt.Errorf("error creating event store: %w", err)
+		}
+
+		defer closeStore()
+
+		// the read models are projections of the event log
+		// and are rebuilt by replaying the log
+		redirects, hits := projection.NewRedirects(), projection.NewHits()
+		bus = event.NewBus(log, store, redirects, hits)
+
+		if err := bus.Replay(); err != nil {
+			return fmt.Errorf("error replaying events: %w", err)
+		}
+
+		// append the events in batches off the request path
+		// the events are appended a last time before the store is closed
+		eventsCtx, eventsCancel := context.WithCancel(parent)
+
+		var eventsDone sync.WaitGroup
+		eventsDone.Add(1)
+
+		go func() {
+			defer eventsDone.Done()
+			bus.Run(eventsCtx, c.EventFlushInterval)
+		}()
+
+		defer func() {
+			eventsCancel()
+			eventsDone.Wait()
+		}()
+
+		// the projections drop the invalidated and the expired redirects
+		if c.PurgeInterval > 0 {
+			projectionsCtx, projectionsCancel := context.WithCancel(parent)
+			defer projectionsCancel()
+
+			go purger.New(log, redirects, c.PurgeGracePeriod).Run(projectionsCtx, c.PurgeInterval)
+			go purger.New(log, hits, c.PurgeGracePeriod).Run(projectionsCtx, c.PurgeInterval)
+		}
+
+		lookupRepository, rankerRepository = redirects, hits
+	}
+
+	if c.PreviewTemplate != "" {
+		if err := page.OverridePreview(c.PreviewTemplate); err != nil {
+			return fmt.Errorf("error reading preview template: %w", err)
+		}
+	}
+
+	// the redirects must not lead to the service itself at any of its domains
+	selfURLs := []string{c.MappedURL}
+	for _, d := range c.Domains {
+		selfURLs = append(selfURLs, d.MappedURL)
+	}
+
+	destinationPolicy, err := policy.New(c.PolicyRules, selfURLs...)
+	if err != nil {
+		return fmt.Errorf("error creating policy: %w", err)
+	}
+
+	adderOptions := []adder.Option{
+		adder.WithGenerator(codeGenerator),
+		adder.WithMaxRetries(c.GeneratorRetries),
+		adder.WithPolicy(destinationPolicy),
+		adder.WithStatusCode(c.StatusCode),
+	}
+	lookupOptions := []lookup.Option{
+		lookup.WithAttemptLimit(c.PasswordAttempts, c.PasswordAttemptWindow),
+		lookup.WithQueryConflict(c.PassthroughQuery),
+	}
+	updaterOptions := []updater.Option{
+		updater.WithPolicy(destinationPolicy),
+	}
+
+	if c.Normalize {
+		adderOptions = append(adderOptions, adder.WithNormalization())
+		updaterOptions = append(updaterOptions, updater.WithNormalization())
+	}
+
+	if c.ComingSoonURL != "" {
+		lookupOptions = append(lookupOptions, lookup.WithComingSoon(c.ComingSoonURL))
+	}
+
+	if c.Reuse {
+		adderOptions = append(adderOptions, adder.WithReuse())
+	}
+
+	// the wrong passwords are dropped once their window is over
+	lookupService := lookup.New(log, lookupRepository, bus, lookupOptions...)
+
+	if c.PasswordAttemptWindow > 0 {
+		attemptsCtx, attemptsCancel := context.WithCancel(parent)
+		defer attemptsCancel()
+
+		go lookupService.Run(attemptsCtx, c.PasswordAttemptWindow)
+	}
+
+	// the readiness fails as soon as the shutdown is requested
+	var shutdown health.Shutdown
+
 	// initialize the configured router
 	// use a factory function (new) of the supported type
 	router := c.Router.new(
 		log,
 		c.MappedURL,
+		c.Domains,
 		c.MappedPath,
 
 		c.HealthPath,
-		health.New(name, version, time.Now()),
+		health.New(name, version, time.Now(), healthChecks(c, repository, &shutdown)...),
 
 		c.ServicePath,
-		adder.New(log, repository),
-		lookup.New(log, repository),
-		invalidator.New(log, repository),
+		createMiddleware,
+		visitMiddleware,
+		adminMiddleware,
+		adder.New(log, repository, bus, adderOptions...),
+		lookupService,
+		updater.New(log, repository, bus, updaterOptions...),
+		invalidator.New(log, repository, bus),
+		restorer.New(log, repository, bus, c.RestoreWindow),
+		ranker.New(log, rankerRepository),
+		scheduler.New(log, repository),
 	)
 
 	// use the built-in http server
@@ -252,11 +849,7 @@ func run(parent context.Context, log logr.Logger) error {
 		return err
 	}
 
-	// perform a graceful shutdown but cancel after a timeout
-	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), ServerShutdownGraceDuration)
-	defer timeoutCancel()
-
-	if err := server.Shutdown(timeoutCtx); err != nil {
+	if err := drain(log, server, &shutdown, c.ShutdownDrain); err != nil {
 		log.Info("Shutdown with error")
 		return err
 	}
@@ -265,6 +858,24 @@ func run(parent context.Context, log logr.Logger) error {
 	return nil
 }
 
+// drain begins the shutdown, so that the readiness fails, and keeps serving
+// the requests for the drain period until the load balancers stopped routing
+// new requests to the service. Then the server is shut down gracefully, but
+// canceled after a timeout.
+func drain(log logr.Logger, server *http.Server, shutdown *health.Shutdown, period time.Duration) error {
+	shutdown.Begin()
+
+	if period > 0 {
+		log.Info("Draining", "period", period)
+		time.Sleep(period)
+	}
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), ServerShutdownGraceDuration)
+	defer timeoutCancel()
+
+	return server.Shutdown(timeoutCtx)
+}
+
 // main is the entrypoint of the program.
 // main is the only place where external dependencies (e.g. output stream, logger, filesystem)
 // are resolved and where final errors are handled (e.g. writing to the console).
@@ -282,8 +893,15 @@ func main() {
 		cancel()
 	}()
 
-	// run the program and clean up
-	if err := run(context, log); err != nil {
+	// run the program or manage the API keys and clean up
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == commandKeys {
+		err = runKeys(context, log, os.Stdout, os.Args[2:])
+	} else {
+		err = run(context, log)
+	}
+
+	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
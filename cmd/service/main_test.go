@@ -5,14 +5,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"hex-microservice/adder"
+	"hex-microservice/apikey"
+	"hex-microservice/counter"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"hex-microservice/hashed"
 	"hex-microservice/health"
+	"hex-microservice/http/middleware"
 	"hex-microservice/http/url"
 	"hex-microservice/invalidator"
+	keymemory "hex-microservice/keystore/memory"
 	"hex-microservice/lookup"
 	"hex-microservice/meta/value"
+	"hex-microservice/ranker"
+	"hex-microservice/ratelimit"
 	"hex-microservice/repository"
 	"hex-microservice/repository/memory"
 	"hex-microservice/repository/sqlite"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
+	"image/png"
 	"io"
 	"log"
 	"net/http"
@@ -39,20 +52,28 @@ var testRepositories = []struct {
 
 const (
 	headerFieldContentType = "content-type"
+	headerFieldAccept      = "accept"
 	contentTypeMessagePack = "application/x-msgpack"
 	contentTypeJson        = "application/json"
+	contentTypeHtml        = "text/html"
 )
 
 const (
 	mappedUrl   = "https://service.arpa"
+	domainHost  = "go.arpa"
+	domainUrl   = "https://" + domainHost
 	mappedPath  = "_path_"
 	servicePath = "_service_"
 	healthPath  = "_health_"
 
 	healthTestName    = "name"
 	healthTestVersion = "version"
+
+	restoreWindow = time.Hour
 )
 
+var testDomains = []domain.Domain{{Host: domainHost, MappedURL: domainUrl}}
+
 var (
 	healthURL  = url.Join(mappedUrl, mappedPath, healthPath)
 	serviceURL = url.Join(mappedUrl, mappedPath, servicePath)
@@ -67,14 +88,23 @@ func urlForCodeAndToken(code, token string) string {
 }
 
 var (
-	healthTestNow         = time.Now()
-	healthTestStartupTime = healthTestNow.Add(-1 * time.Minute)
+	healthTestStartupTime = time.Now().Add(-1 * time.Minute)
 )
 
 type healthResponse struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
 	Uptime  string `json:"uptime"`
+	Status  string `json:"status"`
+}
+
+type readinessResponse struct {
+	Status string `json:"status"`
+	Checks []struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"checks"`
 }
 
 type link struct {
@@ -83,13 +113,69 @@ type link struct {
 	T    string `json:"type"`
 }
 
+type topResponse struct {
+	Code string `json:"code"`
+	URL  string `json:"url"`
+	Hits uint64 `json:"hits"`
+}
+
+type scheduledResponse struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	NotBefore time.Time `json:"not_before"`
+}
+
+type variantResponse struct {
+	Variant int    `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Hits    uint64 `json:"hits"`
+}
+
+type batchItemResponse struct {
+	createResponse
+	Error *struct {
+		Status int    `json:"status"`
+		Title  string `json:"title"`
+	} `json:"error"`
+}
+
 type createResponse struct {
-	Code  string `json:"code"`
-	URL   string `json:"url"`
-	Links []link `json:"_links"`
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Links     []link     `json:"_links"`
 }
 
 func matrix(t *testing.T, f func(*testing.T, http.Handler, repository.RedirectRepository)) {
+	keys, _ := testKeys(t)
+
+	middlewareMatrix(t, func() (middleware.Middleware, middleware.Middleware, middleware.Middleware) {
+		return middleware.Authenticate(discardingLogger, keys, true, nil), middleware.Chain(), middleware.Chain()
+	}, f)
+}
+
+// testKeys returns an API key service with an issued key and its token.
+func testKeys(t *testing.T) (apikey.Service, string) {
+	store, _, err := keymemory.New(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := apikey.New(discardingLogger, store)
+
+	_, token, err := keys.Issue("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys, token
+}
+
+// middlewareMatrix runs the test for all routers and repositories, the
+// middlewares of the creations, of the visits and of the listings are created
+// for every run.
+func middlewareMatrix(t *testing.T, middlewares func() (create, visit, admin middleware.Middleware), f func(*testing.T, http.Handler, repository.RedirectRepository)) {
 	gin.SetMode(gin.TestMode)
 
 	for _, routerImp := range routerImplementations {
@@ -103,49 +189,185 @@ func matrix(t *testing.T, f func(*testing.T, http.Handler, repository.RedirectRe
 				if assert.NoError(t, err) {
 					defer close()
 
-					router := routerImp.new(
-						discardingLogger,
-						mappedUrl,
-						mappedPath,
-
-						healthPath,
-						health.New(healthTestName, healthTestVersion, healthTestStartupTime),
-
-						servicePath,
-						adder.New(discardingLogger, repository),
-						lookup.New(discardingLogger, repository),
-						invalidator.New(discardingLogger, repository),
-					)
+					create, visit, admin := middlewares()
+					hs := health.New(healthTestName, healthTestVersion, healthTestStartupTime,
+						health.Check{Name: "repository", Probe: repository.Ping})
 
-					f(t, router, repository)
+					f(t, newTestRouter(routerImp.new, repository, hs, create, visit, admin), repository)
 				}
 			})
 		}
 	}
 }
 
+// newTestRouter creates a router of the services backed by the repository.
+func newTestRouter(new newRouterFn, repository repository.RedirectRepository, hs health.Service, create, visit, admin middleware.Middleware) http.Handler {
+	bus := event.NewBus(discardingLogger, nil, counter.New(discardingLogger, repository))
+
+	return new(
+		discardingLogger,
+		mappedUrl,
+		testDomains,
+		mappedPath,
+
+		healthPath,
+		hs,
+
+		servicePath,
+		create,
+		visit,
+		admin,
+		adder.New(discardingLogger, repository, bus),
+		lookup.New(discardingLogger, repository, bus),
+		updater.New(discardingLogger, repository, bus),
+		invalidator.New(discardingLogger, repository, bus),
+		restorer.New(discardingLogger, repository, bus, restoreWindow),
+		ranker.New(discardingLogger, repository),
+		scheduler.New(discardingLogger, repository),
+	)
+}
+
 func TestHealth(t *testing.T) {
 	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
-		request := httptest.NewRequest(http.MethodGet, healthURL, nil)
+		// the health path is an alias of the liveness
+		for _, u := range []string{healthURL, url.Join(healthURL, "live")} {
+			request := httptest.NewRequest(http.MethodGet, u, nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode, u) {
+				if assert.Contains(t, responseRecorder.Header().Get(headerFieldContentType), contentTypeJson) {
+					response := &healthResponse{}
+					err := json.Unmarshal(responseRecorder.Body.Bytes(), response)
+					if assert.NoError(t, err) {
+						assert.Equal(t, healthTestName, response.Name)
+						assert.Equal(t, healthTestVersion, response.Version)
+						assert.Equal(t, "up", response.Status)
+
+						// the uptime is measured at the time of the request
+						uptime, err := time.ParseDuration(response.Uptime)
+						if assert.NoError(t, err) {
+							assert.InDelta(t, time.Since(healthTestStartupTime).Seconds(), uptime.Seconds(), 1)
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestHealthReady(t *testing.T) {
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodGet, url.Join(healthURL, "ready"), nil)
 		responseRecorder := httptest.NewRecorder()
 		router.ServeHTTP(responseRecorder, request)
 
 		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
-			if assert.Contains(t, responseRecorder.Header().Get(headerFieldContentType), contentTypeJson) {
-				response := &healthResponse{}
-				err := json.Unmarshal(responseRecorder.Body.Bytes(), response)
-				if assert.NoError(t, err) {
-					assert.Equal(t, &healthResponse{
-						Name:    healthTestName,
-						Version: healthTestVersion,
-						Uptime:  healthTestNow.Sub(healthTestStartupTime).Round(time.Second).String(),
-					}, response)
+			response := &readinessResponse{}
+			if assert.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), response)) {
+				assert.Equal(t, "up", response.Status)
+				if assert.Len(t, response.Checks, 1) {
+					assert.Equal(t, "repository", response.Checks[0].Name)
+					assert.Equal(t, "up", response.Checks[0].Status)
 				}
 			}
 		}
 	})
 }
 
+func TestHealthReadyWorstCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repository, close, err := memory.New(context.Background(), "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer close()
+
+	for _, routerImp := range routerImplementations {
+		var shutdown health.Shutdown
+		hs := health.New(healthTestName, healthTestVersion, healthTestStartupTime,
+			health.Check{Name: "disk", Probe: func(context.Context) error { return health.ErrDegraded }},
+			health.Check{Name: "shutdown", Probe: shutdown.Probe},
+		)
+
+		router := newTestRouter(routerImp.new, repository, hs, middleware.Chain(), middleware.Chain(), middleware.Chain())
+
+		for _, tt := range []struct {
+			statusCode int
+			status     string
+		}{
+			// a degraded service is still ready
+			{http.StatusOK, "degraded"},
+			{http.StatusServiceUnavailable, "down"},
+		} {
+			if tt.status == "down" {
+				shutdown.Begin()
+			}
+
+			request := httptest.NewRequest(http.MethodGet, url.Join(healthURL, "ready"), nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, tt.statusCode, responseRecorder.Result().StatusCode, routerImp.name)
+
+			response := &readinessResponse{}
+			if assert.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), response)) && assert.Len(t, response.Checks, 2) {
+				assert.Equal(t, tt.status, response.Status, routerImp.name)
+				assert.Equal(t, "degraded", response.Checks[0].Status)
+				assert.NotEmpty(t, response.Checks[0].Error)
+			}
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repository, close, err := memory.New(context.Background(), "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer close()
+
+	var shutdown health.Shutdown
+	hs := health.New(healthTestName, healthTestVersion, healthTestStartupTime, health.Check{Name: "shutdown", Probe: shutdown.Probe})
+
+	server := httptest.NewUnstartedServer(newTestRouter(routerImplementations[0].new, repository, hs, middleware.Chain(), middleware.Chain(), middleware.Chain()))
+	server.Start()
+	defer server.Close()
+
+	ready := func() (int, error) {
+		response, err := server.Client().Get(server.URL + url.AbsPath(mappedPath, healthPath, "ready"))
+		if err != nil {
+			return 0, err
+		}
+		defer response.Body.Close()
+
+		return response.StatusCode, nil
+	}
+
+	if status, err := ready(); assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	drained := make(chan error)
+	go func() {
+		drained <- drain(discardingLogger, server.Config, &shutdown, 500*time.Millisecond)
+	}()
+
+	// the readiness fails while the requests are still served
+	assert.Eventually(t, func() bool {
+		status, err := ready()
+		return err == nil && status == http.StatusServiceUnavailable
+	}, 400*time.Millisecond, 10*time.Millisecond)
+
+	assert.NoError(t, <-drained)
+
+	_, err = ready()
+	assert.Error(t, err)
+}
+
 func TestRedirectGetRoot(t *testing.T) {
 	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
 		request := httptest.NewRequest(http.MethodGet, serviceURL, nil)
@@ -265,37 +487,1153 @@ func TestRedirectAddAndRead(t *testing.T) {
 	})
 }
 
-func TestInvalidateNonExisting(t *testing.T) {
-	const (
-		code  = "code"
-		token = "token"
-	)
-	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
-		request := httptest.NewRequest(http.MethodDelete, urlForCodeAndToken(code, token), nil)
+func TestRedirectAddWithTTL(t *testing.T) {
+	const url = "https://example.com/"
+	const payload = `{ "url": "` + url + `", "ttl": 3600 }`
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
 		responseRecorder := httptest.NewRecorder()
 		router.ServeHTTP(responseRecorder, request)
 
-		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+		if assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			response := &createResponse{}
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), response)
+			if assert.NoError(t, err) && assert.NotNil(t, response.ExpiresAt) {
+				assert.WithinDuration(t, time.Now().Add(time.Hour), *response.ExpiresAt, time.Minute)
+			}
+		}
 	})
 }
 
-func TestInvalidateExisting(t *testing.T) {
+func TestRedirectAddExpiredInThePast(t *testing.T) {
+	const url = "https://example.com/"
+	payload := `{ "url": "` + url + `", "expires_at": "` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `" }`
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode)
+	})
+}
+
+func TestRedirectGetExpired(t *testing.T) {
 	const (
 		code  = "code"
 		token = "token"
+		url   = "https://example.com/"
 	)
+
 	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
 		err := repository.Store(adder.RedirectStorage{
-			Code:  code,
-			Token: token,
+			Code:      code,
+			Token:     token,
+			URL:       url,
+			CreatedAt: time.Now().Add(-2 * time.Hour),
+			ExpiresAt: time.Now().Add(-time.Hour),
 		})
-
 		if assert.NoError(t, err) {
-			request := httptest.NewRequest(http.MethodDelete, urlForCodeAndToken(code, token), nil)
+			request := httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
 			responseRecorder := httptest.NewRecorder()
 			router.ServeHTTP(responseRecorder, request)
 
-			assert.Equal(t, http.StatusNoContent, responseRecorder.Result().StatusCode)
+			assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+		}
+	})
+}
+
+func TestRedirectProtected(t *testing.T) {
+	const (
+		code     = "code"
+		token    = "token"
+		url      = "https://example.com/"
+		password = "secret"
+	)
+
+	hashedPassword, err := hashed.Password(password)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		err := repository.Store(adder.RedirectStorage{
+			Code:     code,
+			Token:    token,
+			URL:      url,
+			Password: hashedPassword,
+			// the unlock form isn't repeated to the destination by a permanent redirect
+			StatusCode: http.StatusPermanentRedirect,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		request := httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusUnauthorized, responseRecorder.Result().StatusCode)
+
+		// browsers get a form to enter the password
+		request = httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+		request.Header.Set("accept", "text/html,application/xhtml+xml")
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		if assert.Equal(t, http.StatusUnauthorized, responseRecorder.Result().StatusCode) {
+			assert.Contains(t, responseRecorder.Body.String(), "<form")
+		}
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+		request.Header.Set("x-redirect-password", "wrong")
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusUnauthorized, responseRecorder.Result().StatusCode)
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+		request.Header.Set("x-redirect-password", password)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		if assert.Equal(t, http.StatusPermanentRedirect, responseRecorder.Result().StatusCode) {
+			assert.Equal(t, url, responseRecorder.Result().Header.Get("location"))
+		}
+
+		request = httptest.NewRequest(http.MethodPost, urlForCode(code), strings.NewReader("password="+password))
+		request.Header.Set(headerFieldContentType, "application/x-www-form-urlencoded")
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		if assert.Equal(t, http.StatusSeeOther, responseRecorder.Result().StatusCode) {
+			assert.Equal(t, url, responseRecorder.Result().Header.Get("location"))
+		}
+	})
+}
+
+func TestRedirectOneTime(t *testing.T) {
+	const url = "https://example.com/"
+	const payload = `{ "url": "` + url + `", "max_uses": 1 }`
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			return
+		}
+
+		response := &createResponse{}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+			return
+		}
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode) {
+			assert.Equal(t, url, responseRecorder.Result().Header.Get("location"))
+		}
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusGone, responseRecorder.Result().StatusCode)
+	})
+}
+
+func TestRedirectPreview(t *testing.T) {
+	const url = "https://example.com/preview"
+
+	type previewResponse struct {
+		Code  string `json:"code"`
+		URL   string `json:"url"`
+		Links []struct {
+			Href string `json:"href"`
+			Rel  string `json:"rel"`
+		} `json:"_links"`
+	}
+
+	create := func(t *testing.T, router http.Handler, payload string) string {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			return ""
+		}
+
+		response := &createResponse{}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+			return ""
+		}
+
+		return response.Code
+	}
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		code := create(t, router, `{ "url": "`+url+`" }`)
+		if code == "" {
+			return
+		}
+
+		// API clients get the preview as JSON
+		request := httptest.NewRequest(http.MethodGet, urlForCode(code)+"+", nil)
+		request.Header.Set(headerFieldAccept, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+			response := &previewResponse{}
+			if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); assert.NoError(t, err) {
+				assert.Equal(t, code, response.Code)
+				assert.Equal(t, url, response.URL)
+				if assert.Len(t, response.Links, 1) {
+					assert.Equal(t, urlForCode(code), response.Links[0].Href)
+				}
+			}
+		}
+
+		// browsers get the page
+		request = httptest.NewRequest(http.MethodGet, urlForCode(code)+"+", nil)
+		request.Header.Set(headerFieldAccept, contentTypeHtml)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+			assert.Contains(t, responseRecorder.Result().Header.Get(headerFieldContentType), contentTypeHtml)
+			assert.Contains(t, responseRecorder.Body.String(), url)
+		}
+
+		// a redirect with max uses has no preview, it doesn't consume the use
+		code = create(t, router, `{ "url": "`+url+`", "max_uses": 1 }`)
+		if code == "" {
+			return
+		}
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode(code)+"+", nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode)
+
+		// a custom code can't end with the preview suffix
+		request = httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(`{ "url": "`+url+`", "custom_code": "custom+" }`))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode)
+
+		// a redirect that is always previewed continues to the destination
+		code = create(t, router, `{ "url": "`+url+`", "preview": true }`)
+		if code == "" {
+			return
+		}
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+		request.Header.Set(headerFieldAccept, contentTypeJson)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+			response := &previewResponse{}
+			if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); assert.NoError(t, err) && assert.Len(t, response.Links, 1) {
+				assert.Equal(t, url, response.Links[0].Href)
+			}
+		}
+	})
+}
+
+func TestRedirectScheduled(t *testing.T) {
+	const url = "https://example.com/"
+
+	notBefore := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	payload := `{ "url": "` + url + `", "not_before": "` + notBefore.Format(time.RFC3339) + `" }`
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			return
+		}
+
+		response := &createResponse{}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+			return
+		}
+
+		// the redirect isn't activated yet
+		request = httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+
+		request = httptest.NewRequest(http.MethodGet, urlForCode("_scheduled"), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+			var scheduled []scheduledResponse
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &scheduled)
+			if assert.NoError(t, err) && assert.Len(t, scheduled, 1) {
+				assert.Equal(t, response.Code, scheduled[0].Code)
+				assert.Equal(t, url, scheduled[0].URL)
+				assert.True(t, notBefore.Equal(scheduled[0].NotBefore))
+			}
 		}
 	})
 }
+
+func TestRedirectRules(t *testing.T) {
+	const (
+		url     = "https://example.com/"
+		payload = `{ "url": "` + url + `", "rules": [
+			{ "device": "mobile", "url": "https://apps.example/" },
+			{ "language": "de", "url": "https://example.com/de" }
+		] }`
+	)
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			return
+		}
+
+		response := &createResponse{}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+			return
+		}
+
+		for _, tt := range []struct {
+			userAgent      string
+			acceptLanguage string
+			location       string
+		}{
+			{userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148", acceptLanguage: "de", location: "https://apps.example/"},
+			{userAgent: "Mozilla/5.0 (X11; Linux x86_64)", acceptLanguage: "de-DE,en;q=0.5", location: "https://example.com/de"},
+			{userAgent: "Mozilla/5.0 (X11; Linux x86_64)", acceptLanguage: "en", location: url},
+		} {
+			request := httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+			request.Header.Set("user-agent", tt.userAgent)
+			request.Header.Set("accept-language", tt.acceptLanguage)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode) {
+				assert.Equal(t, tt.location, responseRecorder.Result().Header.Get("location"))
+			}
+		}
+	})
+}
+
+func TestRedirectVariants(t *testing.T) {
+	const (
+		url      = "https://example.com/"
+		urlA     = "https://example.com/a"
+		urlB     = "https://example.com/b"
+		payload  = `{ "url": "` + url + `", "variants": [ { "url": "` + urlA + `", "weight": 70 }, { "url": "` + urlB + `", "weight": 30 } ] }`
+		variants = "variants"
+	)
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			return
+		}
+
+		response := &createResponse{}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+			return
+		}
+
+		// a new visitor is assigned a variant by a cookie
+		request = httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode) {
+			return
+		}
+
+		cookies := responseRecorder.Result().Cookies()
+		if !assert.Len(t, cookies, 1) {
+			return
+		}
+
+		assert.Equal(t, request.URL.Path, cookies[0].Path)
+		assert.Contains(t, []string{urlA, urlB}, responseRecorder.Result().Header.Get("location"))
+
+		// a returning visitor keeps the variant
+		for _, tt := range []struct {
+			variant  string
+			location string
+		}{
+			{variant: "1", location: urlA},
+			{variant: "2", location: urlB},
+		} {
+			request := httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+			request.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: tt.variant})
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode) {
+				assert.Equal(t, tt.location, responseRecorder.Result().Header.Get("location"))
+			}
+		}
+
+		err := repository.IncrementVariantHits(map[domain.Key]map[int]uint64{{Code: response.Code}: {1: 7, 2: 3}})
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodGet, urlForCode(response.Code)+"/"+variants, nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+				var compared []variantResponse
+				err := json.Unmarshal(responseRecorder.Body.Bytes(), &compared)
+				if assert.NoError(t, err) {
+					assert.Equal(t, []variantResponse{
+						{Variant: 1, URL: urlA, Weight: 70, Hits: 7},
+						{Variant: 2, URL: urlB, Weight: 30, Hits: 3},
+					}, compared)
+				}
+			}
+		}
+
+		// a redirect without variants has nothing to compare
+		request = httptest.NewRequest(http.MethodGet, urlForCode("unknown")+"/"+variants, nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+
+		// the variant of a passed through path is kept for the whole redirect
+		request = httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(strings.Replace(payload, "{", `{ "passthrough": true,`, 1)))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		passthrough := &createResponse{}
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) || !assert.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), passthrough)) {
+			return
+		}
+
+		codeRequest := httptest.NewRequest(http.MethodGet, urlForCode(passthrough.Code), nil)
+		request = httptest.NewRequest(http.MethodGet, urlForCode(passthrough.Code)+"/deep/path", nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if cookies := responseRecorder.Result().Cookies(); assert.Len(t, cookies, 1) {
+			assert.Equal(t, codeRequest.URL.Path, cookies[0].Path)
+		}
+	})
+}
+
+func TestRedirectPassthrough(t *testing.T) {
+	const (
+		url     = "https://example.com/base?ref=1"
+		payload = `{ "url": "` + url + `", "passthrough": true }`
+	)
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			return
+		}
+
+		response := &createResponse{}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+			return
+		}
+
+		for _, tt := range []struct {
+			suffix   string
+			location string
+		}{
+			{suffix: "", location: url},
+			{suffix: "?utm_source=x&ref=2", location: "https://example.com/base?ref=1&utm_source=x"},
+			{suffix: "/extra/path?utm_source=x", location: "https://example.com/base/extra/path?ref=1&utm_source=x"},
+		} {
+			request := httptest.NewRequest(http.MethodGet, urlForCode(response.Code)+tt.suffix, nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode, tt.suffix) {
+				assert.Equal(t, tt.location, responseRecorder.Result().Header.Get("location"))
+			}
+		}
+
+		// a redirect without passthrough has no paths below its code
+		err := repository.Store(adder.RedirectStorage{Code: "exact", Token: "token", URL: url})
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodGet, urlForCode("exact")+"/extra/path", nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+		}
+	})
+}
+
+func TestRedirectStatusCode(t *testing.T) {
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		for _, tt := range []struct {
+			payload string
+			status  int
+		}{
+			{payload: `{ "url": "https://example.com/default" }`, status: http.StatusTemporaryRedirect},
+			{payload: `{ "url": "https://example.com/moved", "status_code": 301 }`, status: http.StatusMovedPermanently},
+			{payload: `{ "url": "https://example.com/found", "status_code": 302 }`, status: http.StatusFound},
+			{payload: `{ "url": "https://example.com/permanent", "status_code": 308 }`, status: http.StatusPermanentRedirect},
+		} {
+			request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(tt.payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode, tt.payload) {
+				continue
+			}
+
+			response := &createResponse{}
+			if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+				continue
+			}
+
+			request = httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+			responseRecorder = httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, tt.status, responseRecorder.Result().StatusCode, tt.payload)
+		}
+
+		// only redirection status codes are accepted
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(`{ "url": "https://example.com/ok", "status_code": 200 }`))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode)
+	})
+}
+
+func TestRedirectDomains(t *testing.T) {
+	const code = "namespaced"
+
+	// the same code leads to different destinations at different domains
+	redirects := []struct {
+		service string
+		url     string
+	}{
+		{service: serviceURL, url: "https://example.com/default"},
+		{service: url.Join(domainUrl, mappedPath, servicePath), url: "https://example.com/custom"},
+	}
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		for _, tt := range redirects {
+			payload := `{ "url": "` + tt.url + `", "custom_code": "` + code + `" }`
+
+			request := httptest.NewRequest(http.MethodPost, tt.service, strings.NewReader(payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode, tt.service) {
+				continue
+			}
+
+			response := &createResponse{}
+			if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); assert.NoError(t, err) && assert.NotEmpty(t, response.Links) {
+				assert.Equal(t, url.Join(tt.service, code), response.Links[0].Href)
+			}
+		}
+
+		for _, tt := range redirects {
+			request := httptest.NewRequest(http.MethodGet, url.Join(tt.service, code), nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode, tt.service) {
+				assert.Equal(t, tt.url, responseRecorder.Result().Header.Get("location"))
+			}
+		}
+	})
+}
+
+func TestRedirectQR(t *testing.T) {
+	const payload = `{ "url": "https://example.com/qr" }`
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if !assert.Equal(t, http.StatusCreated, responseRecorder.Result().StatusCode) {
+			return
+		}
+
+		response := &createResponse{}
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), response); !assert.NoError(t, err) {
+			return
+		}
+
+		qrUrl := value.FirstValueFromSlice(response.Links, func(l link) bool {
+			return l.Rel == "qr"
+		})
+		if !assert.NotNil(t, qrUrl, "QR URL missing") {
+			return
+		}
+
+		assert.Equal(t, url.Join(urlForCode(response.Code), "qr"), qrUrl.Href)
+
+		request = httptest.NewRequest(http.MethodGet, qrUrl.Href+"?size=300&level=h", nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+			assert.Equal(t, "image/png", responseRecorder.Result().Header.Get(headerFieldContentType))
+
+			img, err := png.Decode(responseRecorder.Body)
+			if assert.NoError(t, err) {
+				assert.LessOrEqual(t, img.Bounds().Dx(), 300)
+			}
+		}
+
+		request = httptest.NewRequest(http.MethodGet, qrUrl.Href+"?format=svg", nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+			assert.Equal(t, "image/svg+xml", responseRecorder.Result().Header.Get(headerFieldContentType))
+			assert.Contains(t, responseRecorder.Body.String(), "<svg")
+		}
+
+		for _, query := range []string{"?size=1", "?size=2048", "?size=x", "?level=x", "?format=gif"} {
+			request = httptest.NewRequest(http.MethodGet, qrUrl.Href+query, nil)
+			responseRecorder = httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode, query)
+		}
+
+		// an unknown code has no QR code
+		request = httptest.NewRequest(http.MethodGet, url.Join(urlForCode("unknown"), "qr"), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+	})
+}
+
+func TestRedirectInvalidRules(t *testing.T) {
+	const payload = `{ "url": "https://example.com/", "rules": [ { "url": "https://example.com/de" } ] }`
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode)
+	})
+}
+
+func TestRedirectBatch(t *testing.T) {
+	const payload = `[
+		{ "url": "https://example.com/" },
+		{ "url": "" },
+		{ "url": "https://example.org/", "custom_code": "custom" }
+	]`
+
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodPost, url.Join(serviceURL, "_batch"), strings.NewReader(payload))
+		request.Header.Set(headerFieldContentType, contentTypeJson)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusMultiStatus, responseRecorder.Result().StatusCode) {
+			var response []batchItemResponse
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+			if assert.NoError(t, err) && assert.Len(t, response, 3) {
+				assert.Nil(t, response[0].Error)
+				assert.NotEmpty(t, response[0].Code)
+				if assert.NotNil(t, response[1].Error) {
+					assert.Equal(t, http.StatusBadRequest, response[1].Error.Status)
+				}
+				assert.Nil(t, response[2].Error)
+				assert.Equal(t, "custom", response[2].Code)
+
+				request := httptest.NewRequest(http.MethodGet, urlForCode("custom"), nil)
+				responseRecorder := httptest.NewRecorder()
+				router.ServeHTTP(responseRecorder, request)
+
+				if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode) {
+					assert.Equal(t, "https://example.org/", responseRecorder.Result().Header.Get("location"))
+				}
+			}
+		}
+	})
+}
+
+func TestRedirectBatchAtomic(t *testing.T) {
+	const payload = `[
+		{ "url": "https://example.com/", "custom_code": "first" },
+		{ "url": "https://example.org/", "custom_code": "taken" }
+	]`
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		err := repository.Store(adder.RedirectStorage{
+			Code:  "taken",
+			Token: "token",
+			URL:   "https://example.net/",
+		})
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodPost, url.Join(serviceURL, "_batch")+"?atomic=true", strings.NewReader(payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode) {
+				var response []batchItemResponse
+				err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+				if assert.NoError(t, err) && assert.Len(t, response, 2) {
+					if assert.NotNil(t, response[0].Error) {
+						assert.Equal(t, http.StatusFailedDependency, response[0].Error.Status)
+					}
+					if assert.NotNil(t, response[1].Error) {
+						assert.Equal(t, http.StatusConflict, response[1].Error.Status)
+					}
+				}
+
+				request := httptest.NewRequest(http.MethodGet, urlForCode("first"), nil)
+				responseRecorder := httptest.NewRecorder()
+				router.ServeHTTP(responseRecorder, request)
+
+				assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+			}
+		}
+	})
+}
+
+func TestRedirectAuthentication(t *testing.T) {
+	const (
+		destination = "https://example.com/owned"
+		payload     = `{ "url": "` + destination + `" }`
+	)
+
+	keys, token := testKeys(t)
+	owner, _ := keys.Authenticate(token)
+
+	middlewareMatrix(t, func() (middleware.Middleware, middleware.Middleware, middleware.Middleware) {
+		return middleware.Authenticate(discardingLogger, keys, false, nil), middleware.Chain(), middleware.Authenticate(discardingLogger, keys, false, nil)
+	}, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		for _, tt := range []struct {
+			target        string
+			authorization string
+			status        int
+		}{
+			{target: serviceURL, status: http.StatusUnauthorized},
+			{target: url.Join(serviceURL, "_batch"), status: http.StatusUnauthorized},
+			{target: serviceURL, authorization: "Bearer " + owner.ID + ".wrong", status: http.StatusUnauthorized},
+			{target: serviceURL, authorization: "Bearer " + token, status: http.StatusCreated},
+		} {
+			body := payload
+			if strings.HasSuffix(tt.target, "_batch") {
+				body = "[" + payload + "]"
+			}
+
+			request := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(body))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			if tt.authorization != "" {
+				request.Header.Set("authorization", tt.authorization)
+			}
+
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, tt.status, responseRecorder.Result().StatusCode, tt) && tt.status == http.StatusUnauthorized {
+				assert.Contains(t, responseRecorder.Result().Header.Get("www-authenticate"), "Bearer")
+			}
+		}
+
+		// the redirect is owned by the key
+		stored, err := repository.LookupByURL(domain.Default, destination)
+		if assert.NoError(t, err) {
+			assert.Equal(t, owner.ID, stored.Owner)
+		}
+
+		// the listings and the statistics require a key
+		for _, path := range []string{"_scheduled", "_stats"} {
+			for _, authorization := range []string{"", "Bearer " + token} {
+				request := httptest.NewRequest(http.MethodGet, url.Join(serviceURL, path), nil)
+				if authorization != "" {
+					request.Header.Set("authorization", authorization)
+				}
+
+				responseRecorder := httptest.NewRecorder()
+				router.ServeHTTP(responseRecorder, request)
+
+				if authorization == "" {
+					assert.Equal(t, http.StatusUnauthorized, responseRecorder.Result().StatusCode, path)
+				} else {
+					assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode, path)
+				}
+			}
+		}
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	const payload = `{ "url": "https://example.com/limited" }`
+
+	keys, token := testKeys(t)
+
+	middlewareMatrix(t, func() (middleware.Middleware, middleware.Middleware, middleware.Middleware) {
+		create := middleware.Chain(
+			middleware.Authenticate(discardingLogger, keys, true, nil),
+			middleware.RateLimit(ratelimit.New(discardingLogger, 1, time.Minute)),
+		)
+
+		return create, middleware.RateLimit(ratelimit.New(discardingLogger, 2, time.Minute)), middleware.Chain()
+	}, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		post := func(authorization string) *http.Response {
+			request := httptest.NewRequest(http.MethodPost, serviceURL, strings.NewReader(payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			if authorization != "" {
+				request.Header.Set("authorization", authorization)
+			}
+
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			return responseRecorder.Result()
+		}
+
+		created := post("")
+		if !assert.Equal(t, http.StatusCreated, created.StatusCode) {
+			return
+		}
+
+		assert.Equal(t, "1", created.Header.Get("ratelimit-limit"))
+		assert.Equal(t, "0", created.Header.Get("ratelimit-remaining"))
+		assert.Equal(t, "60", created.Header.Get("ratelimit-reset"))
+
+		limited := post("")
+		if assert.Equal(t, http.StatusTooManyRequests, limited.StatusCode) {
+			assert.Equal(t, "60", limited.Header.Get("retry-after"))
+		}
+
+		// an API key has its own budget
+		assert.Equal(t, http.StatusCreated, post("Bearer "+token).StatusCode)
+
+		response := &createResponse{}
+		body, _ := io.ReadAll(created.Body)
+		if err := json.Unmarshal(body, response); !assert.NoError(t, err) {
+			return
+		}
+
+		for _, status := range []int{http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, http.StatusTooManyRequests} {
+			request := httptest.NewRequest(http.MethodGet, urlForCode(response.Code), nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, status, responseRecorder.Result().StatusCode)
+		}
+
+		// the QR codes share the budget of the redirects
+		request := httptest.NewRequest(http.MethodGet, url.Join(urlForCode(response.Code), "qr"), nil)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusTooManyRequests, responseRecorder.Result().StatusCode)
+	})
+}
+
+func TestRateLimitBatch(t *testing.T) {
+	const item = `{ "url": "https://example.com/limited" }`
+
+	middlewareMatrix(t, func() (middleware.Middleware, middleware.Middleware, middleware.Middleware) {
+		return middleware.RateLimit(ratelimit.New(discardingLogger, 3, time.Minute)), middleware.Chain(), middleware.Chain()
+	}, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		batch := func(items int) *http.Response {
+			payload := "[" + strings.TrimSuffix(strings.Repeat(item+",", items), ",") + "]"
+			request := httptest.NewRequest(http.MethodPost, url.Join(serviceURL, "_batch"), strings.NewReader(payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			return responseRecorder.Result()
+		}
+
+		// a batch never fits beyond the limit
+		assert.Equal(t, http.StatusRequestEntityTooLarge, batch(4).StatusCode)
+
+		created := batch(2)
+		if assert.Equal(t, http.StatusCreated, created.StatusCode) {
+			assert.Equal(t, "1", created.Header.Get("ratelimit-remaining"))
+		}
+
+		// every item takes a token, the denied batch takes none
+		limited := batch(2)
+		if assert.Equal(t, http.StatusTooManyRequests, limited.StatusCode) {
+			assert.Equal(t, "20", limited.Header.Get("retry-after"))
+		}
+
+		assert.Equal(t, http.StatusCreated, batch(1).StatusCode)
+	})
+}
+
+func TestRedirectStats(t *testing.T) {
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodGet, url.Join(serviceURL, "_stats"), nil)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+			var response map[string]uint64
+			if assert.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &response)) {
+				assert.Contains(t, response, "collisions")
+				assert.Contains(t, response, "exhausted")
+			}
+		}
+	})
+}
+
+func TestInvalidateNonExisting(t *testing.T) {
+	const (
+		code  = "code"
+		token = "token"
+	)
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodDelete, urlForCodeAndToken(code, token), nil)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+	})
+}
+
+func TestInvalidateExisting(t *testing.T) {
+	const (
+		code  = "code"
+		token = "token"
+	)
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		err := repository.Store(adder.RedirectStorage{
+			Code:  code,
+			Token: token,
+		})
+
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodDelete, urlForCodeAndToken(code, token), nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, http.StatusNoContent, responseRecorder.Result().StatusCode)
+		}
+	})
+}
+
+func TestRestoreInvalidated(t *testing.T) {
+	const (
+		code  = "code"
+		token = "token"
+		url   = "https://example.com/"
+	)
+
+	restoreURL := urlForCodeAndToken(code, token) + "/restore"
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		err := repository.Store(adder.RedirectStorage{
+			Code:  code,
+			Token: token,
+			URL:   url,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		// an active redirect can't be restored
+		request := httptest.NewRequest(http.MethodPost, restoreURL, nil)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+
+		request = httptest.NewRequest(http.MethodDelete, urlForCodeAndToken(code, token), nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusNoContent, responseRecorder.Result().StatusCode)
+
+		request = httptest.NewRequest(http.MethodPost, urlForCodeAndToken(code, "wrong")+"/restore", nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+
+		request = httptest.NewRequest(http.MethodPost, restoreURL, nil)
+		responseRecorder = httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if assert.Equal(t, http.StatusNoContent, responseRecorder.Result().StatusCode) {
+			request := httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode) {
+				assert.Equal(t, url, responseRecorder.Result().Header.Get("location"))
+			}
+		}
+	})
+}
+
+func TestUpdateExisting(t *testing.T) {
+	const (
+		code    = "code"
+		token   = "token"
+		url     = "https://example.com/"
+		updated = "https://example.org/"
+		payload = `{ "url": "` + updated + `" }`
+	)
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		err := repository.Store(adder.RedirectStorage{
+			Code:  code,
+			Token: token,
+			URL:   url,
+		})
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodPatch, urlForCodeAndToken(code, token), strings.NewReader(payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusNoContent, responseRecorder.Result().StatusCode) {
+				request := httptest.NewRequest(http.MethodGet, urlForCode(code), nil)
+				responseRecorder := httptest.NewRecorder()
+				router.ServeHTTP(responseRecorder, request)
+
+				if assert.Equal(t, http.StatusTemporaryRedirect, responseRecorder.Result().StatusCode) {
+					assert.Equal(t, updated, responseRecorder.Result().Header.Get("location"))
+				}
+			}
+		}
+	})
+}
+
+func TestUpdateWrongToken(t *testing.T) {
+	const (
+		code    = "code"
+		token   = "token"
+		payload = `{ "url": "https://example.org/" }`
+	)
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		err := repository.Store(adder.RedirectStorage{
+			Code:  code,
+			Token: token,
+			URL:   "https://example.com/",
+		})
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodPatch, urlForCodeAndToken(code, "wrong"), strings.NewReader(payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, http.StatusNotFound, responseRecorder.Result().StatusCode)
+		}
+	})
+}
+
+func TestUpdateInvalidURL(t *testing.T) {
+	const (
+		code    = "code"
+		token   = "token"
+		payload = `{ "url": "not a url" }`
+	)
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		err := repository.Store(adder.RedirectStorage{
+			Code:  code,
+			Token: token,
+			URL:   "https://example.com/",
+		})
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodPatch, urlForCodeAndToken(code, token), strings.NewReader(payload))
+			request.Header.Set(headerFieldContentType, contentTypeJson)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode)
+		}
+	})
+}
+
+func TestTop(t *testing.T) {
+	const (
+		url        = "https://example.com/"
+		popular    = "popular"
+		unpopular  = "unpopular"
+		token      = "token"
+		limitQuery = "?n=1"
+	)
+
+	matrix(t, func(t *testing.T, router http.Handler, repository repository.RedirectRepository) {
+		for _, code := range []string{popular, unpopular} {
+			err := repository.Store(adder.RedirectStorage{
+				Code:  code,
+				Token: token,
+				URL:   url,
+			})
+			assert.NoError(t, err)
+		}
+
+		err := repository.IncrementHits(map[domain.Key]uint64{{Code: popular}: 3, {Code: unpopular}: 1})
+		if assert.NoError(t, err) {
+			request := httptest.NewRequest(http.MethodGet, urlForCode("_top")+limitQuery, nil)
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if assert.Equal(t, http.StatusOK, responseRecorder.Result().StatusCode) {
+				var response []topResponse
+				err := json.Unmarshal(responseRecorder.Body.Bytes(), &response)
+				if assert.NoError(t, err) {
+					assert.Equal(t, []topResponse{{Code: popular, URL: url, Hits: 3}}, response)
+				}
+			}
+		}
+	})
+}
+
+func TestTopInvalidLimit(t *testing.T) {
+	matrix(t, func(t *testing.T, router http.Handler, _ repository.RedirectRepository) {
+		request := httptest.NewRequest(http.MethodGet, urlForCode("_top")+"?n=0", nil)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, responseRecorder.Result().StatusCode)
+	})
+}
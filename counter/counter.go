@@ -0,0 +1,131 @@
+// Package counter offers an asynchronous hit counter. The hits are aggregated
+// in memory and flushed periodically to the repository to keep the writes off
+// the redirect hot path.
+package counter
+
+import (
+	"context"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Repository defines the methods the counter expects from
+// a repository implementation.
+type Repository interface {
+	// IncrementHits adds the given number of hits per redirect.
+	IncrementHits(hits map[domain.Key]uint64) error
+	// IncrementVariantHits adds the given number of hits per redirect and variant.
+	IncrementVariantHits(hits map[domain.Key]map[int]uint64) error
+}
+
+// Counter aggregates hits per redirect and per variant until they are flushed.
+type Counter struct {
+	logger     logr.Logger
+	repository Repository
+
+	pending         map[domain.Key]uint64
+	pendingVariants map[domain.Key]map[int]uint64
+	m               sync.Mutex
+}
+
+// New creates a new counter.
+func New(l logr.Logger, r Repository) *Counter {
+	return &Counter{
+		logger:          l,
+		repository:      r,
+		pending:         make(map[domain.Key]uint64),
+		pendingVariants: make(map[domain.Key]map[int]uint64),
+	}
+}
+
+// Handle counts the visits of the redirects. It never blocks on the repository.
+func (c *Counter) Handle(e event.Event) {
+	if e.Type != event.RedirectVisited {
+		return
+	}
+
+	key := domain.Key{Domain: e.Domain, Code: e.Code}
+
+	c.m.Lock()
+	c.pending[key]++
+	if e.Variant > 0 {
+		addVariantHits(c.pendingVariants, key, map[int]uint64{e.Variant: 1})
+	}
+	c.m.Unlock()
+}
+
+// Flush writes the aggregated hits to the repository. The hits are kept for
+// the next flush if the repository reports an error.
+func (c *Counter) Flush() error {
+	c.m.Lock()
+	hits, variantHits := c.pending, c.pendingVariants
+	c.pending, c.pendingVariants = make(map[domain.Key]uint64), make(map[domain.Key]map[int]uint64)
+	c.m.Unlock()
+
+	if len(hits) > 0 {
+		if err := c.repository.IncrementHits(hits); err != nil {
+			c.m.Lock()
+			for key, n := range hits {
+				c.pending[key] += n
+			}
+			for key, variants := range variantHits {
+				addVariantHits(c.pendingVariants, key, variants)
+			}
+			c.m.Unlock()
+
+			return err
+		}
+	}
+
+	if len(variantHits) > 0 {
+		if err := c.repository.IncrementVariantHits(variantHits); err != nil {
+			c.m.Lock()
+			for key, variants := range variantHits {
+				addVariantHits(c.pendingVariants, key, variants)
+			}
+			c.m.Unlock()
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addVariantHits adds the hits of the variants of a redirect to the
+// aggregated hits, the lock must be held.
+func addVariantHits(pending map[domain.Key]map[int]uint64, key domain.Key, variants map[int]uint64) {
+	if _, ok := pending[key]; !ok {
+		pending[key] = make(map[int]uint64)
+	}
+
+	for variant, n := range variants {
+		pending[key][variant] += n
+	}
+}
+
+// Run flushes the hits in the given interval until the context is done.
+// A final flush is performed before returning.
+func (c *Counter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				c.logger.Error(err, "error flushing hits")
+			}
+		case <-ctx.Done():
+			if err := c.Flush(); err != nil {
+				c.logger.Error(err, "error flushing hits on shutdown")
+			}
+
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package counter
+
+import (
+	"errors"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+type repositoryFn func(map[domain.Key]uint64) error
+
+func (fn repositoryFn) IncrementHits(hits map[domain.Key]uint64) error { return fn(hits) }
+
+func (fn repositoryFn) IncrementVariantHits(map[domain.Key]map[int]uint64) error { return nil }
+
+type variantRepositoryFn func(map[domain.Key]map[int]uint64) error
+
+func (fn variantRepositoryFn) IncrementHits(map[domain.Key]uint64) error { return nil }
+
+func (fn variantRepositoryFn) IncrementVariantHits(hits map[domain.Key]map[int]uint64) error {
+	return fn(hits)
+}
+
+func TestFlushAggregates(t *testing.T) {
+	var flushed map[domain.Key]uint64
+
+	c := New(discardingLogger, repositoryFn(func(hits map[domain.Key]uint64) error {
+		flushed = hits
+		return nil
+	}))
+
+	now := time.Now()
+
+	c.Handle(event.Visited(domain.Default, "foo", now))
+	c.Handle(event.Visited(domain.Default, "foo", now))
+	c.Handle(event.Visited(domain.Default, "bar", now))
+	c.Handle(event.Visited("go.example", "foo", now))
+	c.Handle(event.Created(domain.Default, "bar", "https://example.com", time.Time{}, now))
+
+	if assert.NoError(t, c.Flush()) {
+		assert.Equal(t, map[domain.Key]uint64{
+			{Code: "foo"}:                       2,
+			{Code: "bar"}:                       1,
+			{Domain: "go.example", Code: "foo"}: 1,
+		}, flushed)
+	}
+}
+
+func TestFlushKeepsHitsOnError(t *testing.T) {
+	errRepository := errors.New("repository")
+	fail := true
+
+	var flushed map[domain.Key]uint64
+
+	c := New(discardingLogger, repositoryFn(func(hits map[domain.Key]uint64) error {
+		if fail {
+			return errRepository
+		}
+
+		flushed = hits
+		return nil
+	}))
+
+	c.Handle(event.Visited(domain.Default, "foo", time.Now()))
+	assert.ErrorIs(t, c.Flush(), errRepository)
+
+	fail = false
+	c.Handle(event.Visited(domain.Default, "foo", time.Now()))
+	if assert.NoError(t, c.Flush()) {
+		assert.Equal(t, map[domain.Key]uint64{{Code: "foo"}: 2}, flushed)
+	}
+}
+
+func TestFlushAggregatesVariants(t *testing.T) {
+	errRepository := errors.New("repository")
+	fail := true
+
+	var flushed map[domain.Key]map[int]uint64
+	c := New(discardingLogger, variantRepositoryFn(func(hits map[domain.Key]map[int]uint64) error {
+		if fail {
+			return errRepository
+		}
+
+		flushed = hits
+		return nil
+	}))
+
+	visited := func(code string, variant int) event.Event {
+		e := event.Visited(domain.Default, code, time.Now())
+		e.Variant = variant
+		return e
+	}
+
+	c.Handle(visited("foo", 1))
+	c.Handle(visited("foo", 2))
+	c.Handle(visited("bar", 0))
+	assert.ErrorIs(t, c.Flush(), errRepository)
+
+	fail = false
+	c.Handle(visited("foo", 1))
+	if assert.NoError(t, c.Flush()) {
+		assert.Equal(t, map[domain.Key]map[int]uint64{{Code: "foo"}: {1: 2, 2: 1}}, flushed)
+	}
+}
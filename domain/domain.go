@@ -0,0 +1,101 @@
+// Package domain offers the custom domains the redirects are served at. Every
+// domain has its own namespace of codes, so that the same code leads to
+// different destinations on different domains.
+package domain
+
+import (
+	"errors"
+	"fmt"
+	httpurl "hex-microservice/http/url"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Default is the domain of the requests to hosts that aren't configured, its
+// redirects are mapped to the global mapped url.
+const Default = ""
+
+// ErrInvalid signals that the list of domains can't be parsed.
+var ErrInvalid = errors.New("invalid domain")
+
+const (
+	listSeparator = ","
+	pairSeparator = "="
+)
+
+// Key identifies a redirect across the namespaces of the domains.
+type Key struct {
+	Domain string
+	Code   string
+}
+
+// Domain is a custom domain with the url its redirects are mapped to.
+type Domain struct {
+	// Host is the normalized host of the requests, see Host.
+	Host      string
+	MappedURL string
+}
+
+// Parse parses a comma separated list of host=mappedurl pairs. The mapped
+// url of a host without one is https://host.
+func Parse(s string) ([]Domain, error) {
+	var domains []Domain
+
+	seen := make(map[string]struct{})
+	for _, pair := range strings.Split(s, listSeparator) {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		host, mappedURL := pair, ""
+		if i := strings.Index(pair, pairSeparator); i >= 0 {
+			host, mappedURL = strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		}
+
+		host = Host(host)
+		if host == Default {
+			return nil, fmt.Errorf("domain.Parse %q without host: %w", pair, ErrInvalid)
+		}
+
+		if _, ok := seen[host]; ok {
+			return nil, fmt.Errorf("domain.Parse duplicate host %q: %w", host, ErrInvalid)
+		}
+
+		if mappedURL == "" {
+			mappedURL = "https://" + host
+		}
+
+		if u, err := url.Parse(mappedURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("domain.Parse mapped url %q of %q: %w", mappedURL, host, ErrInvalid)
+		}
+
+		seen[host] = struct{}{}
+		domains = append(domains, Domain{Host: host, MappedURL: mappedURL})
+	}
+
+	return domains, nil
+}
+
+// MappedURLs returns the mapped urls of the domains by their host, joined
+// with the paths the service is mapped to.
+func MappedURLs(domains []Domain, paths ...string) map[string]string {
+	mappedURLs := make(map[string]string, len(domains))
+	for _, d := range domains {
+		mappedURLs[d.Host] = httpurl.Join(append([]string{d.MappedURL}, paths...)...)
+	}
+
+	return mappedURLs
+}
+
+// Host returns the normalized host of a request: lowercase, without the port
+// and without the trailing dot of a fully qualified name.
+func Host(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	domains, err := Parse(" go.example=https://go.example/r , Links.Example:8443 ,")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Domain{
+			{Host: "go.example", MappedURL: "https://go.example/r"},
+			{Host: "links.example", MappedURL: "https://links.example"},
+		}, domains)
+	}
+
+	domains, err = Parse("")
+	assert.NoError(t, err)
+	assert.Empty(t, domains)
+
+	for _, s := range []string{"=https://go.example", "go.example,GO.example", "go.example=go.example"} {
+		_, err := Parse(s)
+		assert.ErrorIs(t, err, ErrInvalid, s)
+	}
+}
+
+func TestHost(t *testing.T) {
+	for hostport, host := range map[string]string{
+		"go.example":      "go.example",
+		"Go.Example:8000": "go.example",
+		"go.example.":     "go.example",
+		"[::1]:8000":      "::1",
+		"localhost:8000":  "localhost",
+		"":                "",
+	} {
+		assert.Equal(t, host, Host(hostport), hostport)
+	}
+}
@@ -0,0 +1,119 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Bus is a Publisher that dispatches the events to the handlers and appends
+// them to an optional store in the same order. The appends are batched off
+// the path of the publisher, see Run.
+type Bus struct {
+	logger   logr.Logger
+	store    Store
+	handlers []Handler
+
+	// pending are the published events that aren't appended to the store yet
+	pending []Event
+	m       sync.Mutex
+	// appending keeps the order of the batches in the store
+	appending sync.Mutex
+}
+
+// NewBus creates a new bus. The store is optional (nil) if the events
+// should only be dispatched to the handlers.
+func NewBus(l logr.Logger, s Store, handlers ...Handler) *Bus {
+	return &Bus{
+		logger:   l,
+		store:    s,
+		handlers: handlers,
+	}
+}
+
+// Publish dispatches the events to the handlers and keeps them for the next
+// append to the store. It never blocks on the store.
+func (b *Bus) Publish(events ...Event) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.store != nil {
+		b.pending = append(b.pending, events...)
+	}
+
+	for _, e := range events {
+		b.dispatch(e)
+	}
+}
+
+// Flush appends the pending events to the store in a single batch. The
+// events are kept for the next flush if the store reports an error.
+func (b *Bus) Flush() error {
+	b.appending.Lock()
+	defer b.appending.Unlock()
+
+	b.m.Lock()
+	events := b.pending
+	b.pending = nil
+	b.m.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := b.store.Append(events...); err != nil {
+		b.m.Lock()
+		b.pending = append(events, b.pending...)
+		b.m.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// Run appends the pending events to the store in the given interval until
+// the context is done. A final flush is performed before returning.
+func (b *Bus) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				b.logger.Error(err, "error appending events to the store")
+			}
+		case <-ctx.Done():
+			if err := b.Flush(); err != nil {
+				b.logger.Error(err, "error appending events to the store on shutdown")
+			}
+
+			return
+		}
+	}
+}
+
+// Replay dispatches all events of the store to the handlers, e.g. to rebuild
+// the projections on startup.
+func (b *Bus) Replay() error {
+	if b.store == nil {
+		return nil
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.store.Replay(func(e Event) error {
+		b.dispatch(e)
+		return nil
+	})
+}
+
+func (b *Bus) dispatch(e Event) {
+	for _, h := range b.handlers {
+		h.Handle(e)
+	}
+}
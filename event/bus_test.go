@@ -0,0 +1,76 @@
+package event
+
+import (
+	"errors"
+	"hex-microservice/domain"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+// batchStore records the batches of the appends, it fails while err is set.
+type batchStore struct {
+	batches [][]Event
+	err     error
+}
+
+func (s *batchStore) Append(events ...Event) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.batches = append(s.batches, events)
+
+	return nil
+}
+
+func (s *batchStore) Replay(fn func(Event) error) error {
+	return nil
+}
+
+type handlerFn func(Event)
+
+func (fn handlerFn) Handle(e Event) { fn(e) }
+
+func TestBusFlushesBatches(t *testing.T) {
+	now := time.Now()
+	store := &batchStore{}
+
+	var handled []Event
+	b := NewBus(discardingLogger, store, handlerFn(func(e Event) { handled = append(handled, e) }))
+
+	b.Publish(Created(domain.Default, "a", "http://a.test", time.Time{}, now))
+	b.Publish(Visited(domain.Default, "a", now), Visited(domain.Default, "a", now))
+
+	// the handlers get the events immediately, the store by the flush
+	assert.Len(t, handled, 3)
+	assert.Empty(t, store.batches)
+
+	assert.NoError(t, b.Flush())
+	if assert.Len(t, store.batches, 1) && assert.Len(t, store.batches[0], 3) {
+		assert.Equal(t, RedirectCreated, store.batches[0][0].Type)
+	}
+
+	// the events are kept if the store fails
+	store.err = errors.New("failed")
+	b.Publish(Invalidated(domain.Default, "a", now))
+	assert.Error(t, b.Flush())
+
+	store.err = nil
+	b.Publish(Restored(domain.Default, "a", now))
+	assert.NoError(t, b.Flush())
+	if assert.Len(t, store.batches, 2) && assert.Len(t, store.batches[1], 2) {
+		assert.Equal(t, RedirectInvalidated, store.batches[1][0].Type)
+		assert.Equal(t, RedirectRestored, store.batches[1][1].Type)
+	}
+
+	// nothing is appended without pending events
+	assert.NoError(t, b.Flush())
+	assert.Len(t, store.batches, 2)
+}
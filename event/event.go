@@ -0,0 +1,128 @@
+// Package event offers the domain events of the redirects and the ports to
+// publish and persist them. It allows to simulate Command and Query
+// Responsibility Segregation (CQRS) with an internal event sourcing: the
+// services emit events and the read models are projections of the event log.
+package event
+
+import (
+	"hex-microservice/targeting"
+	"time"
+)
+
+// Type is the type of a domain event.
+type Type string
+
+// available domain events
+const (
+	RedirectCreated     Type = "RedirectCreated"
+	RedirectUpdated     Type = "RedirectUpdated"
+	RedirectInvalidated Type = "RedirectInvalidated"
+	RedirectRestored    Type = "RedirectRestored"
+	RedirectVisited     Type = "RedirectVisited"
+)
+
+// Event is a domain event of a redirect. The fields besides the type, the
+// domain, the code and the time of occurrence are specific for the type of
+// the event.
+type Event struct {
+	Type Type `json:"type"`
+	// Domain is the namespace of the code, empty for the default domain.
+	Domain     string    `json:"domain,omitempty"`
+	Code       string    `json:"code"`
+	OccurredAt time.Time `json:"occurred_at"`
+
+	URL       string    `json:"url,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// Password is the hash of the password of a protected redirect.
+	Password string `json:"password,omitempty"`
+	// MaxUses limits the number of redirects, zero is unlimited.
+	MaxUses int `json:"max_uses,omitempty"`
+	// NotBefore is the activation of a scheduled redirect.
+	NotBefore time.Time `json:"not_before,omitempty"`
+	// Rules are the conditional destinations of a redirect.
+	Rules targeting.Rules `json:"rules,omitempty"`
+	// Variants are the weighted destinations of an experiment.
+	Variants targeting.Variants `json:"variants,omitempty"`
+	// Variant is the number of the variant a visit was served with.
+	Variant int `json:"variant,omitempty"`
+	// Passthrough passes the path and the query of a request to the destination.
+	Passthrough bool `json:"passthrough,omitempty"`
+	// Preview shows the preview page instead of redirecting.
+	Preview bool `json:"preview,omitempty"`
+	// StatusCode is the status code of a redirect.
+	StatusCode int `json:"status_code,omitempty"`
+	// Owner is the id of the API key a redirect was created with.
+	Owner string `json:"owner,omitempty"`
+}
+
+// Publisher is the port the services emit the domain events to.
+type Publisher interface {
+	// Publish emits the events. Errors are handled by the implementation.
+	Publish(events ...Event)
+}
+
+// Handler consumes events, e.g. to build a projection.
+type Handler interface {
+	Handle(e Event)
+}
+
+// Store is the port of an append-only event store.
+type Store interface {
+	// Append adds the events to the end of the log.
+	Append(events ...Event) error
+	// Replay calls the function for every event in the order of the log.
+	Replay(fn func(Event) error) error
+}
+
+// Created returns the event of a created redirect.
+func Created(domain, code, url string, expiresAt, now time.Time) Event {
+	return Event{
+		Type:       RedirectCreated,
+		Domain:     domain,
+		Code:       code,
+		OccurredAt: now,
+		URL:        url,
+		ExpiresAt:  expiresAt,
+	}
+}
+
+// Updated returns the event of a redirect with a changed destination.
+func Updated(domain, code, url string, now time.Time) Event {
+	return Event{
+		Type:       RedirectUpdated,
+		Domain:     domain,
+		Code:       code,
+		OccurredAt: now,
+		URL:        url,
+	}
+}
+
+// Invalidated returns the event of an invalidated redirect.
+func Invalidated(domain, code string, now time.Time) Event {
+	return Event{
+		Type:       RedirectInvalidated,
+		Domain:     domain,
+		Code:       code,
+		OccurredAt: now,
+	}
+}
+
+// Restored returns the event of a reactivated redirect.
+func Restored(domain, code string, now time.Time) Event {
+	return Event{
+		Type:       RedirectRestored,
+		Domain:     domain,
+		Code:       code,
+		OccurredAt: now,
+	}
+}
+
+// Visited returns the event of a visited redirect.
+func Visited(domain, code string, now time.Time) Event {
+	return Event{
+		Type:       RedirectVisited,
+		Domain:     domain,
+		Code:       code,
+		OccurredAt: now,
+	}
+}
@@ -0,0 +1,5 @@
+// Package eventstore contains the implementations of the event store port.
+package eventstore
+
+// Close releases the resources of an event store.
+type Close func() error
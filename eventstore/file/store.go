@@ -0,0 +1,81 @@
+// Package file offers an event store that appends the events as JSON lines
+// to a file.
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hex-microservice/event"
+	"hex-microservice/eventstore"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const filePermissions = 0o600
+
+type fileStore struct {
+	file *os.File
+	m    sync.Mutex
+}
+
+// New creates a new event store backed by the file of the url
+// (e.g. file:///var/lib/shortener/events.jsonl).
+func New(_ context.Context, url string) (event.Store, eventstore.Close, error) {
+	path := strings.TrimPrefix(url, "file://")
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, filePermissions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening event store: %w", err)
+	}
+
+	return &fileStore{
+		file: file,
+	}, file.Close, nil
+}
+
+func (s *fileStore) Append(events ...event.Event) error {
+	var buf strings.Builder
+
+	encoder := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// a single write per append to keep the lines of an append together
+	_, err := io.WriteString(s.file, buf.String())
+
+	return err
+}
+
+func (s *fileStore) Replay(fn func(event.Event) error) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// the reads are independent of the appends (O_APPEND)
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(s.file)
+	for line := 1; scanner.Scan(); line++ {
+		var e event.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("error decoding event in line %d: %w", line, err)
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,46 @@
+package file
+
+import (
+	"context"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayAfterReopen(t *testing.T) {
+	path := "file://" + filepath.Join(t.TempDir(), "events.log")
+	now := time.Now().UTC()
+
+	store, close, err := New(context.Background(), path)
+	if assert.NoError(t, err) {
+		assert.NoError(t, store.Append(
+			event.Created(domain.Default, "a", "http://a.test", now.Add(time.Hour), now),
+			event.Visited(domain.Default, "a", now),
+		))
+		assert.NoError(t, store.Append(event.Invalidated(domain.Default, "a", now)))
+		assert.NoError(t, close())
+	}
+
+	store, close, err = New(context.Background(), path)
+	if assert.NoError(t, err) {
+		defer close()
+
+		var replayed []event.Event
+		assert.NoError(t, store.Replay(func(e event.Event) error {
+			replayed = append(replayed, e)
+			return nil
+		}))
+
+		if assert.Len(t, replayed, 3) {
+			assert.Equal(t, event.RedirectCreated, replayed[0].Type)
+			assert.Equal(t, "http://a.test", replayed[0].URL)
+			assert.True(t, now.Add(time.Hour).Equal(replayed[0].ExpiresAt))
+			assert.Equal(t, event.RedirectVisited, replayed[1].Type)
+			assert.Equal(t, event.RedirectInvalidated, replayed[2].Type)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Package memory offers a volatile event store, e.g. for testing.
+package memory
+
+import (
+	"context"
+	"hex-microservice/event"
+	"hex-microservice/eventstore"
+	"sync"
+)
+
+type memoryStore struct {
+	events []event.Event
+	m      sync.RWMutex
+}
+
+// New creates a new event store that keeps the events in memory.
+func New(_ context.Context, _ string) (event.Store, eventstore.Close, error) {
+	return &memoryStore{}, func() error { return nil }, nil
+}
+
+func (s *memoryStore) Append(events ...event.Event) error {
+	s.m.Lock()
+	s.events = append(s.events, events...)
+	s.m.Unlock()
+
+	return nil
+}
+
+func (s *memoryStore) Replay(fn func(event.Event) error) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	for _, e := range s.events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Package generator offers the strategies that generate the codes of the
+// redirects. Every strategy implements the adder.Generator port, own
+// strategies just need a method Generate() (string, error).
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"unicode/utf8"
+)
+
+// Base62 is the default alphabet of the generated codes.
+const Base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// ErrInvalidConfiguration signals that a generator can't be created with
+// the given parameters.
+var ErrInvalidConfiguration = errors.New("invalid generator configuration")
+
+// randomIndex returns a uniformly distributed random number in [0, n).
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(i.Int64()), nil
+}
+
+// validAlphabet reports if the alphabet has at least two distinct runes
+// and no duplicates.
+func validAlphabet(alphabet string) bool {
+	if !utf8.ValidString(alphabet) {
+		return false
+	}
+
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, r := range alphabet {
+		if _, ok := seen[r]; ok {
+			return false
+		}
+
+		seen[r] = struct{}{}
+	}
+
+	return len(seen) >= 2
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sequenceFn func() (uint64, error)
+
+func (fn sequenceFn) NextSequence() (uint64, error) { return fn() }
+
+func TestRandom(t *testing.T) {
+	const alphabet = "ab"
+
+	g, err := NewRandom(12, alphabet)
+	if assert.NoError(t, err) {
+		code, err := g.Generate()
+		if assert.NoError(t, err) {
+			assert.Len(t, code, 12)
+			assert.Empty(t, strings.Trim(code, alphabet))
+		}
+	}
+}
+
+func TestRandomInvalidConfiguration(t *testing.T) {
+	_, err := NewRandom(0, Base62)
+	assert.ErrorIs(t, err, ErrInvalidConfiguration)
+
+	_, err = NewRandom(7, "aa")
+	assert.ErrorIs(t, err, ErrInvalidConfiguration)
+}
+
+func TestSequentialIsUnique(t *testing.T) {
+	var counter uint64
+
+	g := NewSequential(sequenceFn(func() (uint64, error) {
+		return atomic.AddUint64(&counter, 1), nil
+	}), 42)
+
+	codes := make(map[string]struct{})
+	for i := 0; i < 10000; i++ {
+		code, err := g.Generate()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Len(t, code, sequentialLength)
+		codes[code] = struct{}{}
+	}
+
+	assert.Len(t, codes, 10000)
+}
+
+func TestSequentialExhausted(t *testing.T) {
+	g := NewSequential(sequenceFn(func() (uint64, error) {
+		return sequentialMask + 1, nil
+	}), 0)
+
+	_, err := g.Generate()
+	assert.ErrorIs(t, err, ErrSequenceExhausted)
+}
+
+func TestWords(t *testing.T) {
+	g, err := NewWords(3)
+	if assert.NoError(t, err) {
+		code, err := g.Generate()
+		if assert.NoError(t, err) {
+			assert.Len(t, strings.Split(code, "-"), 3)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Random generates codes of a fixed length with runes drawn uniformly
+// from an alphabet.
+type Random struct {
+	alphabet []rune
+	length   int
+}
+
+// NewRandom creates a new generator for random codes of the given length.
+// The Base62 alphabet is used if the alphabet is empty.
+func NewRandom(length int, alphabet string) (*Random, error) {
+	if alphabet == "" {
+		alphabet = Base62
+	}
+
+	if length < 1 {
+		return nil, fmt.Errorf("generator.Random length %d: %w", length, ErrInvalidConfiguration)
+	}
+
+	if !validAlphabet(alphabet) {
+		return nil, fmt.Errorf("generator.Random alphabet %q: %w", alphabet, ErrInvalidConfiguration)
+	}
+
+	return &Random{
+		alphabet: []rune(alphabet),
+		length:   length,
+	}, nil
+}
+
+// Generate returns a new code.
+func (g *Random) Generate() (string, error) {
+	var code strings.Builder
+
+	for i := 0; i < g.length; i++ {
+		n, err := randomIndex(len(g.alphabet))
+		if err != nil {
+			return "", err
+		}
+
+		code.WriteRune(g.alphabet[n])
+	}
+
+	return code.String(), nil
+}
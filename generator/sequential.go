@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// sequentialBits is the size of the domain the sequence is obfuscated in,
+	// 2^36 codes fit in 7 base62 runes.
+	sequentialBits   = 36
+	sequentialMask   = 1<<sequentialBits - 1
+	sequentialLength = 7
+	// sequentialMultiplier is odd and therefore invertible modulo 2^n.
+	sequentialMultiplier = 0x9E3779B97F4A7C15
+)
+
+// ErrSequenceExhausted signals that the sequence exceeds the codes the
+// sequential generator is able to produce.
+var ErrSequenceExhausted = errors.New("sequence exhausted")
+
+// Sequence is the port of a counter that never returns a value twice.
+type Sequence interface {
+	NextSequence() (uint64, error)
+}
+
+// Sequential generates codes from a counter. The value of the counter is
+// obfuscated to not reveal the number of redirects and the order of their
+// creation.
+type Sequential struct {
+	sequence Sequence
+	key      uint64
+}
+
+// NewSequential creates a new generator that derives the codes from the
+// sequence. The key parameterizes the obfuscation and must not change once
+// codes are generated.
+func NewSequential(s Sequence, key uint64) *Sequential {
+	return &Sequential{
+		sequence: s,
+		key:      key & sequentialMask,
+	}
+}
+
+// obfuscate maps the value bijectively to another value of the domain.
+func (g *Sequential) obfuscate(n uint64) uint64 {
+	return (n*sequentialMultiplier)&sequentialMask ^ g.key
+}
+
+// Generate returns a new code.
+func (g *Sequential) Generate() (string, error) {
+	n, err := g.sequence.NextSequence()
+	if err != nil {
+		return "", err
+	}
+
+	if n > sequentialMask {
+		return "", fmt.Errorf("generator.Sequential %d: %w", n, ErrSequenceExhausted)
+	}
+
+	n = g.obfuscate(n)
+
+	// fixed length base62, the leading digits are zeros
+	code := make([]byte, sequentialLength)
+	for i := sequentialLength - 1; i >= 0; i-- {
+		code[i] = Base62[n%62]
+		n /= 62
+	}
+
+	return string(code), nil
+}
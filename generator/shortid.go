@@ -0,0 +1,16 @@
+package generator
+
+import "github.com/teris-io/shortid"
+
+// ShortID generates the codes with the shortid library.
+type ShortID struct{}
+
+// NewShortID creates a new generator that uses the shortid library.
+func NewShortID() *ShortID {
+	return &ShortID{}
+}
+
+// Generate returns a new code.
+func (ShortID) Generate() (string, error) {
+	return shortid.Generate()
+}
@@ -0,0 +1,68 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// adjectives and nouns are short and unambiguous to be read out loud.
+var (
+	adjectives = []string{
+		"able", "acid", "aged", "airy", "bold", "brave", "brief", "bright",
+		"calm", "cheap", "clean", "clear", "cool", "crisp", "cute", "dark",
+		"deep", "dry", "eager", "early", "easy", "fair", "fast", "fine",
+		"firm", "fresh", "glad", "gold", "grand", "green", "happy", "hard",
+		"high", "jolly", "keen", "kind", "large", "late", "lazy", "light",
+		"live", "loud", "lucky", "mild", "neat", "new", "noble", "odd",
+		"plain", "proud", "quick", "quiet", "rapid", "rare", "red", "rich",
+		"safe", "sharp", "shy", "silly", "slow", "soft", "swift", "warm",
+	}
+	nouns = []string{
+		"apple", "arrow", "badger", "bay", "bear", "bee", "bird", "boat",
+		"brook", "cabin", "cake", "cat", "cloud", "coast", "comet", "crab",
+		"deer", "dove", "dune", "eagle", "field", "fish", "flame", "fox",
+		"frog", "garden", "goat", "hill", "horse", "island", "lake", "leaf",
+		"lion", "maple", "meadow", "moon", "moose", "mouse", "ocean", "otter",
+		"owl", "panda", "pearl", "pine", "planet", "pond", "rabbit", "river",
+		"robin", "rock", "seal", "shark", "sky", "snow", "star", "stone",
+		"storm", "sun", "tiger", "tree", "valley", "whale", "wolf", "zebra",
+	}
+)
+
+// Words generates human-readable codes of words joined by a hyphen, e.g.
+// "brave-green-otter". All words but the last one are adjectives.
+type Words struct {
+	count int
+}
+
+// NewWords creates a new generator for codes of the given number of words.
+func NewWords(count int) (*Words, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("generator.Words count %d: %w", count, ErrInvalidConfiguration)
+	}
+
+	return &Words{
+		count: count,
+	}, nil
+}
+
+// Generate returns a new code.
+func (g *Words) Generate() (string, error) {
+	words := make([]string, g.count)
+
+	for i := range words {
+		list := adjectives
+		if i == g.count-1 {
+			list = nouns
+		}
+
+		n, err := randomIndex(len(list))
+		if err != nil {
+			return "", err
+		}
+
+		words[i] = list[n]
+	}
+
+	return strings.Join(words, "-"), nil
+}
@@ -0,0 +1,84 @@
+// Package hashed offers the salted hashes of the management tokens and the
+// passwords, so that the repositories never hold a secret that grants access
+// to a redirect.
+package hashed
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Prefix marks a hashed token, a stored token without it is a plaintext
+// token of a former version.
+const Prefix = "sha256$"
+
+const (
+	separator = "$"
+	saltSize  = 16
+)
+
+// Token returns the salted hash of the plaintext token.
+func Token(plain string) (string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("hashed.Token salt: %w", err)
+	}
+
+	return Prefix + hex.EncodeToString(salt) + separator + digest(salt, plain), nil
+}
+
+// IsHashed reports whether the stored token is hashed.
+func IsHashed(stored string) bool {
+	return strings.HasPrefix(stored, Prefix)
+}
+
+// Verify reports in constant time whether the plaintext token matches the
+// stored token. A stored plaintext token is compared as it is.
+func Verify(stored, plain string) bool {
+	if !IsHashed(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1
+	}
+
+	encodedSalt, sum, ok := strings.Cut(strings.TrimPrefix(stored, Prefix), separator)
+	if !ok {
+		return false
+	}
+
+	salt, err := hex.DecodeString(encodedSalt)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(sum), []byte(digest(salt, plain))) == 1
+}
+
+// Password returns the hash of the password. Unlike the random tokens, the
+// passwords are chosen by humans and are therefore hashed with bcrypt.
+func Password(plain string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hashed.Password: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// VerifyPassword reports whether the password matches the stored hash.
+func VerifyPassword(stored, plain string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)) == nil
+}
+
+// digest returns the hex encoded hash of the salt and the token.
+func digest(salt []byte, plain string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(plain))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
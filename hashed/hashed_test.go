@@ -0,0 +1,50 @@
+package hashed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	const plain = "0123456789abcdef0123456789abcdef"
+
+	first, err := Token(plain)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	second, err := Token(plain)
+	if assert.NoError(t, err) {
+		// the salt differs
+		assert.NotEqual(t, first, second)
+	}
+
+	assert.True(t, IsHashed(first))
+	assert.NotContains(t, first, plain)
+	assert.True(t, Verify(first, plain))
+	assert.True(t, Verify(second, plain))
+	assert.False(t, Verify(first, plain+"x"))
+	assert.False(t, Verify(first, ""))
+}
+
+func TestVerifyPlaintext(t *testing.T) {
+	assert.False(t, IsHashed("token"))
+	assert.True(t, Verify("token", "token"))
+	assert.False(t, Verify("token", "other"))
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	assert.False(t, Verify("sha256$", "token"))
+	assert.False(t, Verify("sha256$zz$00", "token"))
+}
+
+func TestPassword(t *testing.T) {
+	stored, err := Password("secret")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, stored, "secret")
+		assert.True(t, VerifyPassword(stored, "secret"))
+		assert.False(t, VerifyPassword(stored, "Secret"))
+		assert.False(t, VerifyPassword("", "secret"))
+	}
+}
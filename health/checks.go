@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// ErrShuttingDown signals that the service doesn't accept new requests.
+	ErrShuttingDown = errors.New("shutting down")
+
+	// errUnsupported signals a platform without the statistics of the file system.
+	errUnsupported = errors.New("unsupported")
+)
+
+// Shutdown tracks whether the shutdown of the service is in progress.
+type Shutdown struct {
+	begun int32
+}
+
+// Begin marks the shutdown as in progress.
+func (s *Shutdown) Begin() {
+	atomic.StoreInt32(&s.begun, 1)
+}
+
+// Probe fails once the shutdown has begun, so that no new requests are
+// routed to the service.
+func (s *Shutdown) Probe(context.Context) error {
+	if atomic.LoadInt32(&s.begun) == 1 {
+		return ErrShuttingDown
+	}
+
+	return nil
+}
+
+// DiskSpace returns a probe of the free space of the file system of the
+// path. Less than min bytes degrade the service, a path that can't be read
+// fails the probe.
+func DiskSpace(path string, min uint64) func(context.Context) error {
+	return func(context.Context) error {
+		free, err := freeBytes(path)
+		if err != nil {
+			if errors.Is(err, errUnsupported) {
+				return nil
+			}
+
+			return fmt.Errorf("health.DiskSpace %s: %w", path, err)
+		}
+
+		if free < min {
+			return fmt.Errorf("health.DiskSpace %s: %d bytes free: %w", path, free, ErrDegraded)
+		}
+
+		return nil
+	}
+}
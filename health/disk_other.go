@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package health
+
+// freeBytes isn't supported on this platform, the disk space isn't checked.
+func freeBytes(string) (uint64, error) {
+	return 0, errUnsupported
+}
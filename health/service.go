@@ -1,11 +1,50 @@
 package health
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
-type service struct {
-	name        string
-	version     string
-	startupTime time.Time
+// DefaultTimeout is the time a check may take unless it chooses its own.
+const DefaultTimeout = 2 * time.Second
+
+// ErrDegraded signals a check that still serves but needs attention, e.g. a
+// disk that runs out of space. Other errors fail the check.
+var ErrDegraded = errors.New("degraded")
+
+// ErrTimeout signals a check that didn't finish in time.
+var ErrTimeout = errors.New("timeout")
+
+// Status is the status of a check, the statuses are ordered from the best to
+// the worst.
+type Status int
+
+const (
+	StatusUp Status = iota
+	StatusDegraded
+	StatusDown
+)
+
+// String returns the string representation of the status.
+func (s Status) String() string {
+	switch s {
+	case StatusUp:
+		return "up"
+	case StatusDegraded:
+		return "degraded"
+	default:
+		return "down"
+	}
+}
+
+// Check is a probe of a dependency the readiness depends on.
+type Check struct {
+	Name string
+	// Timeout is the time the probe may take, zero is the DefaultTimeout.
+	Timeout time.Duration
+	// Probe returns nil if the dependency is up, see ErrDegraded.
+	Probe func(ctx context.Context) error
 }
 
 type HealthResult struct {
@@ -14,15 +53,42 @@ type HealthResult struct {
 	Uptime  time.Duration
 }
 
+// CheckResult is the result of a check.
+type CheckResult struct {
+	Name     string
+	Status   Status
+	Duration time.Duration
+	// Err is the error of a check that isn't up.
+	Err error
+}
+
+// ReadinessResult holds the results of the checks in their order, its
+// status is the worst status of the checks.
+type ReadinessResult struct {
+	Status Status
+	Checks []CheckResult
+}
+
 type Service interface {
+	// Health returns the liveness of the service.
 	Health(now time.Time) HealthResult
+	// Ready runs the checks in parallel and returns their results.
+	Ready(ctx context.Context) ReadinessResult
+}
+
+type service struct {
+	name        string
+	version     string
+	startupTime time.Time
+	checks      []Check
 }
 
-func New(name, version string, startupTime time.Time) Service {
+func New(name, version string, startupTime time.Time, checks ...Check) Service {
 	return &service{
 		name:        name,
 		version:     version,
 		startupTime: startupTime,
+		checks:      checks,
 	}
 }
 
@@ -33,3 +99,71 @@ func (s *service) Health(now time.Time) HealthResult {
 		Uptime:  now.Sub(s.startupTime).Round(time.Second),
 	}
 }
+
+func (s *service) Ready(ctx context.Context) ReadinessResult {
+	results := make([]chan CheckResult, len(s.checks))
+	for i, check := range s.checks {
+		results[i] = make(chan CheckResult, 1)
+		go func(check Check, result chan<- CheckResult) {
+			result <- run(ctx, check)
+		}(check, results[i])
+	}
+
+	readiness := ReadinessResult{
+		Status: StatusUp,
+		Checks: make([]CheckResult, len(s.checks)),
+	}
+
+	for i, result := range results {
+		readiness.Checks[i] = <-result
+		if readiness.Checks[i].Status > readiness.Status {
+			readiness.Status = readiness.Checks[i].Status
+		}
+	}
+
+	return readiness
+}
+
+// run runs the probe of the check, a probe that exceeds its timeout is
+// abandoned and fails the check.
+func run(parent context.Context, check Check) CheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// buffered, so that an abandoned probe doesn't leak
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Probe(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	result := CheckResult{
+		Name:     check.Name,
+		Status:   StatusUp,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrDegraded):
+		result.Status = StatusDegraded
+	default:
+		result.Status = StatusDown
+	}
+
+	return result
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(err error) func(context.Context) error {
+	return func(context.Context) error { return err }
+}
+
+func TestReadyWorstStatusWins(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		probes   []error
+		expected Status
+	}{
+		{name: "no checks", expected: StatusUp},
+		{name: "up", probes: []error{nil, nil}, expected: StatusUp},
+		{name: "degraded", probes: []error{nil, ErrDegraded}, expected: StatusDegraded},
+		{name: "down", probes: []error{errors.New("down"), fmt.Errorf("low: %w", ErrDegraded)}, expected: StatusDown},
+	} {
+		var checks []Check
+		for _, err := range tt.probes {
+			checks = append(checks, Check{Name: tt.name, Probe: probe(err)})
+		}
+
+		readiness := New("name", "version", time.Now(), checks...).Ready(context.Background())
+		assert.Equal(t, tt.expected, readiness.Status, tt.name)
+		assert.Len(t, readiness.Checks, len(tt.probes), tt.name)
+	}
+}
+
+func TestReadyRunsChecksInParallelWithTimeouts(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	}
+
+	s := New("name", "version", time.Now(),
+		Check{Name: "first", Probe: slow},
+		Check{Name: "second", Probe: slow},
+		Check{Name: "hanging", Timeout: 50 * time.Millisecond, Probe: func(context.Context) error {
+			select {}
+		}},
+	)
+
+	start := time.Now()
+	readiness := s.Ready(context.Background())
+
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+	if assert.Len(t, readiness.Checks, 3) {
+		assert.Equal(t, "first", readiness.Checks[0].Name)
+		assert.Equal(t, StatusUp, readiness.Checks[0].Status)
+		assert.Equal(t, StatusDown, readiness.Checks[2].Status)
+		assert.True(t, errors.Is(readiness.Checks[2].Err, ErrTimeout))
+	}
+	assert.Equal(t, StatusDown, readiness.Status)
+}
+
+func TestShutdown(t *testing.T) {
+	var shutdown Shutdown
+	assert.NoError(t, shutdown.Probe(context.Background()))
+
+	shutdown.Begin()
+	assert.True(t, errors.Is(shutdown.Probe(context.Background()), ErrShuttingDown))
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, DiskSpace(dir, 0)(context.Background()))
+	assert.True(t, errors.Is(DiskSpace(dir, math.MaxUint64)(context.Background()), ErrDegraded))
+	assert.Error(t, DiskSpace(filepath.Join(dir, "missing"), 0)(context.Background()))
+}
@@ -0,0 +1,122 @@
+// Package clientip offers the identity of a client by its ip address, it's
+// shared by the handlers and the middlewares.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const headerFieldForwardedFor = "X-Forwarded-For"
+
+// contextKey is the key of the ip address in the context of a request.
+type contextKey struct{}
+
+// Resolver resolves the ip address of the client of a request. The
+// X-Forwarded-For header is set by the client itself unless a trusted proxy
+// overwrites it, therefore it's only followed through the trusted proxies.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New creates a resolver that trusts the proxies, given as ip addresses or
+// prefixes in CIDR notation. Without proxies only the address of the direct
+// connection is used.
+func New(proxies ...string) (Resolver, error) {
+	var res Resolver
+
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return res, fmt.Errorf("clientip.New proxy %s: %w", proxy, err)
+			}
+
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		res.trusted = append(res.trusted, prefix.Masked())
+	}
+
+	return res, nil
+}
+
+// IP returns the requestor's ip address (either V4 or V6). A proxy appends
+// the address of its client to the X-Forwarded-For header, the header is read
+// from the right to the first address that isn't a trusted proxy. The port of
+// a direct connection is dropped, so that the connections of a client share
+// its identity.
+func (res Resolver) IP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !res.isTrusted(ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get(headerFieldForwardedFor), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		ip = hop
+		if !res.isTrusted(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// isTrusted reports whether the ip address is one of a trusted proxy.
+func (res Resolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewContext returns a context that carries the resolved ip address of the
+// client.
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// IP returns the ip address of the client that was resolved into the context
+// of the request, see NewContext. Otherwise it's the address of the direct
+// connection.
+func IP(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKey{}).(string); ok {
+		return ip
+	}
+
+	return remoteIP(r)
+}
+
+// remoteIP returns the ip address of the direct connection without its port.
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
@@ -0,0 +1,56 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolverIP(t *testing.T) {
+	res, err := New("192.0.2.1", "10.0.0.0/8", " ")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, tt := range []struct {
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{remoteAddr: "192.0.2.1:1234", expected: "192.0.2.1"},
+		{remoteAddr: "[2001:db8::1]:1234", expected: "2001:db8::1"},
+		{remoteAddr: "198.51.100.1", expected: "198.51.100.1"},
+		{remoteAddr: "192.0.2.1:1234", forwarded: "198.51.100.7", expected: "198.51.100.7"},
+		// the right-most address that isn't a trusted proxy is the client
+		{remoteAddr: "192.0.2.1:1234", forwarded: " 203.0.113.9 , 198.51.100.7, 10.1.2.3", expected: "198.51.100.7"},
+		// an untrusted connection can't choose its address
+		{remoteAddr: "198.51.100.1:1234", forwarded: "203.0.113.9", expected: "198.51.100.1"},
+		// a chain of trusted proxies only is followed to its start
+		{remoteAddr: "192.0.2.1:1234", forwarded: "10.0.0.1, 10.0.0.2", expected: "10.0.0.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			r.Header.Set(headerFieldForwardedFor, tt.forwarded)
+		}
+
+		assert.Equal(t, tt.expected, res.IP(r), tt)
+	}
+}
+
+func TestNewInvalidProxy(t *testing.T) {
+	_, err := New("proxy.example")
+	assert.Error(t, err)
+}
+
+func TestIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set(headerFieldForwardedFor, "198.51.100.7")
+
+	// the header isn't trusted without a resolver
+	assert.Equal(t, "192.0.2.1", IP(r))
+	assert.Equal(t, "203.0.113.9", IP(r.WithContext(NewContext(r.Context(), "203.0.113.9"))))
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"errors"
+	"hex-microservice/apikey"
+	"hex-microservice/http/clientip"
+	"hex-microservice/ratelimit"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	headerFieldAuthorization  = "Authorization"
+	headerFieldAuthenticate   = "WWW-Authenticate"
+	authorizationSchemeBearer = "Bearer"
+	authenticateInvalidToken  = authorizationSchemeBearer + ` error="invalid_token"`
+)
+
+// Authenticate authenticates the API key of the bearer token and passes it in
+// the context of the request, see apikey.FromContext. A request with an
+// invalid token is rejected, a request without a token only if the anonymous
+// requests aren't allowed.
+// The invalid tokens are limited per ip address by the failures limiter, nil
+// disables the limit. A token is taken before the authentication, so that
+// parallel guesses can't pass the limit, and refunded for a valid key.
+func Authenticate(log logr.Logger, keys apikey.Service, anonymous bool, failures *ratelimit.Limiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				if !anonymous {
+					unauthorized(w, authorizationSchemeBearer)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := clientPrefixIP + clientip.IP(r)
+			if failures != nil {
+				if result := failures.Allow(client, time.Now()); !result.Allowed {
+					w.Header().Set(headerFieldRetryAfter, seconds(result.RetryAfter))
+					http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+					return
+				}
+			}
+
+			key, err := keys.Authenticate(token)
+			if err != nil {
+				if errors.Is(err, apikey.ErrUnauthorized) {
+					unauthorized(w, authenticateInvalidToken)
+					return
+				}
+
+				if failures != nil {
+					failures.Refund(client)
+				}
+
+				log.Error(err, "authenticating api key")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if failures != nil {
+				failures.Refund(client)
+			}
+
+			next.ServeHTTP(w, r.WithContext(apikey.NewContext(r.Context(), key)))
+		})
+	}
+}
+
+// bearerToken returns the token of the Authorization header, false if the
+// request carries none.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get(headerFieldAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, authorizationSchemeBearer) {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// unauthorized answers the request with 401 and the challenge.
+func unauthorized(w http.ResponseWriter, challenge string) {
+	w.Header().Set(headerFieldAuthenticate, challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
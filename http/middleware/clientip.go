@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"hex-microservice/http/clientip"
+	"net/http"
+)
+
+// ClientIP resolves the ip address of the client and passes it in the context
+// of the request, see clientip.IP.
+func ClientIP(resolver clientip.Resolver) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(clientip.NewContext(r.Context(), resolver.IP(r))))
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// Package middleware offers the router agnostic decorators of the handlers,
+// they apply equally to all router implementations.
+package middleware
+
+import "net/http"
+
+// Middleware decorates a handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain returns a middleware that applies the middlewares in their order,
+// the first one is the outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+
+		return next
+	}
+}
+
+// HandlerFunc applies the middleware to a handler function.
+func (m Middleware) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return m(next).ServeHTTP
+}
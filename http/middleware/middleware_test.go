@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"hex-microservice/apikey"
+	"hex-microservice/http/clientip"
+	"hex-microservice/ratelimit"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+func TestChain(t *testing.T) {
+	var order []string
+
+	named := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := Chain(named("outer"), named("inner")).HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, []string{"outer", "inner", "handler"}, order)
+}
+
+// singleKey authenticates only the token "id.secret".
+type singleKey struct {
+	apikey.Service
+}
+
+func (singleKey) Authenticate(token string) (apikey.Key, error) {
+	if token != "id.secret" {
+		return apikey.Key{}, apikey.ErrUnauthorized
+	}
+
+	return apikey.Key{ID: "id"}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		anonymous     bool
+		authorization string
+		status        int
+		owner         string
+	}{
+		{name: "anonymous allowed", anonymous: true, status: http.StatusOK},
+		{name: "anonymous denied", status: http.StatusUnauthorized},
+		{name: "other scheme", authorization: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized},
+		{name: "invalid token", anonymous: true, authorization: "Bearer id.wrong", status: http.StatusUnauthorized},
+		{name: "valid token", authorization: "bearer  id.secret", status: http.StatusOK, owner: "id"},
+	} {
+		var owner string
+		handler := Authenticate(discardingLogger, singleKey{}, tt.anonymous, nil)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			if key, ok := apikey.FromContext(r.Context()); ok {
+				owner = key.ID
+			}
+		}))
+
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		if tt.authorization != "" {
+			request.Header.Set(headerFieldAuthorization, tt.authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		assert.Equal(t, tt.status, recorder.Code, tt.name)
+		assert.Equal(t, tt.owner, owner, tt.name)
+
+		if tt.status == http.StatusUnauthorized {
+			assert.True(t, strings.HasPrefix(recorder.Header().Get(headerFieldAuthenticate), authorizationSchemeBearer), tt.name)
+		}
+	}
+}
+
+func TestAuthenticateLimitsFailures(t *testing.T) {
+	handler := Authenticate(discardingLogger, singleKey{}, false, ratelimit.New(discardingLogger, 2, time.Minute))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func(remoteAddr, token string) int {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		request.RemoteAddr = remoteAddr
+		request.Header.Set(headerFieldAuthorization, "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder.Code
+	}
+
+	// the valid keys don't count
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve("192.0.2.1:1000", "id.secret"))
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("192.0.2.1:1000", "id.wrong"))
+	assert.Equal(t, http.StatusUnauthorized, serve("192.0.2.1:1000", "id.guess"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("192.0.2.1:1000", "id.secret"))
+
+	// the failures are limited per client
+	assert.Equal(t, http.StatusOK, serve("192.0.2.2:1000", "id.secret"))
+}
+
+func TestRateLimit(t *testing.T) {
+	handler := RateLimit(ratelimit.New(discardingLogger, 1, time.Minute))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func(remoteAddr string, key *apikey.Key) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = remoteAddr
+		if key != nil {
+			request = request.WithContext(apikey.NewContext(request.Context(), *key))
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	allowed := serve("192.0.2.1:1000", nil)
+	assert.Equal(t, http.StatusOK, allowed.Code)
+	assert.Equal(t, "1", allowed.Header().Get(headerFieldRateLimitLimit))
+	assert.Equal(t, "0", allowed.Header().Get(headerFieldRateLimitRemaining))
+
+	// the connections of a client share its bucket
+	denied := serve("192.0.2.1:2000", nil)
+	assert.Equal(t, http.StatusTooManyRequests, denied.Code)
+	assert.Equal(t, "60", denied.Header().Get(headerFieldRetryAfter))
+
+	// an API key is limited independently of its address
+	assert.Equal(t, http.StatusOK, serve("192.0.2.1:3000", &apikey.Key{ID: "id"}).Code)
+	assert.Equal(t, http.StatusOK, serve("192.0.2.2:1000", nil).Code)
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	proxies, err := clientip.New("192.0.2.1")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handler := Chain(
+		ClientIP(proxies),
+		RateLimit(ratelimit.New(discardingLogger, 1, time.Minute)),
+	)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func(remoteAddr, forwarded string) int {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = remoteAddr
+		request.Header.Set("X-Forwarded-For", forwarded)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder.Code
+	}
+
+	// a client can't escape its bucket by a forged address
+	assert.Equal(t, http.StatusOK, serve("198.51.100.1:1000", "203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("198.51.100.1:1000", "203.0.113.2"))
+
+	// the clients behind the trusted proxy have their own buckets
+	assert.Equal(t, http.StatusOK, serve("192.0.2.1:1000", "203.0.113.1, 203.0.113.3"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("192.0.2.1:1000", "203.0.113.2, 203.0.113.3"))
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"hex-microservice/apikey"
+	"hex-microservice/http/clientip"
+	"hex-microservice/ratelimit"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	headerFieldRateLimitLimit     = "RateLimit-Limit"
+	headerFieldRateLimitRemaining = "RateLimit-Remaining"
+	headerFieldRateLimitReset     = "RateLimit-Reset"
+	headerFieldRetryAfter         = "Retry-After"
+
+	// the prefixes keep the API keys and the ip addresses apart
+	clientPrefixKey = "key:"
+	clientPrefixIP  = "ip:"
+)
+
+// chargeKey is the context key of the bucket of the client, see Charge.
+type chargeKey struct{}
+
+// charge is the bucket of the client of a request.
+type charge struct {
+	limiter *ratelimit.Limiter
+	client  string
+}
+
+// RateLimit limits the requests of a client, a client is identified by its
+// API key (see Authenticate) or otherwise by its ip address. The state of its
+// bucket is passed in the RateLimit headers, a denied request is answered
+// with 429 and the Retry-After header. The handlers charge the further tokens
+// of a request that stands for several, see Charge.
+func RateLimit(limiter *ratelimit.Limiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := charge{limiter: limiter, client: client(r)}
+			if !c.take(w, 1) {
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chargeKey{}, c)))
+		})
+	}
+}
+
+// Charge takes the tokens of a request that stands for n, e.g. a batch of n
+// items, from the bucket of the client instead of the single token the
+// request took. A denied charge takes none and is answered like a denied
+// request, or with 413 if the tokens exceed the limit, and returns false. A
+// request without a rate limit is never charged.
+func Charge(w http.ResponseWriter, r *http.Request, n int) bool {
+	c, ok := r.Context().Value(chargeKey{}).(charge)
+	if !ok || n <= 1 {
+		return true
+	}
+
+	c.limiter.Refund(c.client)
+
+	return c.take(w, n)
+}
+
+// take takes n tokens from the bucket and passes its state in the RateLimit
+// headers, it answers the request if they are denied.
+func (c charge) take(w http.ResponseWriter, n int) bool {
+	result := c.limiter.AllowN(c.client, n, time.Now())
+
+	w.Header().Set(headerFieldRateLimitLimit, strconv.Itoa(result.Limit))
+	w.Header().Set(headerFieldRateLimitRemaining, strconv.Itoa(result.Remaining))
+	w.Header().Set(headerFieldRateLimitReset, seconds(result.Reset))
+
+	switch {
+	case result.Allowed:
+		return true
+	case n > result.Limit:
+		// the tokens are never refilled that far
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	default:
+		w.Header().Set(headerFieldRetryAfter, seconds(result.RetryAfter))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	}
+
+	return false
+}
+
+// client returns the identity of the client the request is limited by.
+func client(r *http.Request) string {
+	if key, ok := apikey.FromContext(r.Context()); ok {
+		return clientPrefixKey + key.ID
+	}
+
+	return clientPrefixIP + clientip.IP(r)
+}
+
+// seconds returns the whole seconds of the duration.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(d / time.Second))
+}
@@ -0,0 +1,68 @@
+// Package page offers the html pages the REST adapters serve to browsers.
+package page
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// FieldPassword is the name of the form field of the password.
+const FieldPassword = "password"
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var (
+	passwordTemplate = template.Must(template.ParseFS(templates, "templates/password.html"))
+	// previewTemplate is the embedded template unless a deployment overrides
+	// it, see OverridePreview.
+	previewTemplate = template.Must(template.ParseFS(templates, "templates/preview.html"))
+)
+
+// Password is the data of the page that asks for the password of a
+// protected redirect.
+type Password struct {
+	// Action is the url the form is posted to.
+	Action string
+	// Wrong signals that a wrong password was posted before.
+	Wrong bool
+}
+
+// WritePassword writes the page that asks for the password.
+func WritePassword(w io.Writer, p Password) error {
+	return passwordTemplate.Execute(w, struct {
+		Password
+		Field string
+	}{p, FieldPassword})
+}
+
+// Preview is the data of the page that shows the destination of a redirect
+// instead of redirecting.
+type Preview struct {
+	Code      string
+	URL       string
+	CreatedAt time.Time
+	// Continue is the url the visitor continues to.
+	Continue string
+}
+
+// WritePreview writes the page that previews the redirect.
+func WritePreview(w io.Writer, p Preview) error {
+	return previewTemplate.Execute(w, p)
+}
+
+// OverridePreview replaces the embedded template of the preview page by the
+// template file of a deployment, it's called before the pages are served.
+func OverridePreview(filename string) error {
+	t, err := template.ParseFiles(filename)
+	if err != nil {
+		return fmt.Errorf("page.OverridePreview: %w", err)
+	}
+
+	previewTemplate = t
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package ginimp
+
+import (
+	"errors"
+	"fmt"
+	"hex-microservice/adder"
+	"hex-microservice/http/clientip"
+	"hex-microservice/http/middleware"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// batchItemError is the error of a single redirect of a batch.
+type batchItemError struct {
+	StatusCode int    `json:"status" msgpack:"status"`
+	Title      string `json:"title" msgpack:"title"`
+}
+
+// batchItemResponse is the result of a single redirect of a batch that is returned to the client.
+type batchItemResponse struct {
+	Code        string     `json:"code,omitempty" msgpack:"code,omitempty"`
+	URL         string     `json:"url" msgpack:"url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" msgpack:"expires_at,omitempty"`
+	MaxUses     int        `json:"max_uses,omitempty" msgpack:"max_uses,omitempty"`
+	NotBefore   *time.Time `json:"not_before,omitempty" msgpack:"not_before,omitempty"`
+	Passthrough bool       `json:"passthrough,omitempty" msgpack:"passthrough,omitempty"`
+	Preview     bool       `json:"preview,omitempty" msgpack:"preview,omitempty"`
+	StatusCode  int        `json:"status_code,omitempty" msgpack:"status_code,omitempty"`
+
+	Links []link          `json:"_links,omitempty" msgpack:"_links,omitempty"`
+	Error *batchItemError `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// addError maps the error of a single redirect to the error for the client, the
+// errors the adder doesn't signal are answered with the fallback status.
+func addError(err error, r redirectPostRequest, fallback int) *batchItemError {
+	switch {
+	case errors.Is(err, adder.ErrDuplicate) && r.CustomCode != "":
+		return &batchItemError{StatusCode: http.StatusConflict, Title: fmt.Sprintf(customCodeAlreadyTaken, r.CustomCode)}
+	case errors.Is(err, adder.ErrCollision):
+		return &batchItemError{StatusCode: http.StatusServiceUnavailable, Title: titleCodeCollision}
+	case errors.Is(err, adder.ErrRedirectInvalid):
+		return &batchItemError{StatusCode: http.StatusBadRequest, Title: titleRedirectInvalid}
+	case errors.Is(err, adder.ErrPolicyViolation):
+		return &batchItemError{StatusCode: http.StatusUnprocessableEntity, Title: titlePolicyViolation}
+	case errors.Is(err, adder.ErrBatchAborted):
+		return &batchItemError{StatusCode: http.StatusFailedDependency, Title: titleBatchAborted}
+	default:
+		return &batchItemError{StatusCode: fallback, Title: http.StatusText(fallback)}
+	}
+}
+
+// RedirectBatch implements the "post" verb of the REST context that creates a batch of redirects.
+// Each redirect is created independently unless the all-or-nothing semantic is requested by the
+// query parameter "atomic".
+func (h *handler) RedirectBatch(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, mappingUrl := h.resolveDomain(c, mappingUrl)
+
+		converter, ok := h.converters[c.ContentType()]
+		if !ok {
+			h.log.Error(nil, "unsupported content type", "contentType", c.ContentType())
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": http.StatusText(http.StatusUnsupportedMediaType)})
+			return
+		}
+
+		atomic := false
+		if a := c.Query(UrlQueryAtomic); a != "" {
+			var err error
+			if atomic, err = strconv.ParseBool(a); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlQueryAtomic)})
+				return
+			}
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBodySize)
+		body, err := c.GetRawData()
+		if err != nil {
+			// the reader stops at the limit
+			if len(body) == maxBatchBodySize {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": titleBodyTooLarge})
+				return
+			}
+
+			c.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+			return
+		}
+
+		var reds []redirectPostRequest
+		if err := converter.unmarshal(body, &reds); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "field validation failed"})
+			return
+		}
+
+		if len(reds) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": titleEmptyBatch})
+			return
+		}
+
+		// every item counts against the rate limit of the client
+		if !middleware.Charge(c.Writer, c.Request, len(reds)) {
+			return
+		}
+
+		// validate, the indices map the commands back to the requests
+		asResponse := make([]batchItemResponse, len(reds))
+		commands := make([]adder.RedirectCommand, 0, len(reds))
+		indices := make([]int, 0, len(reds))
+		invalid := false
+
+		for i, r := range reds {
+			asResponse[i].URL = r.URL
+
+			if err := binding.Validator.ValidateStruct(r); err != nil {
+				asResponse[i].Error = &batchItemError{StatusCode: http.StatusBadRequest, Title: "field validation failed"}
+				invalid = true
+				continue
+			}
+
+			commands = append(commands, r.command(d, owner(c.Request), clientip.IP(c.Request)))
+			indices = append(indices, i)
+		}
+
+		// store
+		var results []adder.RedirectResult
+		switch {
+		case atomic && invalid:
+			results = make([]adder.RedirectResult, len(commands))
+			for i := range results {
+				results[i].Err = adder.ErrBatchAborted
+			}
+		case atomic:
+			results, _ = h.adder.Add(commands...)
+		default:
+			results = h.adder.AddEach(commands...)
+		}
+
+		created := 0
+		for i, result := range results {
+			index := indices[i]
+
+			if result.Err != nil {
+				if !errors.Is(result.Err, adder.ErrBatchAborted) {
+					h.log.Error(result.Err, "error adding request", "request", reds[index])
+				}
+
+				asResponse[index].Error = addError(result.Err, reds[index], http.StatusInternalServerError)
+				continue
+			}
+
+			created++
+			asResponse[index] = batchItemResponse{
+				Code:        result.Code,
+				URL:         result.URL,
+				ExpiresAt:   optionalTime(result.ExpiresAt),
+				MaxUses:     result.MaxUses,
+				NotBefore:   optionalTime(result.NotBefore),
+				Passthrough: result.Passthrough,
+				Preview:     result.Preview,
+				StatusCode:  result.StatusCode,
+				Links:       redirectLinks(mappingUrl, result.Code, result.Token),
+			}
+		}
+
+		// a partially created batch reports the status per redirect
+		statusCode := http.StatusMultiStatus
+		switch created {
+		case len(reds):
+			statusCode = http.StatusCreated
+		case 0:
+			statusCode = http.StatusBadRequest
+		}
+
+		responseBody, err := converter.marshal(asResponse)
+		if err != nil {
+			h.log.Error(err, "marshalling response", "contentType", c.ContentType(), "response", asResponse)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		c.Data(statusCode, c.ContentType(), responseBody)
+	}
+}
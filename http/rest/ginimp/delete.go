@@ -16,6 +16,8 @@ type redirectDeleteRequest struct {
 // RedirectGet implements the "delete" verb of the REST context that deletes an existing redirect.
 func (h *handler) RedirectInvalidate(mappingUrl string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		d, _ := h.resolveDomain(c, mappingUrl)
+
 		var r redirectDeleteRequest
 
 		if err := c.BindUri(&r); err != nil {
@@ -24,8 +26,9 @@ func (h *handler) RedirectInvalidate(mappingUrl string) gin.HandlerFunc {
 		}
 
 		err := h.invalidator.Invalidate(invalidator.RedirectQuery{
-			Code:  r.Code,
-			Token: r.Token,
+			Domain: d,
+			Code:   r.Code,
+			Token:  r.Token,
 		})
 		if err != nil {
 			status := http.StatusInternalServerError
@@ -1,36 +1,171 @@
 package ginimp
 
 import (
+	"bytes"
 	"errors"
+	"hex-microservice/http/page"
 	"hex-microservice/lookup"
+	"hex-microservice/targeting"
 	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// RedirectGet implements the "get" verb of the REST context that gets an existing redirect.
+// The password of a protected redirect is taken from a header.
 func (h *handler) RedirectGet(mappingUrl string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		code := c.Param(UrlParameterCode)
+		h.redirect(c, mappingUrl, c.GetHeader(headerFieldPassword))
+	}
+}
 
-		redirect, err := h.lookup.Lookup(
-			lookup.RedirectQuery{Code: code},
-		)
-		if err != nil {
-			status := http.StatusInternalServerError
+// RedirectUnlock implements the "post" verb of the REST context that gets an existing redirect
+// with the password of the form of a protected redirect.
+func (h *handler) RedirectUnlock(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.redirect(c, mappingUrl, c.PostForm(page.FieldPassword))
+	}
+}
 
-			if errors.Is(err, lookup.ErrNotFound) {
-				status = http.StatusNotFound
-			}
+// redirect looks up the redirect and redirects the client, a protected
+// redirect without the right password is answered with a challenge. The
+// preview of a redirect is shown instead if the code has the preview suffix
+// or the redirect is always previewed.
+func (h *handler) redirect(c *gin.Context, mappingUrl, password string) {
+	d, mappingUrl := h.resolveDomain(c, mappingUrl)
+	code := c.Param(UrlParameterCode)
+	path := strings.TrimPrefix(c.Param(UrlParameterPath), "/")
+	lookupCode, preview := previewCode(code)
 
-			if status == http.StatusInternalServerError {
-				h.log.Error(err, "Internal server error", "method", "RedirectGet", UrlParameterCode, code)
-			}
+	redirect, err := h.lookup.Lookup(
+		lookup.RedirectQuery{
+			Domain:   d,
+			Code:     lookupCode,
+			Password: password,
+			Request:  targetingRequest(c.Request),
+			Variant:  servedVariant(c),
+			Path:     path,
+			Preview:  preview,
+		},
+	)
+	if err != nil {
+		status := http.StatusInternalServerError
 
-			c.JSON(status, gin.H{"error": http.StatusText(status)})
+		switch {
+		case errors.Is(err, lookup.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, lookup.ErrExhausted):
+			status = http.StatusGone
+		case errors.Is(err, lookup.ErrTooManyAttempts):
+			status = http.StatusTooManyRequests
+		case errors.Is(err, lookup.ErrWrongPassword):
+			h.challenge(c, urlForCode(mappingUrl, code), true)
 			return
 		}
 
-		c.Redirect(http.StatusTemporaryRedirect, redirect.URL)
+		if status == http.StatusInternalServerError {
+			h.log.Error(err, "Internal server error", "method", "RedirectGet", UrlParameterCode, code)
+		}
+
+		c.JSON(status, gin.H{"error": http.StatusText(status)})
+		return
+	}
+
+	if redirect.PasswordRequired {
+		h.challenge(c, urlForCode(mappingUrl, code), false)
+		return
+	}
+
+	if redirect.Variant > 0 {
+		// the visitor continues from a preview with the same variant
+		http.SetCookie(c.Writer, variantCookie(codePath(mappingUrl, lookupCode), redirect.Variant))
+	}
+
+	if !redirect.Scheduled && (preview || redirect.Preview) {
+		h.preview(c, redirect, continueURL(c.Request, mappingUrl, path, redirect))
+		return
+	}
+
+	c.Redirect(redirectStatus(c.Request, redirect), redirect.URL)
+}
+
+// challenge asks for the password of a protected redirect, browsers get a
+// form that is posted to the action.
+func (h *handler) challenge(c *gin.Context, action string, wrong bool) {
+	if !strings.Contains(c.GetHeader(headerFieldAccept), contentTypeHtml) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	var body bytes.Buffer
+	if err := page.WritePassword(&body, page.Password{Action: action, Wrong: wrong}); err != nil {
+		h.log.Error(err, "rendering the password page")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
 		return
 	}
+
+	c.Data(http.StatusUnauthorized, contentTypeHtmlWithCharset, body.Bytes())
+}
+
+// targetingRequest returns the attributes of the request the rules of a redirect match on.
+func targetingRequest(r *http.Request) targeting.Request {
+	return targeting.Request{
+		AcceptLanguage: r.Header.Get(headerFieldAcceptLanguage),
+		UserAgent:      r.UserAgent(),
+		Referer:        r.Referer(),
+		Query:          r.URL.Query(),
+	}
+}
+
+// servedVariant returns the variant a returning visitor was served, zero for a new visitor.
+func servedVariant(c *gin.Context) int {
+	value, err := c.Cookie(cookieNameVariant)
+	if err != nil {
+		return 0
+	}
+
+	variant, _ := strconv.Atoi(value)
+
+	return variant
+}
+
+// variantCookie returns the cookie that keeps the variant of the visitor for the path of the redirect.
+func variantCookie(path string, variant int) *http.Cookie {
+	return &http.Cookie{
+		Name:     cookieNameVariant,
+		Value:    strconv.Itoa(variant),
+		Path:     path,
+		MaxAge:   cookieMaxAgeVariant,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// codePath returns the path of the short url of the code, the cookies of a redirect are sent
+// with the paths passed through as well.
+func codePath(mappingUrl, code string) string {
+	u, err := neturl.Parse(urlForCode(mappingUrl, code))
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+
+	return u.Path
+}
+
+// redirectStatus returns the status code of the redirect, a temporary redirect if it has none.
+// The unlock form is always answered with a see other, browsers would repeat the post with its
+// password to the destination on a temporary or permanent redirect.
+func redirectStatus(r *http.Request, redirect lookup.RedirectResult) int {
+	if r.Method == http.MethodPost {
+		return http.StatusSeeOther
+	}
+
+	if redirect.StatusCode == 0 {
+		return http.StatusTemporaryRedirect
+	}
+
+	return redirect.StatusCode
 }
@@ -1,19 +1,54 @@
 package ginimp
 
 import (
+	"hex-microservice/health"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func (h *handler) Health(now time.Time) gin.HandlerFunc {
+// HealthLive reports that the process is alive, it doesn't depend on any
+// dependency.
+func (h *handler) HealthLive() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		h := h.health.Health(now)
+		h := h.health.Health(time.Now())
 		c.JSON(http.StatusOK, gin.H{
 			"name":    h.Name,
 			"version": h.Version,
 			"uptime":  h.Uptime.String(),
+			"status":  "up",
+		})
+	}
+}
+
+// HealthReady runs the readiness checks, a check that is down makes the
+// service unavailable.
+func (h *handler) HealthReady() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		readiness := h.health.Ready(c.Request.Context())
+
+		checks := make([]gin.H, len(readiness.Checks))
+		for i, check := range readiness.Checks {
+			checks[i] = gin.H{
+				"name":     check.Name,
+				"status":   check.Status.String(),
+				"duration": check.Duration.String(),
+			}
+
+			if check.Err != nil {
+				checks[i]["error"] = check.Err.Error()
+			}
+		}
+
+		statusCode := http.StatusOK
+		if readiness.Status == health.StatusDown {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		c.JSON(statusCode, gin.H{
+			"status": readiness.Status.String(),
+			"checks": checks,
 		})
 	}
 }
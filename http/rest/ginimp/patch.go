@@ -0,0 +1,71 @@
+package ginimp
+
+import (
+	"errors"
+	"hex-microservice/updater"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type redirectPatchUri struct {
+	Code  string `uri:"code" binding:"required"`
+	Token string `uri:"token" binding:"required"`
+}
+
+type redirectPatchRequest struct {
+	URL string `json:"url" binding:"required"`
+}
+
+// RedirectPatch implements the "patch" verb of the REST context that changes the url of an existing redirect.
+func (h *handler) RedirectPatch(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, _ := h.resolveDomain(c, mappingUrl)
+
+		_, ok := h.converters[c.ContentType()]
+		if !ok {
+			h.log.Error(nil, "unsupported content type", "contentType", c.ContentType())
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": http.StatusText(http.StatusUnsupportedMediaType)})
+			return
+		}
+
+		var u redirectPatchUri
+		if err := c.BindUri(&u); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "field validation failed"})
+			return
+		}
+
+		var r redirectPatchRequest
+		if err := c.Bind(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "field validation failed"})
+			return
+		}
+
+		err := h.updater.Update(updater.RedirectCommand{
+			Domain: d,
+			Code:   u.Code,
+			Token:  u.Token,
+			URL:    r.URL,
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+
+			switch {
+			case errors.Is(err, updater.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, updater.ErrRedirectInvalid):
+				status = http.StatusBadRequest
+			case errors.Is(err, updater.ErrPolicyViolation):
+				status = http.StatusUnprocessableEntity
+			default:
+				h.log.Error(err, "error updating request", "request", r)
+			}
+
+			c.JSON(status, gin.H{"error": http.StatusText(status)})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+		return
+	}
+}
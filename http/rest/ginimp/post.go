@@ -1,34 +1,94 @@
 package ginimp
 
 import (
-	"errors"
-	"fmt"
 	"hex-microservice/adder"
+	"hex-microservice/http/clientip"
+	"hex-microservice/meta/value"
+	"hex-microservice/targeting"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type redirectPostRequest struct {
-	CustomCode string `json:"custom_code" binding:"omitempty,gte=5,lte=25"`
-	URL        string `json:"url" binding:"required"`
+	CustomCode string `json:"custom_code" msgpack:"custom_code" binding:"omitempty,gte=5,lte=25"`
+	URL        string `json:"url" msgpack:"url" binding:"required"`
+	// TTL is the time to live in seconds
+	TTL       int64      `json:"ttl" msgpack:"ttl" binding:"omitempty,gte=0"`
+	ExpiresAt *time.Time `json:"expires_at" msgpack:"expires_at"`
+	// Password protects the redirect
+	Password string `json:"password" msgpack:"password" binding:"omitempty,gte=4,lte=72"`
+	// MaxUses limits the number of redirects, e.g. 1 for a one-time link
+	MaxUses int `json:"max_uses" msgpack:"max_uses" binding:"omitempty,gte=0"`
+	// NotBefore schedules the activation of the redirect
+	NotBefore *time.Time `json:"not_before" msgpack:"not_before"`
+	// Rules are the conditional destinations in their order, the URL is the fallback
+	Rules targeting.Rules `json:"rules" msgpack:"rules"`
+	// Variants split the visitors by weight if no rule matches
+	Variants targeting.Variants `json:"variants" msgpack:"variants"`
+	// Passthrough passes the path after the code and the query to the destination
+	Passthrough bool `json:"passthrough" msgpack:"passthrough"`
+	// Preview shows every visitor the preview page instead of redirecting
+	Preview bool `json:"preview" msgpack:"preview"`
+	// StatusCode is the status code of the redirect, e.g. 301 for a permanent move
+	StatusCode int `json:"status_code" msgpack:"status_code"`
 }
 
 type redirectResponse struct {
-	Code string `json:"code" msgpack:"code"`
-	URL  string `json:"url" msgpack:"url"`
+	Code        string     `json:"code" msgpack:"code"`
+	URL         string     `json:"url" msgpack:"url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" msgpack:"expires_at,omitempty"`
+	MaxUses     int        `json:"max_uses,omitempty" msgpack:"max_uses,omitempty"`
+	NotBefore   *time.Time `json:"not_before,omitempty" msgpack:"not_before,omitempty"`
+	Passthrough bool       `json:"passthrough,omitempty" msgpack:"passthrough,omitempty"`
+	Preview     bool       `json:"preview,omitempty" msgpack:"preview,omitempty"`
+	StatusCode  int        `json:"status_code,omitempty" msgpack:"status_code,omitempty"`
 
 	Links []link `json:"_links,omitempty"`
 }
 
 type link struct {
-	Href string `json:"href,omitempty"`
-	Rel  string `json:"rel,omitempty"`
-	T    string `json:"type,omitempty"`
+	Href string `json:"href,omitempty" msgpack:"href,omitempty"`
+	Rel  string `json:"rel,omitempty" msgpack:"rel,omitempty"`
+	T    string `json:"type,omitempty" msgpack:"type,omitempty"`
+}
+
+// command returns the command of the adder service for the request.
+func (r redirectPostRequest) command(domain, owner, clientInfo string) adder.RedirectCommand {
+	return adder.RedirectCommand{
+		Domain:      domain,
+		Owner:       owner,
+		URL:         r.URL,
+		CustomCode:  r.CustomCode,
+		ClientInfo:  clientInfo,
+		TTL:         time.Duration(r.TTL) * time.Second,
+		ExpiresAt:   value.OrDefault(r.ExpiresAt, time.Time{}),
+		Password:    r.Password,
+		MaxUses:     r.MaxUses,
+		NotBefore:   value.OrDefault(r.NotBefore, time.Time{}),
+		Rules:       r.Rules,
+		Variants:    r.Variants,
+		Passthrough: r.Passthrough,
+		Preview:     r.Preview,
+		StatusCode:  r.StatusCode,
+	}
+}
+
+// MarshalLog implements logr.Marshaler to keep the password out of the logs.
+func (r redirectPostRequest) MarshalLog() any {
+	type redacted redirectPostRequest
+	if r.Password != "" {
+		r.Password = "redacted"
+	}
+
+	return redacted(r)
 }
 
 func (h *handler) RedirectPost(mappingUrl string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		d, mappingUrl := h.resolveDomain(c, mappingUrl)
+
 		_, ok := h.converters[c.ContentType()]
 		if !ok {
 			h.log.Error(nil, "unsupported content type", "contentType", c.ContentType())
@@ -43,40 +103,31 @@ func (h *handler) RedirectPost(mappingUrl string) gin.HandlerFunc {
 			return
 		}
 
-		results, err := h.adder.Add(
-			adder.RedirectCommand{
-				URL:        r.URL,
-				CustomCode: r.CustomCode,
-				ClientInfo: c.ClientIP(),
-			})
+		results, err := h.adder.Add(r.command(d, owner(c.Request), clientip.IP(c.Request)))
 		if err != nil {
-			if r.CustomCode != "" && errors.Is(err, adder.ErrDuplicate) {
-				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf(customCodeAlreadyTaken, r.CustomCode)})
-				return
-			}
-
 			h.log.Error(err, "error adding request", "request", r)
-			c.JSON(http.StatusBadRequest, gin.H{"error": http.StatusText(http.StatusBadRequest)})
+			apiErr := addError(err, r, http.StatusBadRequest)
+			c.JSON(apiErr.StatusCode, gin.H{"error": apiErr.Title})
 			return
 		}
 
 		// response to client
 		result := results[0]
-		c.JSON(http.StatusCreated, redirectResponse{
-			Code: result.Code,
-			URL:  r.URL,
-			Links: []link{
-				{
-					Href: urlForCode(mappingUrl, result.Code),
-					Rel:  resourceName,
-					T:    http.MethodGet,
-				},
-				{
-					Href: urlForCodeAndToken(mappingUrl, result.Code, result.Token),
-					Rel:  resourceName,
-					T:    http.MethodDelete,
-				},
-			},
+		statusCode := http.StatusCreated
+		if result.Reused {
+			statusCode = http.StatusOK
+		}
+
+		c.JSON(statusCode, redirectResponse{
+			Code:        result.Code,
+			URL:         result.URL,
+			ExpiresAt:   optionalTime(result.ExpiresAt),
+			MaxUses:     result.MaxUses,
+			NotBefore:   optionalTime(result.NotBefore),
+			Passthrough: result.Passthrough,
+			Preview:     result.Preview,
+			StatusCode:  result.StatusCode,
+			Links:       redirectLinks(mappingUrl, result.Code, result.Token),
 		})
 		return
 	}
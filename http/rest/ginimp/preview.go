@@ -0,0 +1,76 @@
+package ginimp
+
+import (
+	"bytes"
+	"hex-microservice/http/page"
+	"hex-microservice/http/url"
+	"hex-microservice/lookup"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewResponse is the preview of a redirect that is returned to API clients.
+type previewResponse struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Links []link `json:"_links"`
+}
+
+// previewCode returns the code without the preview suffix and whether the client asks for a preview.
+func previewCode(code string) (string, bool) {
+	if len(code) > len(UrlSuffixPreview) && strings.HasSuffix(code, UrlSuffixPreview) {
+		return strings.TrimSuffix(code, UrlSuffixPreview), true
+	}
+
+	return code, false
+}
+
+// continueURL returns the url the visitor continues to from the preview. The preview of a
+// redirect that is always previewed is its visit, the visitor continues to the destination.
+// Otherwise the visitor continues to the redirect itself.
+func continueURL(r *http.Request, mappingUrl, path string, redirect lookup.RedirectResult) string {
+	if redirect.Preview {
+		return redirect.URL
+	}
+
+	continueTo := url.Join(mappingUrl, redirect.Code, path)
+	if r.URL.RawQuery != "" {
+		continueTo += "?" + r.URL.RawQuery
+	}
+
+	return continueTo
+}
+
+// preview shows the destination of the redirect instead of redirecting, browsers get a
+// page and API clients that accept JSON the same information as JSON.
+func (h *handler) preview(c *gin.Context, redirect lookup.RedirectResult, continueTo string) {
+	if strings.Contains(c.GetHeader(headerFieldAccept), contentTypeJson) {
+		c.JSON(http.StatusOK, previewResponse{
+			Code:      redirect.Code,
+			URL:       redirect.URL,
+			CreatedAt: redirect.CreatedAt,
+			Links: []link{
+				{
+					Href: continueTo,
+					Rel:  relationContinue,
+					T:    http.MethodGet,
+				},
+			},
+		})
+		return
+	}
+
+	var body bytes.Buffer
+	if err := page.WritePreview(&body, page.Preview{Code: redirect.Code, URL: redirect.URL, CreatedAt: redirect.CreatedAt, Continue: continueTo}); err != nil {
+		h.log.Error(err, "rendering the preview page")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		return
+	}
+
+	c.Data(http.StatusOK, contentTypeHtmlWithCharset, body.Bytes())
+}
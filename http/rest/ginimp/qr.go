@@ -0,0 +1,100 @@
+package ginimp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hex-microservice/lookup"
+	"hex-microservice/meta/value"
+	"hex-microservice/qrcode"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type redirectQRRequest struct {
+	Size   *int   `form:"size"`
+	Level  string `form:"level"`
+	Format string `form:"format"`
+}
+
+// RedirectQR implements the "get" verb of the REST context that returns the QR code of the short url of a redirect.
+// An unknown code is not found, the QR code of a scheduled redirect can be printed before its activation.
+func (h *handler) RedirectQR(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, mappingUrl := h.resolveDomain(c, mappingUrl)
+		code := c.Param(UrlParameterCode)
+
+		var r redirectQRRequest
+		if err := c.BindQuery(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlQuerySize)})
+			return
+		}
+
+		size := defaultQRSize
+		if r.Size != nil {
+			size = *r.Size
+		}
+
+		if size < minQRSize || size > maxQRSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlQuerySize)})
+			return
+		}
+
+		level := qrcode.DefaultLevel
+		if r.Level != "" {
+			var ok bool
+			if level, ok = value.FirstByString(qrcode.Levels, strings.ToLower, r.Level); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlQueryLevel)})
+				return
+			}
+		}
+
+		format := strings.ToLower(r.Format)
+		if format == "" {
+			format = qrFormatPNG
+		}
+
+		if format != qrFormatPNG && format != qrFormatSVG {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlQueryFormat)})
+			return
+		}
+
+		if err := h.lookup.Exists(d, code); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, lookup.ErrNotFound) {
+				status = http.StatusNotFound
+			} else {
+				h.log.Error(err, "Internal server error", "method", "RedirectQR", UrlParameterCode, code)
+			}
+
+			c.JSON(status, gin.H{"error": http.StatusText(status)})
+			return
+		}
+
+		qr, err := qrcode.Encode(urlForCode(mappingUrl, code), level)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlParameterCode)})
+			return
+		}
+
+		var body bytes.Buffer
+		contentType := contentTypePNG
+
+		if format == qrFormatSVG {
+			contentType = contentTypeSVG
+			err = qr.SVG(&body, size)
+		} else {
+			err = qr.PNG(&body, size)
+		}
+
+		if err != nil {
+			h.log.Error(err, "Internal server error", "method", "RedirectQR", UrlParameterCode, code)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		c.Data(http.StatusOK, contentType, body.Bytes())
+	}
+}
@@ -0,0 +1,52 @@
+package ginimp
+
+import (
+	"errors"
+	"hex-microservice/restorer"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type redirectRestoreRequest struct {
+	Code  string `uri:"code" binding:"required"`
+	Token string `uri:"token" binding:"required"`
+}
+
+// RedirectRestore implements the "post" verb of the REST context that restores an invalidated redirect.
+func (h *handler) RedirectRestore(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, _ := h.resolveDomain(c, mappingUrl)
+
+		var r redirectRestoreRequest
+
+		if err := c.BindUri(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "field validation failed"})
+			return
+		}
+
+		err := h.restorer.Restore(restorer.RedirectQuery{
+			Domain: d,
+			Code:   r.Code,
+			Token:  r.Token,
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+
+			switch {
+			case errors.Is(err, restorer.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, restorer.ErrWindowClosed):
+				status = http.StatusGone
+			default:
+				h.log.Error(err, "error restoring redirect", "code", r.Code)
+			}
+
+			c.JSON(status, gin.H{"error": http.StatusText(status)})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+		return
+	}
+}
@@ -0,0 +1,43 @@
+package ginimp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type scheduledResponse struct {
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	NotBefore time.Time  `json:"not_before"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// RedirectScheduled implements the "get" verb of the REST context that lists the redirects that are not yet activated.
+func (h *handler) RedirectScheduled(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, _ := h.resolveDomain(c, mappingUrl)
+
+		scheduled, err := h.scheduler.Scheduled(d)
+		if err != nil {
+			h.log.Error(err, "Internal server error", "method", "RedirectScheduled")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		response := make([]scheduledResponse, len(scheduled))
+		for i, s := range scheduled {
+			response[i] = scheduledResponse{
+				Code:      s.Code,
+				URL:       s.URL,
+				CreatedAt: s.CreatedAt,
+				NotBefore: s.NotBefore,
+				ExpiresAt: optionalTime(s.ExpiresAt),
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,24 @@
+package ginimp
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type statsResponse struct {
+	Collisions uint64 `json:"collisions"`
+	Exhausted  uint64 `json:"exhausted"`
+}
+
+// RedirectStats implements the "get" verb of the REST context that returns the statistics of the code generation.
+func (h *handler) RedirectStats(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats := h.adder.Stats()
+
+		c.JSON(http.StatusOK, statsResponse{
+			Collisions: stats.Collisions,
+			Exhausted:  stats.Exhausted,
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package ginimp
+
+import (
+	"errors"
+	"fmt"
+	"hex-microservice/ranker"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type redirectTopRequest struct {
+	Limit *int `form:"n"`
+}
+
+type topResponse struct {
+	Code string `json:"code"`
+	URL  string `json:"url"`
+	Hits uint64 `json:"hits"`
+}
+
+// RedirectTop implements the "get" verb of the REST context that ranks the most visited redirects.
+func (h *handler) RedirectTop(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, _ := h.resolveDomain(c, mappingUrl)
+
+		var r redirectTopRequest
+
+		if err := c.BindQuery(&r); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlQueryLimit)})
+			return
+		}
+
+		limit := defaultTopLimit
+		if r.Limit != nil {
+			limit = *r.Limit
+		}
+
+		ranked, err := h.ranker.Top(ranker.RankingQuery{Domain: d, Limit: limit})
+		if err != nil {
+			if errors.Is(err, ranker.ErrQueryInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(titleProcessingFieldFormat, UrlQueryLimit)})
+				return
+			}
+
+			h.log.Error(err, "Internal server error", "method", "RedirectTop")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		response := make([]topResponse, len(ranked))
+		for i, r := range ranked {
+			response[i] = topResponse{
+				Code: r.Code,
+				URL:  r.URL,
+				Hits: r.Hits,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,49 @@
+package ginimp
+
+import (
+	"errors"
+	"hex-microservice/ranker"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type variantResponse struct {
+	Variant int    `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Hits    uint64 `json:"hits"`
+}
+
+// RedirectVariants implements the "get" verb of the REST context that compares the variants of a redirect.
+func (h *handler) RedirectVariants(mappingUrl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, _ := h.resolveDomain(c, mappingUrl)
+
+		code := c.Param(UrlParameterCode)
+
+		variants, err := h.ranker.Variants(d, code)
+		if err != nil {
+			if errors.Is(err, ranker.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": http.StatusText(http.StatusNotFound)})
+				return
+			}
+
+			h.log.Error(err, "Internal server error", "method", "RedirectVariants", UrlParameterCode, code)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+
+		response := make([]variantResponse, len(variants))
+		for i, v := range variants {
+			response[i] = variantResponse{
+				Variant: v.Variant,
+				URL:     v.URL,
+				Weight:  v.Weight,
+				Hits:    v.Hits,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,205 @@
+package stdlib
+
+import (
+	"errors"
+	"fmt"
+	"hex-microservice/adder"
+	"hex-microservice/http/clientip"
+	"hex-microservice/http/middleware"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// batchItemResponse is the result of a single redirect of a batch that is returned to the client.
+type batchItemResponse struct {
+	Code        string     `json:"code,omitempty" msgpack:"code,omitempty"`
+	URL         string     `json:"url" msgpack:"url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" msgpack:"expires_at,omitempty"`
+	MaxUses     int        `json:"max_uses,omitempty" msgpack:"max_uses,omitempty"`
+	NotBefore   *time.Time `json:"not_before,omitempty" msgpack:"not_before,omitempty"`
+	Passthrough bool       `json:"passthrough,omitempty" msgpack:"passthrough,omitempty"`
+	Preview     bool       `json:"preview,omitempty" msgpack:"preview,omitempty"`
+	StatusCode  int        `json:"status_code,omitempty" msgpack:"status_code,omitempty"`
+
+	Links []link    `json:"_links,omitempty" msgpack:"_links,omitempty"`
+	Error *ApiError `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// addError maps the error of a single redirect to the error for the client, the
+// errors the adder doesn't signal are answered with the fallback status.
+func addError(err error, red redirectRequest, fallback int) *ApiError {
+	switch {
+	case errors.Is(err, adder.ErrDuplicate) && red.CustomCode != "":
+		return &ApiError{StatusCode: http.StatusConflict, Title: fmt.Sprintf(customCodeAlreadyTaken, red.CustomCode)}
+	case errors.Is(err, adder.ErrCollision):
+		return &ApiError{StatusCode: http.StatusServiceUnavailable, Title: titleCodeCollision}
+	case errors.Is(err, adder.ErrRedirectInvalid):
+		return &ApiError{StatusCode: http.StatusBadRequest, Title: titleRedirectInvalid}
+	case errors.Is(err, adder.ErrPolicyViolation):
+		return &ApiError{StatusCode: http.StatusUnprocessableEntity, Title: titlePolicyViolation}
+	case errors.Is(err, adder.ErrBatchAborted):
+		return &ApiError{StatusCode: http.StatusFailedDependency, Title: titleBatchAborted}
+	default:
+		return &ApiError{StatusCode: fallback, Title: http.StatusText(fallback)}
+	}
+}
+
+// RedirectBatch implements the "post" verb of the REST context that creates a batch of redirects.
+// Each redirect is created independently unless the all-or-nothing semantic is requested by the
+// query parameter "atomic".
+func (h *handler) RedirectBatch(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, mappingUrl := h.resolveDomain(r, mappingUrl)
+
+		atomic := false
+		if a := r.URL.Query().Get(UrlQueryAtomic); a != "" {
+			var err error
+			if atomic, err = strconv.ParseBool(a); err != nil {
+				writeApiError(w, h.log, ApiError{
+					StatusCode: http.StatusBadRequest,
+					Title:      fmt.Sprintf(titleProcessingFieldFormat, UrlQueryAtomic),
+				})
+				return
+			}
+		}
+
+		requestBody, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBodySize))
+		if err != nil {
+			h.log.Error(err, "reading document body")
+			// the reader stops at the limit
+			if len(requestBody) == maxBatchBodySize {
+				writeApiError(w, h.log, ApiError{
+					StatusCode: http.StatusRequestEntityTooLarge,
+					Title:      titleBodyTooLarge,
+				})
+				return
+			}
+
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		// Converter for different content types
+		contentType := r.Header.Get(headerFieldContentType)
+		converter, ok := h.converters[contentType]
+		if !ok {
+			h.log.Error(nil, "unsupported content type", "contentType", contentType)
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		// extract body
+		if len(requestBody) == 0 {
+			h.log.Error(err, "empty body")
+			writeApiError(w, h.log, ApiError{
+				StatusCode: http.StatusBadRequest,
+				Title:      titleEmptyBody,
+			})
+			return
+		}
+
+		var reds []redirectRequest
+		if err := converter.unmarshal(requestBody, &reds); err != nil {
+			h.log.Error(err, "unable to unmarshal the request", "contentType", contentType)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if len(reds) == 0 {
+			writeApiError(w, h.log, ApiError{
+				StatusCode: http.StatusBadRequest,
+				Title:      titleEmptyBatch,
+			})
+			return
+		}
+
+		// every item counts against the rate limit of the client
+		if !middleware.Charge(w, r, len(reds)) {
+			return
+		}
+
+		// validate, the indices map the commands back to the requests
+		asResponse := make([]batchItemResponse, len(reds))
+		commands := make([]adder.RedirectCommand, 0, len(reds))
+		indices := make([]int, 0, len(reds))
+		invalid := false
+
+		for i, red := range reds {
+			asResponse[i].URL = red.URL
+
+			if apiErr := h.validateRedirectRequest(red); apiErr != nil {
+				asResponse[i].Error = apiErr
+				invalid = true
+				continue
+			}
+
+			commands = append(commands, red.command(d, owner(r), clientip.IP(r)))
+			indices = append(indices, i)
+		}
+
+		// store
+		var results []adder.RedirectResult
+		switch {
+		case atomic && invalid:
+			results = make([]adder.RedirectResult, len(commands))
+			for i := range results {
+				results[i].Err = adder.ErrBatchAborted
+			}
+		case atomic:
+			results, _ = h.adder.Add(commands...)
+		default:
+			results = h.adder.AddEach(commands...)
+		}
+
+		created := 0
+		for i, result := range results {
+			index := indices[i]
+
+			if result.Err != nil {
+				if !errors.Is(result.Err, adder.ErrBatchAborted) {
+					h.log.Error(result.Err, "error adding request", "request", reds[index])
+				}
+
+				asResponse[index].Error = addError(result.Err, reds[index], http.StatusInternalServerError)
+				continue
+			}
+
+			created++
+
+			asResponse[index] = batchItemResponse{
+				Code:        result.Code,
+				URL:         result.URL,
+				ExpiresAt:   optionalTime(result.ExpiresAt),
+				MaxUses:     result.MaxUses,
+				NotBefore:   optionalTime(result.NotBefore),
+				Passthrough: result.Passthrough,
+				Preview:     result.Preview,
+				StatusCode:  result.StatusCode,
+				Links:       redirectLinks(mappingUrl, result.Code, result.Token),
+			}
+		}
+
+		// a partially created batch reports the status per redirect
+		statusCode := http.StatusMultiStatus
+		switch created {
+		case len(reds):
+			statusCode = http.StatusCreated
+		case 0:
+			statusCode = http.StatusBadRequest
+		}
+
+		responseBody, err := converter.marshal(asResponse)
+		if err != nil {
+			h.log.Error(err, "marshalling response", "contentType", contentType, "response", asResponse)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if err := writeResponse(w, contentType, responseBody, statusCode); err != nil {
+			h.log.Error(err, "error writing the response to the response object")
+			return
+		}
+	}
+}
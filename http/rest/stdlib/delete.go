@@ -9,9 +9,12 @@ import (
 // RedirectGet implements the "delete" verb of the REST context that deletes an existing redirect.
 func (h *handler) RedirectInvalidate(mappingUrl string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		d, _ := h.resolveDomain(r, mappingUrl)
+
 		err := h.invalidator.Invalidate(invalidator.RedirectQuery{
-			Code:  h.paramFn(r, UrlParameterCode),
-			Token: h.paramFn(r, UrlParameterToken),
+			Domain: d,
+			Code:   h.paramFn(r, UrlParameterCode),
+			Token:  h.paramFn(r, UrlParameterToken),
 		})
 		if err != nil {
 			status := http.StatusInternalServerError
@@ -2,6 +2,7 @@ package stdlib
 
 import (
 	"encoding/json"
+	"hex-microservice/health"
 	"net/http"
 	"time"
 )
@@ -10,16 +11,33 @@ type healthResponse struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
 	Uptime  string `json:"uptime"`
+	Status  string `json:"status"`
 }
 
-func (h *handler) Health(now time.Time) http.HandlerFunc {
+// checkResponse is the result of a single readiness check.
+type checkResponse struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string          `json:"status"`
+	Checks []checkResponse `json:"checks"`
+}
+
+// HealthLive reports that the process is alive, it doesn't depend on any
+// dependency.
+func (h *handler) HealthLive() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		health := h.health.Health(now)
+		health := h.health.Health(time.Now())
 
 		response, err := json.Marshal(healthResponse{
 			Name:    health.Name,
 			Version: health.Version,
 			Uptime:  health.Uptime.String(),
+			Status:  "up",
 		})
 		if err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -29,3 +47,45 @@ func (h *handler) Health(now time.Time) http.HandlerFunc {
 		writeResponse(w, contentTypeJson, response, http.StatusOK)
 	}
 }
+
+// HealthReady runs the readiness checks, a check that is down makes the
+// service unavailable.
+func (h *handler) HealthReady() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness := h.health.Ready(r.Context())
+
+		asResponse := readinessResponse{
+			Status: readiness.Status.String(),
+			Checks: make([]checkResponse, len(readiness.Checks)),
+		}
+
+		for i, check := range readiness.Checks {
+			asResponse.Checks[i] = checkResponse{
+				Name:     check.Name,
+				Status:   check.Status.String(),
+				Duration: check.Duration.String(),
+			}
+
+			if check.Err != nil {
+				asResponse.Checks[i].Error = check.Err.Error()
+			}
+		}
+
+		response, err := json.Marshal(asResponse)
+		if err != nil {
+			h.log.Error(err, "marshalling response", "response", asResponse)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		statusCode := http.StatusOK
+		if readiness.Status == health.StatusDown {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		if err := writeResponse(w, contentTypeJson, response, statusCode); err != nil {
+			h.log.Error(err, "error writing the response to the response object")
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package stdlib
+
+import (
+	"errors"
+	"fmt"
+	"hex-microservice/updater"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	validate "gopkg.in/dealancer/validate.v2"
+)
+
+// redirectPatchRequest is the change of a redirect that is requested by the client.
+type redirectPatchRequest struct {
+	// mandatory
+	URL string `json:"url" msgpack:"url"  validate:"empty=false & format=url"`
+}
+
+// RedirectPatch implements the "patch" verb of the REST context that changes the url of an existing redirect.
+func (h *handler) RedirectPatch(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, _ := h.resolveDomain(r, mappingUrl)
+
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			h.log.Error(err, "reading document body")
+			return
+		}
+
+		// Converter for different content types
+		contentType := r.Header.Get(headerFieldContentType)
+		converter, ok := h.converters[contentType]
+		if !ok {
+			h.log.Error(nil, "unsupported content type", "contentType", contentType)
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		// extract body
+		if len(requestBody) == 0 {
+			h.log.Error(err, "empty body")
+			writeApiError(w, h.log, ApiError{
+				StatusCode: http.StatusBadRequest,
+				Title:      titleEmptyBody,
+			})
+			return
+		}
+
+		red := redirectPatchRequest{}
+		if err := converter.unmarshal(requestBody, &red); err != nil {
+			h.log.Error(err, "unable to unmarshal the request", "contentType", contentType)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// validate
+		if err := validate.Validate(red); err != nil {
+			var errValidation validate.ErrorValidation
+			if errors.As(err, &errValidation) {
+				fieldName := errValidation.FieldName()
+
+				h.log.Error(err, "error validating request",
+					"fieldValue", reflect.ValueOf(&red).Elem().FieldByName(fieldName),
+					"request", red,
+				)
+				writeApiError(w, h.log, ApiError{
+					StatusCode: http.StatusBadRequest,
+					Title:      fmt.Sprintf(titleProcessingFieldFormat, fieldName),
+				})
+				return
+			}
+
+			h.log.Error(err, "error validating request", "request", red)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		// update
+		err = h.updater.Update(updater.RedirectCommand{
+			Domain: d,
+			Code:   h.paramFn(r, UrlParameterCode),
+			Token:  h.paramFn(r, UrlParameterToken),
+			URL:    red.URL,
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+
+			switch {
+			case errors.Is(err, updater.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, updater.ErrRedirectInvalid):
+				status = http.StatusBadRequest
+			case errors.Is(err, updater.ErrPolicyViolation):
+				status = http.StatusUnprocessableEntity
+			default:
+				h.log.Error(err, "error updating request", "request", red)
+			}
+
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"hex-microservice/adder"
+	"hex-microservice/http/clientip"
+	"hex-microservice/meta/value"
+	"hex-microservice/targeting"
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"time"
 
 	validate "gopkg.in/dealancer/validate.v2"
 )
@@ -17,11 +21,96 @@ type redirectRequest struct {
 	URL string `json:"url" msgpack:"url"  validate:"empty=false & format=url"`
 	// optional
 	CustomCode string `json:"custom_code" msgpack:"custom_code" validate:"empty=true | gte=5 & lte=25"`
+	// TTL is the time to live in seconds
+	TTL       int64      `json:"ttl" msgpack:"ttl" validate:"gte=0"`
+	ExpiresAt *time.Time `json:"expires_at" msgpack:"expires_at"`
+	// Password protects the redirect
+	Password string `json:"password" msgpack:"password" validate:"empty=true | gte=4 & lte=72"`
+	// MaxUses limits the number of redirects, e.g. 1 for a one-time link
+	MaxUses int `json:"max_uses" msgpack:"max_uses" validate:"gte=0"`
+	// NotBefore schedules the activation of the redirect
+	NotBefore *time.Time `json:"not_before" msgpack:"not_before"`
+	// Rules are the conditional destinations in their order, the URL is the fallback
+	Rules targeting.Rules `json:"rules" msgpack:"rules"`
+	// Variants split the visitors by weight if no rule matches
+	Variants targeting.Variants `json:"variants" msgpack:"variants"`
+	// Passthrough passes the path after the code and the query to the destination
+	Passthrough bool `json:"passthrough" msgpack:"passthrough"`
+	// Preview shows every visitor the preview page instead of redirecting
+	Preview bool `json:"preview" msgpack:"preview"`
+	// StatusCode is the status code of the redirect, e.g. 301 for a permanent move
+	StatusCode int `json:"status_code" msgpack:"status_code"`
+}
+
+// command returns the command of the adder service for the request.
+func (red redirectRequest) command(domain, owner, clientInfo string) adder.RedirectCommand {
+	return adder.RedirectCommand{
+		Domain:      domain,
+		Owner:       owner,
+		URL:         red.URL,
+		CustomCode:  red.CustomCode,
+		ClientInfo:  clientInfo,
+		TTL:         time.Duration(red.TTL) * time.Second,
+		ExpiresAt:   value.OrDefault(red.ExpiresAt, time.Time{}),
+		Password:    red.Password,
+		MaxUses:     red.MaxUses,
+		NotBefore:   value.OrDefault(red.NotBefore, time.Time{}),
+		Rules:       red.Rules,
+		Variants:    red.Variants,
+		Passthrough: red.Passthrough,
+		Preview:     red.Preview,
+		StatusCode:  red.StatusCode,
+	}
+}
+
+// MarshalLog implements logr.Marshaler to keep the password out of the logs.
+func (red redirectRequest) MarshalLog() any {
+	type redacted redirectRequest
+	if red.Password != "" {
+		red.Password = "redacted"
+	}
+
+	return redacted(red)
+}
+
+// validateRedirectRequest returns the error for the client if the request is not valid.
+func (h *handler) validateRedirectRequest(red redirectRequest) *ApiError {
+	if err := validate.Validate(red); err != nil {
+		var errValidation validate.ErrorValidation
+		if errors.As(err, &errValidation) {
+			fieldName := errValidation.FieldName()
+
+			// the request is redacted, the value of the field isn't
+			var fieldValue any = reflect.ValueOf(&red).Elem().FieldByName(fieldName)
+			if fieldName == "Password" {
+				fieldValue = "redacted"
+			}
+
+			h.log.Error(err, "error validating request",
+				"fieldValue", fieldValue,
+				"request", red,
+			)
+			return &ApiError{
+				StatusCode: http.StatusBadRequest,
+				Title:      fmt.Sprintf(titleProcessingFieldFormat, fieldName),
+			}
+		}
+
+		h.log.Error(err, "error validating request", "request", red)
+		return &ApiError{
+			StatusCode: http.StatusBadRequest,
+			Title:      http.StatusText(http.StatusBadRequest),
+		}
+	}
+
+	return nil
 }
 
 // RedirectPost implements the "post" verb of the REST context that creates a new redirect.
 func (h *handler) RedirectPost(mappingUrl string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		d, mappingUrl := h.resolveDomain(r, mappingUrl)
+
 		requestBody, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -56,65 +145,31 @@ func (h *handler) RedirectPost(mappingUrl string) http.HandlerFunc {
 		}
 
 		// validate
-		if err := validate.Validate(red); err != nil {
-			var errValidation validate.ErrorValidation
-			if errors.As(err, &errValidation) {
-				fieldName := errValidation.FieldName()
-
-				h.log.Error(err, "error validating request",
-					"fieldValue", reflect.ValueOf(&red).Elem().FieldByName(fieldName),
-					"request", red,
-				)
-				writeApiError(w, h.log, ApiError{
-					StatusCode: http.StatusBadRequest,
-					Title:      fmt.Sprintf(titleProcessingFieldFormat, fieldName),
-				})
-				return
-			}
-
-			h.log.Error(err, "error validating request", "request", red)
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		if apiErr := h.validateRedirectRequest(red); apiErr != nil {
+			writeApiError(w, h.log, *apiErr)
 			return
 		}
 
 		// store
-		results, err := h.adder.Add(
-			adder.RedirectCommand{
-				URL:        red.URL,
-				CustomCode: red.CustomCode,
-				ClientInfo: getIP(r),
-			})
+		results, err := h.adder.Add(red.command(d, owner(r), clientip.IP(r)))
 		if err != nil {
-			if red.CustomCode != "" && errors.Is(err, adder.ErrDuplicate) {
-				writeApiError(w, h.log, ApiError{
-					StatusCode: http.StatusConflict,
-					Title:      fmt.Sprintf(customCodeAlreadyTaken, red.CustomCode),
-				})
-				return
-			}
-
 			h.log.Error(err, "error adding request", "request", red)
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			writeApiError(w, h.log, *addError(err, red, http.StatusBadRequest))
 			return
 		}
 
 		// response to client}
 		result := results[0]
 		asResponse := redirectResponse{
-			Code: result.Code,
-			URL:  red.URL,
-			Links: []link{
-				{
-					Href: urlForCode(mappingUrl, result.Code),
-					Rel:  resourceName,
-					T:    http.MethodGet,
-				},
-				{
-					Href: urlForCodeAndToken(mappingUrl, result.Code, result.Token),
-					Rel:  resourceName,
-					T:    http.MethodDelete,
-				},
-			},
+			Code:        result.Code,
+			URL:         result.URL,
+			ExpiresAt:   optionalTime(result.ExpiresAt),
+			MaxUses:     result.MaxUses,
+			NotBefore:   optionalTime(result.NotBefore),
+			Passthrough: result.Passthrough,
+			Preview:     result.Preview,
+			StatusCode:  result.StatusCode,
+			Links:       redirectLinks(mappingUrl, result.Code, result.Token),
 		}
 
 		responseBody, err := converter.marshal(asResponse)
@@ -124,7 +179,12 @@ func (h *handler) RedirectPost(mappingUrl string) http.HandlerFunc {
 			return
 		}
 
-		if err := writeResponse(w, contentType, responseBody, http.StatusCreated); err != nil {
+		statusCode := http.StatusCreated
+		if result.Reused {
+			statusCode = http.StatusOK
+		}
+
+		if err := writeResponse(w, contentType, responseBody, statusCode); err != nil {
 			h.log.Error(err, "error writing the response to the response object")
 			return
 		}
@@ -0,0 +1,102 @@
+package stdlib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hex-microservice/lookup"
+	"hex-microservice/meta/value"
+	"hex-microservice/qrcode"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RedirectQR implements the "get" verb of the REST context that returns the QR code of the short url of a redirect.
+// An unknown code is not found, the QR code of a scheduled redirect can be printed before its activation.
+func (h *handler) RedirectQR(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, mappingUrl := h.resolveDomain(r, mappingUrl)
+		code := h.paramFn(r, UrlParameterCode)
+		query := r.URL.Query()
+
+		size := defaultQRSize
+		if s := query.Get(UrlQuerySize); s != "" {
+			var err error
+			if size, err = strconv.Atoi(s); err != nil || size < minQRSize || size > maxQRSize {
+				writeApiError(w, h.log, ApiError{
+					StatusCode: http.StatusBadRequest,
+					Title:      fmt.Sprintf(titleProcessingFieldFormat, UrlQuerySize),
+				})
+				return
+			}
+		}
+
+		level := qrcode.DefaultLevel
+		if l := query.Get(UrlQueryLevel); l != "" {
+			var ok bool
+			if level, ok = value.FirstByString(qrcode.Levels, strings.ToLower, l); !ok {
+				writeApiError(w, h.log, ApiError{
+					StatusCode: http.StatusBadRequest,
+					Title:      fmt.Sprintf(titleProcessingFieldFormat, UrlQueryLevel),
+				})
+				return
+			}
+		}
+
+		format := strings.ToLower(query.Get(UrlQueryFormat))
+		if format == "" {
+			format = qrFormatPNG
+		}
+
+		if format != qrFormatPNG && format != qrFormatSVG {
+			writeApiError(w, h.log, ApiError{
+				StatusCode: http.StatusBadRequest,
+				Title:      fmt.Sprintf(titleProcessingFieldFormat, UrlQueryFormat),
+			})
+			return
+		}
+
+		if err := h.lookup.Exists(d, code); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, lookup.ErrNotFound) {
+				status = http.StatusNotFound
+			} else {
+				h.log.Error(err, "Internal server error", "method", "RedirectQR", UrlParameterCode, code)
+			}
+
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		qr, err := qrcode.Encode(urlForCode(mappingUrl, code), level)
+		if err != nil {
+			writeApiError(w, h.log, ApiError{
+				StatusCode: http.StatusBadRequest,
+				Title:      fmt.Sprintf(titleProcessingFieldFormat, UrlParameterCode),
+			})
+			return
+		}
+
+		var body bytes.Buffer
+		contentType := contentTypePNG
+
+		if format == qrFormatSVG {
+			contentType = contentTypeSVG
+			err = qr.SVG(&body, size)
+		} else {
+			err = qr.PNG(&body, size)
+		}
+
+		if err != nil {
+			h.log.Error(err, "Internal server error", "method", "RedirectQR", UrlParameterCode, code)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if err := writeResponse(w, contentType, body.Bytes(), http.StatusOK); err != nil {
+			h.log.Error(err, "error writing the response to the response object")
+			return
+		}
+	}
+}
@@ -3,10 +3,16 @@ package stdlib
 import (
 	"encoding/json"
 	"hex-microservice/adder"
+	"hex-microservice/apikey"
+	"hex-microservice/domain"
 	"hex-microservice/health"
 	"hex-microservice/http/url"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 	"net/http"
 	"time"
 
@@ -17,27 +23,107 @@ import (
 const (
 	UrlParameterCode  = "code"
 	UrlParameterToken = "token"
+	// UrlParameterPath is the path after the code that a passthrough redirect passes to the destination.
+	UrlParameterPath = "path"
+
+	// UrlPathTop is the reserved path segment of the ranking.
+	UrlPathTop = "_top"
+	// UrlPathStats is the reserved path segment of the statistics of the code generation.
+	UrlPathStats = "_stats"
+	// UrlPathScheduled is the reserved path segment of the scheduled redirects.
+	UrlPathScheduled = "_scheduled"
+	// UrlPathBatch is the reserved path segment of the batch creation.
+	UrlPathBatch = "_batch"
+	// UrlPathRestore is the path segment that restores an invalidated redirect.
+	UrlPathRestore = "restore"
+	// UrlPathVariants is the path segment of the variants of a redirect with their hits,
+	// it's one of the lookup.ReservedPaths that are never passed through.
+	UrlPathVariants = "variants"
+	// UrlPathQR is the path segment of the QR code of a redirect, it's one of the
+	// lookup.ReservedPaths that are never passed through.
+	UrlPathQR = "qr"
+	// UrlPathLive is the path segment of the liveness below the health path.
+	UrlPathLive = "live"
+	// UrlPathReady is the path segment of the readiness below the health path.
+	UrlPathReady = "ready"
+	// UrlSuffixPreview is the suffix of the code that asks for the preview of a redirect.
+	UrlSuffixPreview = "+"
+	// UrlQueryAtomic is the query parameter that requests all-or-nothing semantics for a batch.
+	UrlQueryAtomic = "atomic"
+	// UrlQueryLimit is the query parameter that limits the ranking.
+	UrlQueryLimit = "n"
+	// UrlQuerySize is the query parameter of the size of a QR code in pixels.
+	UrlQuerySize = "size"
+	// UrlQueryLevel is the query parameter of the error correction level of a QR code.
+	UrlQueryLevel = "level"
+	// UrlQueryFormat is the query parameter of the image format of a QR code, png or svg.
+	UrlQueryFormat = "format"
+
+	defaultTopLimit = 10
+
+	// maxBatchBodySize is the limit of the body of a batch in bytes.
+	maxBatchBodySize = 1 << 20
+
+	defaultQRSize = 256
+	minQRSize     = 32
+	maxQRSize     = 1024
+	qrFormatPNG   = "png"
+	qrFormatSVG   = "svg"
 
 	headerFieldContentType = "content-type"
+	headerFieldAccept      = "accept"
+	// headerFieldAcceptLanguage is one of the attributes the rules of a redirect match on.
+	headerFieldAcceptLanguage = "accept-language"
+	// headerFieldPassword carries the password of a protected redirect for API clients.
+	headerFieldPassword = "x-redirect-password"
 
-	contentTypeMessagePack = "application/x-msgpack"
-	contentTypeJson        = "application/json"
+	// cookieNameVariant keeps the variant of a visitor for the path of a redirect.
+	cookieNameVariant = "variant"
+	// cookieMaxAgeVariant is the lifetime of the assignment of a variant in seconds.
+	cookieMaxAgeVariant = 30 * 24 * 60 * 60
+
+	contentTypeMessagePack     = "application/x-msgpack"
+	contentTypeJson            = "application/json"
+	contentTypeHtml            = "text/html"
+	contentTypeHtmlWithCharset = "text/html; charset=utf-8"
+	contentTypePNG             = "image/png"
+	contentTypeSVG             = "image/svg+xml"
 
 	resourceName = "redirect"
+	// relationQR links the QR code of a redirect.
+	relationQR = "qr"
+	// relationContinue links the destination of a preview.
+	relationContinue = "continue"
 
 	titleEmptyBody             = "Error processing request body, the content is empty"
 	titleProcessingFieldFormat = "Error processing field: '%s'"
 	missingParameterFormat     = "Error missing parameter: '%s'"
 	customCodeAlreadyTaken     = "Error code already taken: '%s'"
+	titleEmptyBatch            = "Error processing request body, the batch is empty"
+	titleBodyTooLarge          = "Error processing request body, the content is too large"
+	titleRedirectInvalid       = "Error invalid redirect"
+	titlePolicyViolation       = "Error redirect destination not allowed"
+	titleCodeCollision         = "Error generating a unique code, please retry"
+	titleBatchAborted          = "Error redirect not stored, another redirect of the batch failed"
 )
 
 type ParamFn func(r *http.Request, key string) string
 
 type Handler interface {
-	Health(now time.Time) http.HandlerFunc
+	HealthLive() http.HandlerFunc
+	HealthReady() http.HandlerFunc
 	RedirectGet(mappingUrl string) http.HandlerFunc
+	RedirectUnlock(mappingUrl string) http.HandlerFunc
 	RedirectPost(mappingUrl string) http.HandlerFunc
+	RedirectBatch(mappingUrl string) http.HandlerFunc
+	RedirectPatch(mappingUrl string) http.HandlerFunc
 	RedirectInvalidate(mappingUrl string) http.HandlerFunc
+	RedirectRestore(mappingUrl string) http.HandlerFunc
+	RedirectTop(mappingUrl string) http.HandlerFunc
+	RedirectStats(mappingUrl string) http.HandlerFunc
+	RedirectScheduled(mappingUrl string) http.HandlerFunc
+	RedirectVariants(mappingUrl string) http.HandlerFunc
+	RedirectQR(mappingUrl string) http.HandlerFunc
 }
 
 type converter struct {
@@ -46,15 +132,21 @@ type converter struct {
 }
 
 type link struct {
-	Href string `json:"href,omitempty"`
-	Rel  string `json:"rel,omitempty"`
-	T    string `json:"type,omitempty"`
+	Href string `json:"href,omitempty" msgpack:"href,omitempty"`
+	Rel  string `json:"rel,omitempty" msgpack:"rel,omitempty"`
+	T    string `json:"type,omitempty" msgpack:"type,omitempty"`
 }
 
 // redirectResponse is the redirect that is returned to the client.
 type redirectResponse struct {
-	Code string `json:"code" msgpack:"code"`
-	URL  string `json:"url" msgpack:"url"`
+	Code        string     `json:"code" msgpack:"code"`
+	URL         string     `json:"url" msgpack:"url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" msgpack:"expires_at,omitempty"`
+	MaxUses     int        `json:"max_uses,omitempty" msgpack:"max_uses,omitempty"`
+	NotBefore   *time.Time `json:"not_before,omitempty" msgpack:"not_before,omitempty"`
+	Passthrough bool       `json:"passthrough,omitempty" msgpack:"passthrough,omitempty"`
+	Preview     bool       `json:"preview,omitempty" msgpack:"preview,omitempty"`
+	StatusCode  int        `json:"status_code,omitempty" msgpack:"status_code,omitempty"`
 
 	Links []link `json:"_links,omitempty"`
 }
@@ -63,36 +155,94 @@ type redirectResponse struct {
 type handler struct {
 	log     logr.Logger
 	paramFn ParamFn
+	// domains are the mapped urls of the custom domains by their host
+	domains map[string]string
 	// services
 	adder       adder.Service
 	lookup      lookup.Service
+	updater     updater.Service
 	invalidator invalidator.Service
+	restorer    restorer.Service
+	ranker      ranker.Service
+	scheduler   scheduler.Service
 	health      health.Service
 	converters  map[string]converter
 }
 
 type ApiError struct {
-	StatusCode int    `json:"status"`
-	Title      string `json:"title"`
+	StatusCode int    `json:"status" msgpack:"status"`
+	Title      string `json:"title" msgpack:"title"`
 }
 
 func urlForCode(mappedUrl, code string) string {
 	return url.Join(mappedUrl, code)
 }
 
+func urlForQR(mappedUrl, code string) string {
+	return url.Join(mappedUrl, code, UrlPathQR)
+}
+
 func urlForCodeAndToken(mappedUrl, code, token string) string {
 	return url.Join(mappedUrl, code, token)
 }
 
-func New(log logr.Logger, health health.Service, adder adder.Service, lookup lookup.Service, invalidator invalidator.Service, paramFn ParamFn) Handler {
+// redirectLinks returns the links of a created redirect.
+func redirectLinks(mappedUrl, code, token string) []link {
+	links := []link{
+		{
+			Href: urlForCode(mappedUrl, code),
+			Rel:  resourceName,
+			T:    http.MethodGet,
+		},
+		{
+			Href: urlForQR(mappedUrl, code),
+			Rel:  relationQR,
+			T:    http.MethodGet,
+		},
+	}
+
+	// without a token, e.g. for a reused redirect, only the redirect is linked
+	if token == "" {
+		return links
+	}
+
+	return append(links,
+		link{
+			Href: urlForCodeAndToken(mappedUrl, code, token),
+			Rel:  resourceName,
+			T:    http.MethodPatch,
+		},
+		link{
+			Href: urlForCodeAndToken(mappedUrl, code, token),
+			Rel:  resourceName,
+			T:    http.MethodDelete,
+		},
+	)
+}
+
+// optionalTime returns nil for the zero time to omit it in responses.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func New(log logr.Logger, domains map[string]string, health health.Service, adder adder.Service, lookup lookup.Service, updater updater.Service, invalidator invalidator.Service, restorer restorer.Service, ranker ranker.Service, scheduler scheduler.Service, paramFn ParamFn) Handler {
 	return &handler{
 		log:     log,
 		paramFn: paramFn,
+		domains: domains,
 
 		health:      health,
 		adder:       adder,
 		lookup:      lookup,
+		updater:     updater,
 		invalidator: invalidator,
+		restorer:    restorer,
+		ranker:      ranker,
+		scheduler:   scheduler,
 		// NOTE: not really sure if this is a good pattern with the lookup table,
 		// but it was taken from the original example.
 		converters: map[string]converter{
@@ -102,6 +252,18 @@ func New(log logr.Logger, health health.Service, adder adder.Service, lookup loo
 	}
 }
 
+// resolveDomain returns the domain of the request and the url its redirects
+// are mapped to. The requests to hosts that aren't configured are served by
+// the default domain.
+func (h *handler) resolveDomain(r *http.Request, mappingUrl string) (string, string) {
+	host := domain.Host(r.Host)
+	if mappedUrl, ok := h.domains[host]; ok {
+		return host, mappedUrl
+	}
+
+	return domain.Default, mappingUrl
+}
+
 // writeResponse is a helper function that write the necessary data to the response.
 func writeResponse(w http.ResponseWriter, contentType string, body []byte, statusCode int) error {
 	w.Header().Set(headerFieldContentType, contentType)
@@ -126,12 +288,12 @@ func writeApiError(w http.ResponseWriter, log logr.Logger, apiErr ApiError) {
 	return
 }
 
-// getIP returns the requestor's (could be proxied or direct or faked) ip address (either V4 or V6).
-func getIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-FORWARDED-FOR")
-	if forwarded != "" {
-		return forwarded
+// owner returns the id of the authenticated API key, empty for an anonymous
+// request.
+func owner(r *http.Request) string {
+	if key, ok := apikey.FromContext(r.Context()); ok {
+		return key.ID
 	}
 
-	return r.RemoteAddr
+	return ""
 }
@@ -0,0 +1,38 @@
+package stdlib
+
+import (
+	"errors"
+	"hex-microservice/restorer"
+	"net/http"
+)
+
+// RedirectRestore implements the "post" verb of the REST context that restores an invalidated redirect.
+func (h *handler) RedirectRestore(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, _ := h.resolveDomain(r, mappingUrl)
+
+		err := h.restorer.Restore(restorer.RedirectQuery{
+			Domain: d,
+			Code:   h.paramFn(r, UrlParameterCode),
+			Token:  h.paramFn(r, UrlParameterToken),
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+
+			switch {
+			case errors.Is(err, restorer.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, restorer.ErrWindowClosed):
+				status = http.StatusGone
+			default:
+				h.log.Error(err, "error restoring redirect", "code", h.paramFn(r, UrlParameterCode))
+			}
+
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
@@ -0,0 +1,53 @@
+package stdlib
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// scheduledResponse is a scheduled redirect that is returned to the client.
+type scheduledResponse struct {
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	NotBefore time.Time  `json:"not_before"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// RedirectScheduled implements the "get" verb of the REST context that lists the redirects that are not yet activated.
+func (h *handler) RedirectScheduled(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, _ := h.resolveDomain(r, mappingUrl)
+
+		scheduled, err := h.scheduler.Scheduled(d)
+		if err != nil {
+			h.log.Error(err, "Internal server error", "method", "RedirectScheduled")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		asResponse := make([]scheduledResponse, len(scheduled))
+		for i, s := range scheduled {
+			asResponse[i] = scheduledResponse{
+				Code:      s.Code,
+				URL:       s.URL,
+				CreatedAt: s.CreatedAt,
+				NotBefore: s.NotBefore,
+				ExpiresAt: optionalTime(s.ExpiresAt),
+			}
+		}
+
+		responseBody, err := json.Marshal(asResponse)
+		if err != nil {
+			h.log.Error(err, "marshalling response", "response", asResponse)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if err := writeResponse(w, contentTypeJson, responseBody, http.StatusOK); err != nil {
+			h.log.Error(err, "error writing the response to the response object")
+			return
+		}
+	}
+}
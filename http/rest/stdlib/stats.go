@@ -0,0 +1,34 @@
+package stdlib
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// statsResponse are the statistics of the code generation that are returned to the client.
+type statsResponse struct {
+	Collisions uint64 `json:"collisions"`
+	Exhausted  uint64 `json:"exhausted"`
+}
+
+// RedirectStats implements the "get" verb of the REST context that returns the statistics of the code generation.
+func (h *handler) RedirectStats(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := h.adder.Stats()
+
+		responseBody, err := json.Marshal(statsResponse{
+			Collisions: stats.Collisions,
+			Exhausted:  stats.Exhausted,
+		})
+		if err != nil {
+			h.log.Error(err, "marshalling response", "method", "RedirectStats")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if err := writeResponse(w, contentTypeJson, responseBody, http.StatusOK); err != nil {
+			h.log.Error(err, "error writing the response to the response object")
+			return
+		}
+	}
+}
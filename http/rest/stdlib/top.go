@@ -0,0 +1,73 @@
+package stdlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hex-microservice/ranker"
+	"net/http"
+	"strconv"
+)
+
+// topResponse is a ranked redirect that is returned to the client.
+type topResponse struct {
+	Code string `json:"code"`
+	URL  string `json:"url"`
+	Hits uint64 `json:"hits"`
+}
+
+// RedirectTop implements the "get" verb of the REST context that ranks the most visited redirects.
+func (h *handler) RedirectTop(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, _ := h.resolveDomain(r, mappingUrl)
+
+		limit := defaultTopLimit
+
+		if n := r.URL.Query().Get(UrlQueryLimit); n != "" {
+			var err error
+			if limit, err = strconv.Atoi(n); err != nil {
+				writeApiError(w, h.log, ApiError{
+					StatusCode: http.StatusBadRequest,
+					Title:      fmt.Sprintf(titleProcessingFieldFormat, UrlQueryLimit),
+				})
+				return
+			}
+		}
+
+		ranked, err := h.ranker.Top(ranker.RankingQuery{Domain: d, Limit: limit})
+		if err != nil {
+			if errors.Is(err, ranker.ErrQueryInvalid) {
+				writeApiError(w, h.log, ApiError{
+					StatusCode: http.StatusBadRequest,
+					Title:      fmt.Sprintf(titleProcessingFieldFormat, UrlQueryLimit),
+				})
+				return
+			}
+
+			h.log.Error(err, "Internal server error", "method", "RedirectTop")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		asResponse := make([]topResponse, len(ranked))
+		for i, r := range ranked {
+			asResponse[i] = topResponse{
+				Code: r.Code,
+				URL:  r.URL,
+				Hits: r.Hits,
+			}
+		}
+
+		responseBody, err := json.Marshal(asResponse)
+		if err != nil {
+			h.log.Error(err, "marshalling response", "response", asResponse)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if err := writeResponse(w, contentTypeJson, responseBody, http.StatusOK); err != nil {
+			h.log.Error(err, "error writing the response to the response object")
+			return
+		}
+	}
+}
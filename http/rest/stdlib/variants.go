@@ -0,0 +1,59 @@
+package stdlib
+
+import (
+	"encoding/json"
+	"errors"
+	"hex-microservice/ranker"
+	"net/http"
+)
+
+// variantResponse is a variant of a redirect with its hits that is returned to the client.
+type variantResponse struct {
+	Variant int    `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Hits    uint64 `json:"hits"`
+}
+
+// RedirectVariants implements the "get" verb of the REST context that compares the variants of a redirect.
+func (h *handler) RedirectVariants(mappingUrl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, _ := h.resolveDomain(r, mappingUrl)
+
+		code := h.paramFn(r, UrlParameterCode)
+
+		variants, err := h.ranker.Variants(d, code)
+		if err != nil {
+			if errors.Is(err, ranker.ErrNotFound) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+
+			h.log.Error(err, "Internal server error", "method", "RedirectVariants", UrlParameterCode, code)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		asResponse := make([]variantResponse, len(variants))
+		for i, v := range variants {
+			asResponse[i] = variantResponse{
+				Variant: v.Variant,
+				URL:     v.URL,
+				Weight:  v.Weight,
+				Hits:    v.Hits,
+			}
+		}
+
+		responseBody, err := json.Marshal(asResponse)
+		if err != nil {
+			h.log.Error(err, "marshalling response", "response", asResponse)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if err := writeResponse(w, contentTypeJson, responseBody, http.StatusOK); err != nil {
+			h.log.Error(err, "error writing the response to the response object")
+			return
+		}
+	}
+}
@@ -8,6 +8,8 @@ type RedirectStorage struct {
 
 // RedirectQuery is the request query of the invalidator service.
 type RedirectQuery struct {
-	Code  string
-	Token string
+	// Domain is the namespace of the code, empty for the default domain.
+	Domain string
+	Code   string
+	Token  string
 }
@@ -2,6 +2,8 @@ package invalidator
 
 import (
 	"errors"
+	"hex-microservice/event"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -12,7 +14,9 @@ var ErrNotFound = errors.New("redirect not found")
 // Repository defines the method the service expects from
 // a repository implementation.
 type Repository interface {
-	Invalidate(code, token string) error
+	// Invalidate deactivates the redirect of the domain with the matching
+	// token and records the point in time of the invalidation.
+	Invalidate(domain, code, token string, now time.Time) error
 }
 
 // Service describes the method the service offers.
@@ -27,21 +31,27 @@ type Service interface {
 type service struct {
 	logger     logr.Logger
 	repository Repository
+	events     event.Publisher
 }
 
 // New creates a new lookup service.
-func New(l logr.Logger, r Repository) Service {
+func New(l logr.Logger, r Repository, p event.Publisher) Service {
 	return &service{
 		logger:     l,
 		repository: r,
+		events:     p,
 	}
 }
 
 // Invalidate deletes a redirect by the given token.
 func (s *service) Invalidate(q RedirectQuery) error {
-	if err := s.repository.Invalidate(q.Code, q.Token); err != nil {
+	now := time.Now()
+
+	if err := s.repository.Invalidate(q.Domain, q.Code, q.Token, now); err != nil {
 		return err
 	}
 
+	s.events.Publish(event.Invalidated(q.Domain, q.Code, now))
+
 	return nil
 }
@@ -0,0 +1,5 @@
+// Package keystore contains the implementations of the API key store port.
+package keystore
+
+// Close releases the resources of a key store.
+type Close func() error
@@ -0,0 +1,86 @@
+package keystore_test
+
+import (
+	"context"
+	"errors"
+	"hex-microservice/apikey"
+	"hex-microservice/keystore"
+	"hex-microservice/keystore/memory"
+	"hex-microservice/keystore/sqlite"
+	repository "hex-microservice/repository/sqlite"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var storeImplementations = []struct {
+	name   string
+	config string
+	new    func(context.Context, string) (apikey.Store, keystore.Close, error)
+}{
+	{"memory", "", memory.New},
+	{"sqlite", "file:keystore?mode=memory&cache=shared", sqlite.New},
+}
+
+func TestStore(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	for _, impl := range storeImplementations {
+		impl := impl // pin
+
+		t.Run(impl.name, func(t *testing.T) {
+			store, close, err := impl.new(context.Background(), impl.config)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer close()
+
+			_, err = store.Get("unknown")
+			assert.True(t, errors.Is(err, apikey.ErrNotFound))
+			assert.True(t, errors.Is(store.Revoke("unknown", now), apikey.ErrNotFound))
+
+			first := apikey.Key{ID: "first", Name: "ci", Hash: "hash", CreatedAt: now}
+			second := apikey.Key{ID: "second", Name: "cli", Hash: "hash", CreatedAt: now}
+			assert.NoError(t, store.Add(first))
+			assert.NoError(t, store.Add(second))
+
+			if assert.NoError(t, store.Revoke(first.ID, now.Add(time.Minute))) {
+				// the first revocation is kept
+				assert.NoError(t, store.Revoke(first.ID, now.Add(time.Hour)))
+			}
+
+			key, err := store.Get(first.ID)
+			if assert.NoError(t, err) {
+				assert.False(t, key.Active())
+				assert.True(t, now.Add(time.Minute).Equal(key.RevokedAt))
+			}
+
+			keys, err := store.List()
+			if assert.NoError(t, err) && assert.Len(t, keys, 2) {
+				assert.Equal(t, first.ID, keys[0].ID)
+				assert.Equal(t, second.ID, keys[1].ID)
+				assert.True(t, keys[1].Active())
+				assert.True(t, now.Equal(keys[1].CreatedAt))
+			}
+		})
+	}
+}
+
+func TestSqliteSharesRepositoryDatabase(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "shortener.db")
+
+	_, closeRepository, err := repository.New(context.Background(), dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closeRepository()
+
+	store, closeStore, err := sqlite.New(context.Background(), dsn)
+	if assert.NoError(t, err) {
+		defer closeStore()
+
+		assert.NoError(t, store.Add(apikey.Key{ID: "shared", Name: "shared", Hash: "hash", CreatedAt: time.Now()}))
+	}
+}
@@ -0,0 +1,76 @@
+// Package memory offers a volatile key store, e.g. for testing.
+package memory
+
+import (
+	"context"
+	"hex-microservice/apikey"
+	"hex-microservice/keystore"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	keys map[string]apikey.Key
+	// order holds the ids in the order of their creation
+	order []string
+	m     sync.RWMutex
+}
+
+// New creates a new key store that keeps the keys in memory.
+func New(_ context.Context, _ string) (apikey.Store, keystore.Close, error) {
+	return &memoryStore{
+		keys: make(map[string]apikey.Key),
+	}, func() error { return nil }, nil
+}
+
+func (s *memoryStore) Add(key apikey.Key) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.keys[key.ID] = key
+	s.order = append(s.order, key.ID)
+
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (apikey.Key, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return apikey.Key{}, apikey.ErrNotFound
+	}
+
+	return key, nil
+}
+
+func (s *memoryStore) List() ([]apikey.Key, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	keys := make([]apikey.Key, 0, len(s.order))
+	for _, id := range s.order {
+		keys = append(keys, s.keys[id])
+	}
+
+	return keys, nil
+}
+
+func (s *memoryStore) Revoke(id string, now time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return apikey.ErrNotFound
+	}
+
+	// a revoked key keeps the point in time of its first revocation
+	if key.Active() {
+		key.RevokedAt = now
+		s.keys[id] = key
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+// Package sqlite offers a key store backed by the CGO sqlite driver. It may
+// share the database of the sqlite repository, its migrations are tracked in
+// an own table.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"hex-microservice/apikey"
+	"hex-microservice/keystore"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// migrationsTable keeps the migrations apart from the ones of the repository.
+const migrationsTable = "api_key_migrations"
+
+//go:embed migrations/*.sql
+var fs embed.FS
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// databaseUp migrates the database to the latest schema.
+func databaseUp(database *sql.DB) error {
+	d, err := iofs.New(fs, "migrations")
+	if err != nil {
+		return err
+	}
+
+	driver, err := sqlite.WithInstance(database, &sqlite.Config{MigrationsTable: migrationsTable})
+	if err != nil {
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", d, "sqlite", driver)
+	if err != nil {
+		return err
+	}
+
+	// an up to date database is fine
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+// New creates a new key store using sqlite as backend.
+func New(_ context.Context, url string) (apikey.Store, keystore.Close, error) {
+	dsn := strings.TrimPrefix(url, "sqlite://")
+	database, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := databaseUp(database); err != nil {
+		database.Close()
+		return nil, nil, err
+	}
+
+	return &sqliteStore{
+		db: database,
+	}, database.Close, nil
+}
+
+func (s *sqliteStore) Add(key apikey.Key) error {
+	_, err := s.db.Exec(`
+	INSERT INTO api_keys
+		(id, name, hash, created_at)
+	VALUES
+		(?, ?, ?, ?)
+	`, key.ID, key.Name, key.Hash, key.CreatedAt.UTC().Format(time.RFC3339))
+
+	return err
+}
+
+func (s *sqliteStore) Get(id string) (apikey.Key, error) {
+	row := s.db.QueryRow(`
+	SELECT
+		id, name, hash, created_at, revoked_at
+	FROM api_keys
+	WHERE
+		id = ?
+	`, id)
+
+	key, err := scan(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apikey.Key{}, apikey.ErrNotFound
+	}
+
+	return key, err
+}
+
+func (s *sqliteStore) List() ([]apikey.Key, error) {
+	rows, err := s.db.Query(`
+	SELECT
+		id, name, hash, created_at, revoked_at
+	FROM api_keys
+	ORDER BY
+		rowid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []apikey.Key
+	for rows.Next() {
+		key, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *sqliteStore) Revoke(id string, now time.Time) error {
+	// a revoked key keeps the point in time of its first revocation
+	result, err := s.db.Exec(`
+	UPDATE api_keys
+	SET
+		revoked_at = COALESCE(revoked_at, ?)
+	WHERE
+		id = ?
+	`, now.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return apikey.ErrNotFound
+	}
+
+	return nil
+}
+
+// scan reads a key from a row of the api_keys.
+func scan(row interface{ Scan(...any) error }) (apikey.Key, error) {
+	var (
+		key       apikey.Key
+		createdAt string
+		revokedAt sql.NullString
+	)
+
+	if err := row.Scan(&key.ID, &key.Name, &key.Hash, &createdAt, &revokedAt); err != nil {
+		return apikey.Key{}, err
+	}
+
+	var err error
+	if key.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return apikey.Key{}, err
+	}
+
+	if revokedAt.Valid {
+		if key.RevokedAt, err = time.Parse(time.RFC3339, revokedAt.String); err != nil {
+			return apikey.Key{}, err
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,98 @@
+package lookup
+
+import (
+	"hex-microservice/domain"
+	"sync"
+	"time"
+)
+
+// attempt counts the wrong passwords of a code within a window.
+type attempt struct {
+	count int
+	since time.Time
+}
+
+// attempts limits the wrong passwords per code. A code is blocked once the
+// limit is reached until its window is over.
+type attempts struct {
+	limit  int
+	window time.Duration
+
+	failed map[domain.Key]attempt
+	m      sync.Mutex
+}
+
+func newAttempts(limit int, window time.Duration) *attempts {
+	return &attempts{
+		limit:  limit,
+		window: window,
+		failed: make(map[domain.Key]attempt),
+	}
+}
+
+// current returns the attempt of the code, the lock must be held. An attempt
+// whose window is over is dropped.
+func (a *attempts) current(key domain.Key, now time.Time) (attempt, bool) {
+	failed, ok := a.failed[key]
+	if ok && !now.Before(failed.since.Add(a.window)) {
+		delete(a.failed, key)
+		return attempt{}, false
+	}
+
+	return failed, ok
+}
+
+// blocked reports whether the code reached the limit of wrong passwords.
+func (a *attempts) blocked(key domain.Key, now time.Time) bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	failed, _ := a.current(key, now)
+
+	return failed.count >= a.limit
+}
+
+// reserve counts an attempt of the code before its password is verified, so
+// that parallel attempts can't pass the limit. It reports false if the code
+// is blocked, a right password resets the attempts afterwards.
+func (a *attempts) reserve(key domain.Key, now time.Time) bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	failed, ok := a.current(key, now)
+	if failed.count >= a.limit {
+		return false
+	}
+
+	if !ok {
+		failed.since = now
+	}
+
+	failed.count++
+	a.failed[key] = failed
+
+	return true
+}
+
+// reset forgets the wrong passwords of the code.
+func (a *attempts) reset(key domain.Key) {
+	a.m.Lock()
+	delete(a.failed, key)
+	a.m.Unlock()
+}
+
+// cleanup drops the attempts whose window is over and returns their number.
+func (a *attempts) cleanup(now time.Time) int {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	n := 0
+	for key, failed := range a.failed {
+		if !now.Before(failed.since.Add(a.window)) {
+			delete(a.failed, key)
+			n++
+		}
+	}
+
+	return n
+}
@@ -4,8 +4,10 @@ package lookup
 
 func fromRedirectStorageToRedirectResult(i RedirectStorage) RedirectResult {
 	return RedirectResult{
-		Code:      i.Code,
-		URL:       i.URL,
-		CreatedAt: i.CreatedAt,
+		Code:       i.Code,
+		URL:        i.URL,
+		CreatedAt:  i.CreatedAt,
+		Preview:    i.Preview,
+		StatusCode: i.StatusCode,
 	}
 }
@@ -0,0 +1,88 @@
+package lookup
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// QueryConflict decides which values of a query parameter a passthrough
+// redirect keeps if the destination and the request both carry it.
+type QueryConflict string
+
+const (
+	// QueryDestination keeps the values of the destination.
+	QueryDestination QueryConflict = "destination"
+	// QueryRequest replaces the values of the destination by the values of
+	// the request.
+	QueryRequest QueryConflict = "request"
+	// QueryBoth appends the values of the request to the values of the
+	// destination.
+	QueryBoth QueryConflict = "both"
+)
+
+// DefaultQueryConflict is the rule that resolves the conflicting query
+// parameters by default.
+const DefaultQueryConflict = QueryDestination
+
+// QueryConflicts are the supported rules to resolve conflicting query
+// parameters.
+var QueryConflicts = []QueryConflict{QueryDestination, QueryRequest, QueryBoth}
+
+// String implements fmt.Stringer.
+func (c QueryConflict) String() string { return string(c) }
+
+// ReservedPaths are the paths below a code that the service serves itself,
+// e.g. the QR code of the redirect. They are never passed through.
+var ReservedPaths = []string{"qr", "variants"}
+
+// reserved reports whether the cleaned path is one of the ReservedPaths.
+func reserved(p string) bool {
+	cleaned := strings.TrimPrefix(path.Clean("/"+p), "/")
+	for _, r := range ReservedPaths {
+		if cleaned == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// passthrough appends the path to the destination and merges the query into
+// the query of the destination. The path is cleaned, so that it can't climb
+// above the path of the destination, a trailing slash is kept.
+func passthrough(destination, p string, query url.Values, conflict QueryConflict) (string, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if cleaned := path.Clean("/" + p); cleaned != "/" {
+		if strings.HasSuffix(p, "/") {
+			cleaned += "/"
+		}
+
+		u.Path = strings.TrimSuffix(u.Path, "/") + cleaned
+		u.RawPath = ""
+	}
+
+	if len(query) == 0 {
+		return u.String(), nil
+	}
+
+	merged := u.Query()
+	for key, values := range query {
+		_, conflicting := merged[key]
+
+		switch {
+		case !conflicting, conflict == QueryRequest:
+			merged[key] = values
+		case conflict == QueryBoth:
+			merged[key] = append(merged[key], values...)
+		}
+	}
+
+	u.RawQuery = merged.Encode()
+
+	return u.String(), nil
+}
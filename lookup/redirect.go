@@ -1,17 +1,56 @@
 package lookup
 
-import "time"
+import (
+	"hex-microservice/targeting"
+	"time"
+)
 
 // RedirectStorage is the storage view for the lookup service.
 type RedirectStorage struct {
 	Code      string
 	URL       string
 	CreatedAt time.Time
+	// Password is the hash of the password, empty if the redirect isn't
+	// protected.
+	Password string
+	// MaxUses limits the number of redirects, zero is unlimited. Uses counts
+	// the redirects of a limited redirect.
+	MaxUses int
+	Uses    int
+	// NotBefore is the zero time if the redirect is active immediately.
+	NotBefore time.Time
+	// Rules are the conditional destinations, the URL is the fallback.
+	Rules targeting.Rules
+	// Variants are the weighted destinations of an experiment.
+	Variants targeting.Variants
+	// Passthrough appends the path and merges the query of a request into
+	// the destination.
+	Passthrough bool
+	// Preview shows the preview page instead of redirecting.
+	Preview bool
+	// StatusCode is the status code of the redirect, zero for a redirect
+	// stored before the status codes were chosen.
+	StatusCode int
 }
 
 // RedirectQuery is the request query of the lookup service.
 type RedirectQuery struct {
-	Code string
+	// Domain is the namespace of the code, empty for the default domain.
+	Domain string
+	Code   string
+	// Password is the password of a protected redirect.
+	Password string
+	// Request are the attributes of the request the rules match on.
+	Request targeting.Request
+	// Variant is the number of the variant the visitor was served before,
+	// zero for a new visitor.
+	Variant int
+	// Path is the path of the request after the code, e.g. "docs/intro",
+	// it's passed to the destination of a passthrough redirect.
+	Path string
+	// Preview asks for the preview of the redirect, it neither consumes a
+	// use nor is it visited.
+	Preview bool
 }
 
 // RedirectResult is the result of the lookup service.
@@ -19,4 +58,25 @@ type RedirectResult struct {
 	Code      string
 	URL       string
 	CreatedAt time.Time
+	// PasswordRequired signals that the redirect is protected and the query
+	// lacks the password, the url is omitted.
+	PasswordRequired bool
+	// Scheduled signals that the redirect isn't activated yet, the url is
+	// the coming soon url.
+	Scheduled bool
+	// Variant is the number of the served variant of an experiment, zero
+	// if the redirect has no variants or a rule matched.
+	Variant int
+	// Preview signals that the redirect is always previewed, the preview is
+	// its visit.
+	Preview bool
+	// StatusCode is the status code of the redirect, zero if the client is
+	// redirected temporarily, e.g. to the coming soon url.
+	StatusCode int
+}
+
+// IsExpired reports if the expiry of a redirect lies before or at the given
+// point in time. The zero time never expires.
+func IsExpired(expiresAt, now time.Time) bool {
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
 }
@@ -2,25 +2,77 @@
 package lookup
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"hex-microservice/hashed"
+	"hex-microservice/targeting"
+	"math/rand"
+	"time"
 
 	"github.com/go-logr/logr"
 )
 
-// ErrNotFound signals that the desired redirect is not found
-var ErrNotFound = errors.New("redirect not found")
+var (
+	// ErrNotFound signals that the desired redirect is not found
+	ErrNotFound = errors.New("redirect not found")
+	// ErrWrongPassword signals that the password of a protected redirect is wrong
+	ErrWrongPassword = errors.New("wrong password")
+	// ErrTooManyAttempts signals that the code is blocked after too many wrong passwords
+	ErrTooManyAttempts = errors.New("too many wrong passwords")
+	// ErrExhausted signals that a redirect has no uses left
+	ErrExhausted = errors.New("redirect exhausted")
+)
+
+// default limit of the wrong passwords per code
+const (
+	DefaultAttemptLimit  = 5
+	DefaultAttemptWindow = 15 * time.Minute
+)
 
 // Repository defines the method the service expects from
 // a repository implementation.
 type Repository interface {
-	Lookup(code string) (RedirectStorage, error)
+	// Lookup returns the active redirect for the code of the domain.
+	// Redirects that are expired at the given point in time are reported as
+	// ErrNotFound.
+	Lookup(domain, code string, now time.Time) (RedirectStorage, error)
+	// Use consumes one use of a redirect with max uses, the check of the
+	// remaining uses and the consumption are atomic. A redirect without
+	// uses left is reported as ErrExhausted.
+	Use(domain, code string, now time.Time) error
 }
 
 // Service describes the method the service offers.
 type Service interface {
-	// Lookup takes a code to lookup a Redirect.
+	// Lookup takes a code to lookup a Redirect of the domain.
 	// Raises an error if no redirect is associated with that code.
+	// A protected redirect requires the password, without it the result
+	// signals that a password is required.
+	// Every lookup of a redirect with max uses consumes one use, a redirect
+	// without uses left raises ErrExhausted.
+	// A redirect before its activation is reported as ErrNotFound or, if
+	// configured, resolved to the coming soon url.
+	// The url is the destination of the first rule of the redirect that
+	// matches the request, a weighted variant or the url of the redirect
+	// otherwise. A visitor keeps the variant of the query.
+	// A passthrough redirect appends the path of the query and merges the
+	// query of the request into the destination, other redirects have no
+	// paths below their code. The ReservedPaths are not found.
+	// A preview resolves the destination without consuming a use or being
+	// visited, unless the redirect is always previewed. Then the preview is
+	// the visit. The preview of other redirects with max uses is reported as
+	// ErrNotFound, it would reveal the destination without using it up.
 	Lookup(q RedirectQuery) (RedirectResult, error)
+	// Exists reports ErrNotFound if the code of the domain has no active
+	// redirect, a scheduled redirect exists. It neither consumes a use nor
+	// is it visited.
+	Exists(domain, code string) error
+	// Run drops the wrong passwords whose window is over in the given interval
+	// until the context is done.
+	Run(ctx context.Context, interval time.Duration)
 }
 
 // service implements the Service interface and holds
@@ -28,23 +80,205 @@ type Service interface {
 type service struct {
 	logger     logr.Logger
 	repository Repository
+	events     event.Publisher
+	attempts   *attempts
+	comingSoon string
+	// queryConflict resolves the conflicting query parameters of a passthrough
+	queryConflict QueryConflict
+	// intn returns a random number in [0,n) for the choice of a variant
+	intn func(n int) int
+}
+
+// Option configures the optional behavior of the service.
+type Option func(*service)
+
+// WithAttemptLimit sets the number of wrong passwords per code within the
+// window, the code is blocked for the rest of the window afterwards.
+func WithAttemptLimit(limit int, window time.Duration) Option {
+	return func(s *service) {
+		s.attempts = newAttempts(limit, window)
+	}
+}
+
+// WithComingSoon sets the url the redirects resolve to before their
+// activation, they are not found by default.
+func WithComingSoon(url string) Option {
+	return func(s *service) {
+		s.comingSoon = url
+	}
+}
+
+// WithQueryConflict sets the rule that resolves a query parameter of a
+// passthrough redirect that the destination and the request both carry.
+func WithQueryConflict(conflict QueryConflict) Option {
+	return func(s *service) {
+		s.queryConflict = conflict
+	}
 }
 
-// New creates a new lookup service.
-func New(l logr.Logger, r Repository) Service {
-	return &service{
-		logger:     l,
-		repository: r,
+// New creates a new lookup service. Successful lookups are published as
+// visits, the publisher must therefore not block.
+func New(l logr.Logger, r Repository, p event.Publisher, opts ...Option) Service {
+	s := &service{
+		logger:        l,
+		repository:    r,
+		events:        p,
+		attempts:      newAttempts(DefaultAttemptLimit, DefaultAttemptWindow),
+		queryConflict: DefaultQueryConflict,
+		intn:          rand.Intn,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
 // Lookup resolves a given code to a redirect
 func (s *service) Lookup(q RedirectQuery) (RedirectResult, error) {
 	var r RedirectResult
-	stored, err := s.repository.Lookup(q.Code)
+	now := time.Now()
+
+	stored, err := s.repository.Lookup(q.Domain, q.Code, now)
 	if err != nil {
 		return r, err
 	}
 
-	return fromRedirectStorageToRedirectResult(stored), nil
+	if q.Path != "" && !stored.Passthrough {
+		return r, fmt.Errorf("service.Lookup path %s without passthrough: %w", q.Path, ErrNotFound)
+	}
+
+	// a router may pass e.g. "qr/" instead of serving the QR code
+	if q.Path != "" && reserved(q.Path) {
+		return r, fmt.Errorf("service.Lookup reserved path %s: %w", q.Path, ErrNotFound)
+	}
+
+	// a scheduled redirect is neither visited nor does it consume a use
+	if now.Before(stored.NotBefore) {
+		if s.comingSoon == "" {
+			return r, fmt.Errorf("service.Lookup not activated before %s: %w", stored.NotBefore, ErrNotFound)
+		}
+
+		return RedirectResult{Code: stored.Code, URL: s.comingSoon, Scheduled: true}, nil
+	}
+
+	// an exhausted redirect doesn't ask for the password
+	if stored.MaxUses > 0 && stored.Uses >= stored.MaxUses {
+		return r, fmt.Errorf("service.Lookup: %w", ErrExhausted)
+	}
+
+	// the preview of a redirect that is always previewed is its visit
+	visit := !q.Preview || stored.Preview
+	if !visit && stored.MaxUses > 0 {
+		return r, fmt.Errorf("service.Lookup preview with max uses: %w", ErrNotFound)
+	}
+
+	if stored.Password != "" {
+		if err := s.challenge(q.Domain, stored, q.Password, now); err != nil || q.Password == "" {
+			return RedirectResult{Code: stored.Code, PasswordRequired: true}, err
+		}
+	}
+
+	// the lookup before is no reservation, concurrent lookups race for the
+	// last use
+	if visit && stored.MaxUses > 0 {
+		if err := s.repository.Use(q.Domain, stored.Code, now); err != nil {
+			return r, fmt.Errorf("service.Lookup: %w", err)
+		}
+	}
+
+	result := fromRedirectStorageToRedirectResult(stored)
+	if url, ok := stored.Rules.Destination(q.Request); ok {
+		result.URL = url
+	} else if len(stored.Variants) > 0 {
+		result.Variant = s.variant(stored.Variants, q.Variant)
+		result.URL = stored.Variants[result.Variant-1].URL
+	}
+
+	if stored.Passthrough {
+		if result.URL, err = passthrough(result.URL, q.Path, q.Request.Query, s.queryConflict); err != nil {
+			return r, fmt.Errorf("service.Lookup passthrough: %w", err)
+		}
+	}
+
+	if visit {
+		visited := event.Visited(q.Domain, stored.Code, now)
+		visited.Variant = result.Variant
+		s.events.Publish(visited)
+	}
+
+	return result, nil
+}
+
+// Exists checks whether the code of the domain has a redirect
+func (s *service) Exists(domain, code string) error {
+	if _, err := s.repository.Lookup(domain, code, time.Now()); err != nil {
+		return fmt.Errorf("service.Exists: %w", err)
+	}
+
+	return nil
+}
+
+// variant returns the number of the variant the visitor is served. The
+// variant of a returning visitor is kept, a new visitor gets a variant
+// chosen by the weights.
+func (s *service) variant(variants targeting.Variants, served int) int {
+	if served >= 1 && served <= len(variants) {
+		return served
+	}
+
+	// the weights of the variants stored before their limits could overflow
+	total := variants.TotalWeight()
+	if total < 1 {
+		return 1
+	}
+
+	return variants.Pick(s.intn(total))
+}
+
+// challenge checks the password of a protected redirect. A missing password
+// is no attempt, but a blocked code is reported nevertheless. The attempt is
+// counted before the password is verified and forgotten if it's right.
+func (s *service) challenge(d string, stored RedirectStorage, password string, now time.Time) error {
+	key := domain.Key{Domain: d, Code: stored.Code}
+
+	if password == "" {
+		if s.attempts.blocked(key, now) {
+			return fmt.Errorf("service.Lookup: %w", ErrTooManyAttempts)
+		}
+
+		return nil
+	}
+
+	if !s.attempts.reserve(key, now) {
+		return fmt.Errorf("service.Lookup: %w", ErrTooManyAttempts)
+	}
+
+	if !hashed.VerifyPassword(stored.Password, password) {
+		s.logger.V(1).Info("wrong password", "domain", d, "code", stored.Code)
+
+		return fmt.Errorf("service.Lookup: %w", ErrWrongPassword)
+	}
+
+	s.attempts.reset(key)
+
+	return nil
+}
+
+// Run is the implementation for Service#Run.
+func (s *service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if n := s.attempts.cleanup(now); n > 0 {
+				s.logger.V(1).Info("dropped the wrong passwords of the past windows", "count", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
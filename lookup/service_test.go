@@ -0,0 +1,401 @@
+package lookup
+
+import (
+	"errors"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"hex-microservice/hashed"
+	"hex-microservice/targeting"
+	"io"
+	"log"
+	"math"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+// storedRepository holds a single redirect of the default domain.
+type storedRepository RedirectStorage
+
+func (r *storedRepository) Lookup(d, code string, _ time.Time) (RedirectStorage, error) {
+	if d != domain.Default || code != r.Code {
+		return RedirectStorage{}, ErrNotFound
+	}
+
+	return RedirectStorage(*r), nil
+}
+
+func (r *storedRepository) Use(d, code string, _ time.Time) error {
+	if d != domain.Default || code != r.Code {
+		return ErrNotFound
+	}
+
+	if r.MaxUses > 0 && r.Uses >= r.MaxUses {
+		return ErrExhausted
+	}
+
+	r.Uses++
+
+	return nil
+}
+
+type discardingPublisher struct{}
+
+func (discardingPublisher) Publish(...event.Event) {}
+
+func TestLookupProtected(t *testing.T) {
+	const (
+		code     = "code"
+		url      = "https://example.com/"
+		password = "secret"
+	)
+
+	hashedPassword, err := hashed.Password(password)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s := New(discardingLogger, &storedRepository{Code: code, URL: url, Password: hashedPassword}, discardingPublisher{},
+		WithAttemptLimit(2, time.Hour))
+
+	result, err := s.Lookup(RedirectQuery{Code: code})
+	if assert.NoError(t, err) {
+		assert.True(t, result.PasswordRequired)
+		assert.Empty(t, result.URL)
+	}
+
+	result, err = s.Lookup(RedirectQuery{Code: code, Password: password})
+	if assert.NoError(t, err) {
+		assert.False(t, result.PasswordRequired)
+		assert.Equal(t, url, result.URL)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = s.Lookup(RedirectQuery{Code: code, Password: "wrong"})
+		assert.ErrorIs(t, err, ErrWrongPassword)
+	}
+
+	// the code is blocked even for the right password
+	result, err = s.Lookup(RedirectQuery{Code: code, Password: password})
+	if assert.ErrorIs(t, err, ErrTooManyAttempts) {
+		assert.Empty(t, result.URL)
+	}
+}
+
+func TestLookupMaxUses(t *testing.T) {
+	const (
+		code = "code"
+		url  = "https://example.com/"
+	)
+
+	repository := &storedRepository{Code: code, URL: url, MaxUses: 2}
+	s := New(discardingLogger, repository, discardingPublisher{})
+
+	for i := 0; i < 2; i++ {
+		result, err := s.Lookup(RedirectQuery{Code: code})
+		if assert.NoError(t, err) {
+			assert.Equal(t, url, result.URL)
+		}
+	}
+
+	_, err := s.Lookup(RedirectQuery{Code: code})
+	assert.ErrorIs(t, err, ErrExhausted)
+	assert.Equal(t, 2, repository.Uses)
+}
+
+func TestLookupScheduled(t *testing.T) {
+	const (
+		code       = "code"
+		url        = "https://example.com/"
+		comingSoon = "https://example.com/soon"
+	)
+
+	repository := &storedRepository{Code: code, URL: url, MaxUses: 1, NotBefore: time.Now().Add(time.Hour)}
+
+	_, err := New(discardingLogger, repository, discardingPublisher{}).Lookup(RedirectQuery{Code: code})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	result, err := New(discardingLogger, repository, discardingPublisher{}, WithComingSoon(comingSoon)).Lookup(RedirectQuery{Code: code})
+	if assert.NoError(t, err) {
+		assert.True(t, result.Scheduled)
+		assert.Equal(t, comingSoon, result.URL)
+	}
+
+	// a scheduled redirect doesn't consume a use
+	assert.Zero(t, repository.Uses)
+}
+
+func TestLookupRules(t *testing.T) {
+	const (
+		code = "code"
+		url  = "https://example.com/"
+	)
+
+	repository := &storedRepository{Code: code, URL: url, Rules: targeting.Rules{
+		{Language: "de", URL: "https://example.com/de"},
+	}}
+	s := New(discardingLogger, repository, discardingPublisher{})
+
+	result, err := s.Lookup(RedirectQuery{Code: code, Request: targeting.Request{AcceptLanguage: "de-DE"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://example.com/de", result.URL)
+	}
+
+	result, err = s.Lookup(RedirectQuery{Code: code, Request: targeting.Request{AcceptLanguage: "en"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, url, result.URL)
+	}
+}
+
+// recordingPublisher records the published events.
+type recordingPublisher struct {
+	events []event.Event
+}
+
+func (p *recordingPublisher) Publish(events ...event.Event) {
+	p.events = append(p.events, events...)
+}
+
+func TestLookupVariants(t *testing.T) {
+	const code = "code"
+
+	repository := &storedRepository{Code: code, URL: "https://example.com/", Variants: targeting.Variants{
+		{URL: "https://example.com/a", Weight: 70},
+		{URL: "https://example.com/b", Weight: 30},
+	}}
+	publisher := &recordingPublisher{}
+	s := New(discardingLogger, repository, publisher).(*service)
+	s.intn = func(n int) int { return n - 1 }
+
+	// a new visitor gets a variant by weight
+	result, err := s.Lookup(RedirectQuery{Code: code})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, result.Variant)
+		assert.Equal(t, "https://example.com/b", result.URL)
+	}
+
+	// a returning visitor keeps the variant
+	result, err = s.Lookup(RedirectQuery{Code: code, Variant: 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, result.Variant)
+		assert.Equal(t, "https://example.com/a", result.URL)
+	}
+
+	// an unknown variant is chosen anew
+	result, err = s.Lookup(RedirectQuery{Code: code, Variant: 3})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, result.Variant)
+	}
+
+	if assert.Len(t, publisher.events, 3) {
+		assert.Equal(t, 2, publisher.events[0].Variant)
+		assert.Equal(t, 1, publisher.events[1].Variant)
+	}
+}
+
+func TestLookupVariantsOverflowingWeights(t *testing.T) {
+	const code = "code"
+
+	// stored before the weights were limited, the total weight overflows
+	repository := &storedRepository{Code: code, URL: "https://example.com/", Variants: targeting.Variants{
+		{URL: "https://example.com/a", Weight: math.MaxInt},
+		{URL: "https://example.com/b", Weight: math.MaxInt},
+	}}
+	s := New(discardingLogger, repository, discardingPublisher{})
+
+	result, err := s.Lookup(RedirectQuery{Code: code})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, result.Variant)
+	}
+}
+
+func TestLookupPassthrough(t *testing.T) {
+	const code = "code"
+
+	repository := &storedRepository{Code: code, URL: "https://example.com/docs?lang=en", Passthrough: true}
+	query := url.Values{"lang": {"de"}, "utm_source": {"x"}}
+
+	for _, tt := range []struct {
+		conflict QueryConflict
+		path     string
+		expected string
+	}{
+		{conflict: QueryDestination, path: "intro", expected: "https://example.com/docs/intro?lang=en&utm_source=x"},
+		{conflict: QueryRequest, path: "intro/", expected: "https://example.com/docs/intro/?lang=de&utm_source=x"},
+		{conflict: QueryBoth, path: "../../intro", expected: "https://example.com/docs/intro?lang=en&lang=de&utm_source=x"},
+	} {
+		s := New(discardingLogger, repository, discardingPublisher{}, WithQueryConflict(tt.conflict))
+
+		result, err := s.Lookup(RedirectQuery{Code: code, Path: tt.path, Request: targeting.Request{Query: query}})
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.expected, result.URL, tt.conflict)
+		}
+	}
+
+	// the reserved paths are never passed through
+	s := New(discardingLogger, repository, discardingPublisher{})
+	for _, path := range []string{"qr", "qr/", "variants", "docs/../variants"} {
+		_, err := s.Lookup(RedirectQuery{Code: code, Path: path})
+		assert.ErrorIs(t, err, ErrNotFound, path)
+	}
+
+	if result, err := s.Lookup(RedirectQuery{Code: code, Path: "qr/codes"}); assert.NoError(t, err) {
+		assert.Equal(t, "https://example.com/docs/qr/codes?lang=en", result.URL)
+	}
+
+	// a redirect without passthrough has no paths below its code
+	repository.Passthrough = false
+
+	_, err := s.Lookup(RedirectQuery{Code: code, Path: "intro"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	result, err := s.Lookup(RedirectQuery{Code: code, Request: targeting.Request{Query: query}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, repository.URL, result.URL)
+	}
+}
+
+func TestLookupPreview(t *testing.T) {
+	const (
+		code = "code"
+		url  = "https://example.com/"
+	)
+
+	repository := &storedRepository{Code: code, URL: url}
+	publisher := &recordingPublisher{}
+	s := New(discardingLogger, repository, publisher)
+
+	// a preview isn't visited
+	result, err := s.Lookup(RedirectQuery{Code: code, Preview: true})
+	if assert.NoError(t, err) {
+		assert.False(t, result.Preview)
+		assert.Equal(t, url, result.URL)
+	}
+
+	assert.Empty(t, publisher.events)
+
+	// a redirect with max uses has no preview
+	repository.MaxUses = 1
+
+	_, err = s.Lookup(RedirectQuery{Code: code, Preview: true})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 0, repository.Uses)
+	assert.Empty(t, publisher.events)
+
+	// the preview of a redirect that is always previewed is its visit
+	repository.Preview = true
+
+	result, err = s.Lookup(RedirectQuery{Code: code, Preview: true})
+	if assert.NoError(t, err) {
+		assert.True(t, result.Preview)
+	}
+
+	assert.Equal(t, 1, repository.Uses)
+	assert.Len(t, publisher.events, 1)
+}
+
+func TestExists(t *testing.T) {
+	const code = "code"
+
+	repository := &storedRepository{Code: code, URL: "https://example.com/", MaxUses: 1, NotBefore: time.Now().Add(time.Hour)}
+	publisher := &recordingPublisher{}
+	s := New(discardingLogger, repository, publisher)
+
+	// a scheduled redirect exists, the check is no visit
+	assert.NoError(t, s.Exists(domain.Default, code))
+	assert.ErrorIs(t, s.Exists(domain.Default, "unknown"), ErrNotFound)
+	assert.Equal(t, 0, repository.Uses)
+	assert.Empty(t, publisher.events)
+}
+
+func TestLookupDomain(t *testing.T) {
+	const code = "code"
+
+	publisher := &recordingPublisher{}
+	s := New(discardingLogger, &storedRepository{Code: code, URL: "https://example.com/"}, publisher)
+
+	// the code of the default domain is unknown on other domains
+	_, err := s.Lookup(RedirectQuery{Domain: "go.example", Code: code})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = s.Lookup(RedirectQuery{Code: code})
+	if assert.NoError(t, err) && assert.Len(t, publisher.events, 1) {
+		assert.Equal(t, domain.Default, publisher.events[0].Domain)
+	}
+}
+
+func TestAttemptsWindow(t *testing.T) {
+	now := time.Now()
+	a := newAttempts(1, time.Minute)
+
+	code := domain.Key{Code: "code"}
+
+	assert.True(t, a.reserve(code, now))
+	assert.False(t, a.reserve(code, now))
+	assert.True(t, a.blocked(code, now))
+	assert.False(t, a.blocked(domain.Key{Code: "other"}, now))
+	assert.False(t, a.blocked(domain.Key{Domain: "go.example", Code: "code"}, now))
+	assert.False(t, a.blocked(code, now.Add(time.Minute)))
+
+	a.reserve(code, now)
+	a.reset(code)
+	assert.False(t, a.blocked(code, now))
+
+	a.reserve(code, now)
+	assert.Equal(t, 0, a.cleanup(now))
+	assert.Equal(t, 1, a.cleanup(now.Add(time.Minute)))
+	assert.Empty(t, a.failed)
+}
+
+func TestLookupProtectedParallel(t *testing.T) {
+	const (
+		code     = "code"
+		password = "secret"
+		limit    = 3
+	)
+
+	hashedPassword, err := hashed.Password(password)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s := New(discardingLogger, &storedRepository{Code: code, URL: "https://example.com/", Password: hashedPassword}, discardingPublisher{},
+		WithAttemptLimit(limit, time.Hour))
+
+	var (
+		wg    sync.WaitGroup
+		wrong int32
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := s.Lookup(RedirectQuery{Code: code, Password: "wrong"}); errors.Is(err, ErrWrongPassword) {
+				atomic.AddInt32(&wrong, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// the parallel guesses are verified no more often than the limit
+	assert.Equal(t, int32(limit), wrong)
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, IsExpired(time.Time{}, now))
+	assert.False(t, IsExpired(now.Add(time.Second), now))
+	assert.True(t, IsExpired(now, now))
+	assert.True(t, IsExpired(now.Add(-time.Second), now))
+}
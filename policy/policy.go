@@ -0,0 +1,235 @@
+// Package policy offers the rules the destination urls of the redirects
+// have to comply with.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"hex-microservice/canonical"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrViolation signals that a url doesn't comply with the policy.
+var ErrViolation = errors.New("policy violation")
+
+// DefaultSchemes are the allowed schemes if the rules don't name any.
+var DefaultSchemes = []string{"http", "https"}
+
+// Rules are the user defined rules of a policy. A domain pattern is either
+// a domain that matches exactly or a wildcard like "*.example.com" that
+// matches every subdomain.
+type Rules struct {
+	// Schemes are the allowed schemes, DefaultSchemes if empty.
+	Schemes []string `mapstructure:"schemes"`
+	// Allow are the allowed domains, every domain is allowed if empty.
+	Allow []string `mapstructure:"allow"`
+	// Deny are the denied domains, they win over the allowed domains.
+	Deny []string `mapstructure:"deny"`
+	// AllowPrivate allows private, loopback and link-local ip addresses
+	// as well as localhost.
+	AllowPrivate bool `mapstructure:"allowprivate"`
+}
+
+// Policy checks the urls against the rules.
+type Policy struct {
+	schemes map[string]struct{}
+	allow   []string
+	deny    []string
+	private bool
+	// self are the hosts of the service itself, a redirect to them is a loop
+	self map[string]struct{}
+}
+
+// New creates a policy of the rules, the self urls are the urls the service
+// is reachable at.
+func New(rules Rules, self ...string) (*Policy, error) {
+	schemes := rules.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+
+	p := &Policy{
+		schemes: make(map[string]struct{}, len(schemes)),
+		allow:   lowered(rules.Allow),
+		deny:    lowered(rules.Deny),
+		private: rules.AllowPrivate,
+		self:    make(map[string]struct{}, len(self)),
+	}
+
+	for _, scheme := range schemes {
+		p.schemes[strings.ToLower(scheme)] = struct{}{}
+	}
+
+	for _, s := range self {
+		if s == "" {
+			continue
+		}
+
+		canonicalSelf, err := canonical.URL(s)
+		if err != nil {
+			return nil, fmt.Errorf("policy.New self url: %w", err)
+		}
+
+		u, err := url.Parse(canonicalSelf)
+		if err != nil {
+			return nil, fmt.Errorf("policy.New self url: %w", err)
+		}
+
+		p.self[hostKey(u)] = struct{}{}
+	}
+
+	return p, nil
+}
+
+// Check returns an error wrapping ErrViolation if the url doesn't comply
+// with the policy. Host names are not resolved, only ip addresses given
+// literally are checked for private networks. The host is normalized before,
+// see normalizedHost.
+func (p *Policy) Check(raw string) error {
+	canonicalURL, err := canonical.URL(raw)
+	if err != nil {
+		return fmt.Errorf("policy.Check: %v: %w", err, ErrViolation)
+	}
+
+	u, err := url.Parse(canonicalURL)
+	if err != nil {
+		return fmt.Errorf("policy.Check: %v: %w", err, ErrViolation)
+	}
+
+	if _, ok := p.schemes[u.Scheme]; !ok {
+		return fmt.Errorf("policy.Check scheme %q not allowed: %w", u.Scheme, ErrViolation)
+	}
+
+	if _, ok := p.self[hostKey(u)]; ok {
+		return fmt.Errorf("policy.Check redirect to the service itself: %w", ErrViolation)
+	}
+
+	host := normalizedHost(u.Hostname())
+
+	if !p.private && private(host) {
+		return fmt.Errorf("policy.Check private host %q: %w", host, ErrViolation)
+	}
+
+	if matchesAny(p.deny, host) {
+		return fmt.Errorf("policy.Check denied domain %q: %w", host, ErrViolation)
+	}
+
+	if len(p.allow) > 0 && !matchesAny(p.allow, host) {
+		return fmt.Errorf("policy.Check domain %q not allowed: %w", host, ErrViolation)
+	}
+
+	return nil
+}
+
+// hostKey returns the normalized host of the url with its port.
+func hostKey(u *url.URL) string {
+	host := normalizedHost(u.Hostname())
+	if port := u.Port(); port != "" {
+		return net.JoinHostPort(host, port)
+	}
+
+	return host
+}
+
+// normalizedHost returns the host without the trailing dot of a fully
+// qualified domain name, e.g. "example.com." is "example.com". The numeric
+// forms of an IPv4 address that browsers accept are returned as dotted
+// decimal, e.g. "2130706433", "0x7f000001" and "0177.0.0.1" are "127.0.0.1".
+func normalizedHost(host string) string {
+	host = strings.TrimRight(host, ".")
+
+	if ip, ok := numericIPv4(host); ok {
+		return ip.String()
+	}
+
+	return host
+}
+
+// numericIPv4 parses the host as IPv4 address of one to four decimal, octal
+// (leading 0) or hexadecimal (leading 0x) parts, the last part fills the
+// remaining bytes.
+func numericIPv4(host string) (net.IP, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) > net.IPv4len {
+		return nil, false
+	}
+
+	var ip uint64
+	for i, part := range parts {
+		base := 10
+		switch {
+		case len(part) > 1 && (strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X")):
+			part, base = part[2:], 16
+		case len(part) > 1 && strings.HasPrefix(part, "0"):
+			part, base = part[1:], 8
+		}
+
+		value, err := strconv.ParseUint(part, base, 32)
+		if err != nil {
+			return nil, false
+		}
+
+		// the last part fills the remaining bytes, the others one byte each
+		bits := 8
+		if i == len(parts)-1 {
+			bits = 8 * (net.IPv4len - i)
+		}
+
+		if value >= 1<<bits {
+			return nil, false
+		}
+
+		ip = ip<<bits | value
+	}
+
+	return net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)), true
+}
+
+// private reports whether the host is localhost or an ip address that isn't
+// publicly routable.
+func private(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// matchesAny reports whether the host matches one of the domain patterns.
+func matchesAny(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			suffix := strings.TrimPrefix(pattern, "*")
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+
+			continue
+		}
+
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lowered returns the patterns in lowercase.
+func lowered(patterns []string) []string {
+	result := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		result[i] = strings.ToLower(pattern)
+	}
+
+	return result
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	p, err := New(Rules{
+		Schemes: []string{"https"},
+		Allow:   []string{"example.com", "*.example.org"},
+		Deny:    []string{"blocked.example.org"},
+	}, "https://short.example.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, tc := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/path", true},
+		{"https://EXAMPLE.com", true},
+		{"https://www.example.org/", true},
+		{"https://a.b.example.org/", true},
+		{"https://example.org/", false},
+		{"https://blocked.example.org/", false},
+		{"https://blocked.example.org./", false},
+		{"https://example.com./", true},
+		{"https://www.example.com/", false},
+		{"http://example.com/", false},
+		{"ftp://example.com/", false},
+		{"not a url", false},
+	} {
+		err := p.Check(tc.url)
+		if tc.allowed {
+			assert.NoError(t, err, tc.url)
+		} else {
+			assert.ErrorIs(t, err, ErrViolation, tc.url)
+		}
+	}
+}
+
+func TestCheckPrivate(t *testing.T) {
+	p, err := New(Rules{}, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, url := range []string{
+		"http://localhost/",
+		"http://api.localhost:8080/",
+		"http://127.0.0.1/",
+		"http://10.1.2.3/",
+		"http://192.168.0.1/",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/",
+		"http://0.0.0.0/",
+		// the numeric forms of the loopback address
+		"http://2130706433/",
+		"http://0x7f000001/",
+		"http://0177.0.0.1/",
+		"http://0x7f.1/",
+		"http://127.1/",
+		"http://localhost./",
+		"http://10.1.2.3./",
+	} {
+		assert.ErrorIs(t, p.Check(url), ErrViolation, url)
+	}
+
+	assert.NoError(t, p.Check("http://93.184.216.34/"))
+	assert.NoError(t, p.Check("http://1572395042/"))
+	assert.NoError(t, p.Check("http://1.example/"))
+
+	p, err = New(Rules{AllowPrivate: true}, "")
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.Check("http://localhost/"))
+		assert.NoError(t, p.Check("http://10.1.2.3/"))
+	}
+}
+
+func TestCheckSelf(t *testing.T) {
+	p, err := New(Rules{}, "https://short.example.com:443")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.ErrorIs(t, p.Check("https://SHORT.example.com/abc"), ErrViolation)
+	assert.ErrorIs(t, p.Check("https://short.example.com./abc"), ErrViolation)
+	assert.NoError(t, p.Check("https://short.example.com:8443/abc"))
+	assert.NoError(t, p.Check("https://example.com/"))
+
+	// every domain of the service is a loop
+	p, err = New(Rules{}, "https://short.example.com", "https://go.example")
+	if assert.NoError(t, err) {
+		assert.ErrorIs(t, p.Check("https://go.example/abc"), ErrViolation)
+	}
+}
@@ -0,0 +1,165 @@
+package projection
+
+import (
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/targeting"
+	"sort"
+	"sync"
+	"time"
+)
+
+type visitedRedirect struct {
+	URL string
+	// Protected redirects aren't ranked, their urls are secret
+	Protected bool
+	ExpiresAt time.Time
+	Hits      uint64
+	Variants  targeting.Variants
+	// VariantHits are the hits per variant, indexed by the variant number - 1
+	VariantHits []uint64
+	// InvalidatedAt is the point in time of the invalidation, the zero time
+	// for an active redirect.
+	InvalidatedAt time.Time
+}
+
+// Hits is the projection of the hits of the active redirects. It serves as
+// repository for the ranker service.
+type Hits struct {
+	visited map[domain.Key]visitedRedirect
+	// invalidated keeps the hits of the invalidated redirects for a restore
+	invalidated map[domain.Key]visitedRedirect
+	m           sync.RWMutex
+}
+
+// NewHits creates an empty projection of the hits.
+func NewHits() *Hits {
+	return &Hits{
+		visited:     make(map[domain.Key]visitedRedirect),
+		invalidated: make(map[domain.Key]visitedRedirect),
+	}
+}
+
+// Handle applies the event to the projection.
+func (p *Hits) Handle(e event.Event) {
+	key := domain.Key{Domain: e.Domain, Code: e.Code}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	switch e.Type {
+	case event.RedirectCreated:
+		p.visited[key] = visitedRedirect{
+			URL:         e.URL,
+			Protected:   e.Password != "",
+			ExpiresAt:   e.ExpiresAt,
+			Variants:    e.Variants,
+			VariantHits: make([]uint64, len(e.Variants)),
+		}
+	case event.RedirectUpdated:
+		if red, ok := p.visited[key]; ok {
+			red.URL = e.URL
+			p.visited[key] = red
+		}
+	case event.RedirectInvalidated:
+		if red, ok := p.visited[key]; ok {
+			red.InvalidatedAt = e.OccurredAt
+			p.invalidated[key] = red
+			delete(p.visited, key)
+		}
+	case event.RedirectRestored:
+		if red, ok := p.invalidated[key]; ok {
+			red.InvalidatedAt = time.Time{}
+			p.visited[key] = red
+			delete(p.invalidated, key)
+		}
+	case event.RedirectVisited:
+		if red, ok := p.visited[key]; ok {
+			red.Hits++
+			if e.Variant >= 1 && e.Variant <= len(red.VariantHits) {
+				red.VariantHits[e.Variant-1]++
+			}
+			p.visited[key] = red
+		}
+	}
+}
+
+// Top is the implementation for ranker.Repository#Top.
+func (p *Hits) Top(d string, limit int, now time.Time) ([]ranker.RedirectStorage, error) {
+	p.m.RLock()
+	top := make([]ranker.RedirectStorage, 0, len(p.visited))
+	for key, red := range p.visited {
+		if key.Domain == d && !red.Protected && !lookup.IsExpired(red.ExpiresAt, now) {
+			top = append(top, ranker.RedirectStorage{
+				Code: key.Code,
+				URL:  red.URL,
+				Hits: red.Hits,
+			})
+		}
+	}
+	p.m.RUnlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Hits != top[j].Hits {
+			return top[i].Hits > top[j].Hits
+		}
+
+		return top[i].Code < top[j].Code
+	})
+
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top, nil
+}
+
+// Variants is the implementation for ranker.Repository#Variants.
+func (p *Hits) Variants(d, code string, now time.Time) ([]ranker.VariantStorage, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	red, ok := p.visited[domain.Key{Domain: d, Code: code}]
+	if !ok || red.Protected || lookup.IsExpired(red.ExpiresAt, now) {
+		return nil, ranker.ErrNotFound
+	}
+
+	variants := make([]ranker.VariantStorage, len(red.Variants))
+	for i, v := range red.Variants {
+		variants[i] = ranker.VariantStorage{
+			Variant: i + 1,
+			URL:     v.URL,
+			Weight:  v.Weight,
+			Hits:    red.VariantHits[i],
+		}
+	}
+
+	return variants, nil
+}
+
+// Purge is the implementation for purger.Repository#Purge, it drops the
+// hits of the invalidated redirects that can't be restored anymore and of the
+// redirects that expired before the point in time.
+func (p *Hits) Purge(before time.Time) (int, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := 0
+	for key, red := range p.invalidated {
+		if red.InvalidatedAt.Before(before) {
+			delete(p.invalidated, key)
+			n++
+		}
+	}
+
+	for key, red := range p.visited {
+		if lookup.IsExpired(red.ExpiresAt, before) {
+			delete(p.visited, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
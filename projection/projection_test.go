@@ -0,0 +1,184 @@
+package projection
+
+import (
+	"errors"
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"hex-microservice/lookup"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirects(t *testing.T) {
+	p := NewRedirects()
+	now := time.Now()
+
+	p.Handle(event.Created(domain.Default, "a", "http://a.test", time.Time{}, now))
+	p.Handle(event.Created(domain.Default, "b", "http://b.test", now.Add(time.Minute), now))
+	p.Handle(event.Created(domain.Default, "c", "http://c.test", time.Time{}, now))
+	p.Handle(event.Invalidated(domain.Default, "c", now))
+	p.Handle(event.Updated(domain.Default, "a", "http://a.example", now))
+	p.Handle(event.Created("go.example", "a", "http://go.test", time.Time{}, now))
+
+	if red, err := p.Lookup(domain.Default, "a", now); assert.NoError(t, err) {
+		assert.Equal(t, "http://a.example", red.URL)
+		assert.Equal(t, now, red.CreatedAt)
+	}
+
+	// the domains have their own codes
+	if red, err := p.Lookup("go.example", "a", now); assert.NoError(t, err) {
+		assert.Equal(t, "http://go.test", red.URL)
+	}
+
+	_, err := p.Lookup("go.example", "b", now)
+	assert.ErrorIs(t, err, lookup.ErrNotFound)
+
+	_, err = p.Lookup(domain.Default, "b", now)
+	assert.NoError(t, err)
+
+	_, err = p.Lookup(domain.Default, "b", now.Add(time.Minute))
+	assert.True(t, errors.Is(err, lookup.ErrNotFound))
+
+	_, err = p.Lookup(domain.Default, "c", now)
+	assert.True(t, errors.Is(err, lookup.ErrNotFound))
+
+	p.Handle(event.Restored(domain.Default, "c", now))
+
+	if red, err := p.Lookup(domain.Default, "c", now); assert.NoError(t, err) {
+		assert.Equal(t, "http://c.test", red.URL)
+	}
+}
+
+func TestRedirectsUses(t *testing.T) {
+	now := time.Now()
+	created := event.Created(domain.Default, "a", "http://a.test", time.Time{}, now)
+	created.MaxUses = 2
+
+	p := NewRedirects()
+	p.Handle(created)
+
+	// the use is consumed before its visit is handled
+	assert.NoError(t, p.Use(domain.Default, "a", now))
+	p.Handle(event.Visited(domain.Default, "a", now))
+	assert.NoError(t, p.Use(domain.Default, "a", now))
+	assert.ErrorIs(t, p.Use(domain.Default, "a", now), lookup.ErrExhausted)
+	p.Handle(event.Visited(domain.Default, "a", now))
+
+	// the replay counts the visits
+	replayed := NewRedirects()
+	replayed.Handle(created)
+	replayed.Handle(event.Visited(domain.Default, "a", now))
+	replayed.Handle(event.Visited(domain.Default, "a", now))
+
+	for _, p := range []*Redirects{p, replayed} {
+		if red, err := p.Lookup(domain.Default, "a", now); assert.NoError(t, err) {
+			assert.Equal(t, 2, red.Uses)
+		}
+	}
+}
+
+func TestHits(t *testing.T) {
+	p := NewHits()
+	now := time.Now()
+
+	p.Handle(event.Created(domain.Default, "a", "http://a.test", time.Time{}, now))
+	p.Handle(event.Created(domain.Default, "b", "http://b.test", time.Time{}, now))
+	p.Handle(event.Created(domain.Default, "c", "http://c.test", now.Add(time.Minute), now))
+	p.Handle(event.Created(domain.Default, "d", "http://d.test", time.Time{}, now))
+
+	for _, code := range []string{"b", "b", "a", "c", "c", "c", "d", "d", "d", "d", "x"} {
+		p.Handle(event.Visited(domain.Default, code, now))
+	}
+
+	p.Handle(event.Invalidated(domain.Default, "d", now))
+
+	// the protected redirects aren't ranked
+	protected := event.Created(domain.Default, "p", "http://p.test", time.Time{}, now)
+	protected.Password = "hash"
+	p.Handle(protected)
+	p.Handle(event.Visited(domain.Default, "p", now))
+
+	// the ranking is per domain
+	p.Handle(event.Created("go.example", "e", "http://e.test", time.Time{}, now))
+	p.Handle(event.Visited("go.example", "e", now))
+
+	if top, err := p.Top("go.example", 10, now); assert.NoError(t, err) {
+		if assert.Len(t, top, 1) {
+			assert.Equal(t, "e", top[0].Code)
+		}
+	}
+
+	if top, err := p.Top(domain.Default, 10, now); assert.NoError(t, err) {
+		if assert.Len(t, top, 3) {
+			assert.Equal(t, "c", top[0].Code)
+			assert.Equal(t, uint64(3), top[0].Hits)
+			assert.Equal(t, "b", top[1].Code)
+			assert.Equal(t, "a", top[2].Code)
+		}
+	}
+
+	if top, err := p.Top(domain.Default, 1, now.Add(time.Minute)); assert.NoError(t, err) {
+		if assert.Len(t, top, 1) {
+			assert.Equal(t, "b", top[0].Code)
+		}
+	}
+
+	// the hits survive the invalidation
+	p.Handle(event.Restored(domain.Default, "d", now))
+
+	if top, err := p.Top(domain.Default, 1, now); assert.NoError(t, err) {
+		if assert.Len(t, top, 1) {
+			assert.Equal(t, "d", top[0].Code)
+			assert.Equal(t, uint64(4), top[0].Hits)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	redirects, hits := NewRedirects(), NewHits()
+	now := time.Now()
+
+	for _, e := range []event.Event{
+		event.Created(domain.Default, "a", "http://a.test", time.Time{}, now),
+		event.Created(domain.Default, "b", "http://b.test", time.Time{}, now),
+		event.Created(domain.Default, "c", "http://c.test", time.Time{}, now),
+		event.Created(domain.Default, "d", "http://d.test", now.Add(-time.Hour), now.Add(-2*time.Hour)),
+		event.Created(domain.Default, "e", "http://e.test", now, now.Add(-2*time.Hour)),
+		event.Invalidated(domain.Default, "a", now.Add(-time.Hour)),
+		event.Invalidated(domain.Default, "b", now),
+	} {
+		redirects.Handle(e)
+		hits.Handle(e)
+	}
+
+	// only the redirects invalidated or expired before the point in time are dropped
+	n, err := redirects.Purge(now.Add(-time.Minute))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, n)
+	}
+
+	n, err = hits.Purge(now.Add(-time.Minute))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, n)
+	}
+
+	for _, e := range []event.Event{
+		event.Restored(domain.Default, "a", now),
+		event.Restored(domain.Default, "b", now),
+	} {
+		redirects.Handle(e)
+		hits.Handle(e)
+	}
+
+	_, err = redirects.Lookup(domain.Default, "a", now)
+	assert.ErrorIs(t, err, lookup.ErrNotFound)
+
+	_, err = redirects.Lookup(domain.Default, "b", now)
+	assert.NoError(t, err)
+
+	if top, err := hits.Top(domain.Default, 10, now); assert.NoError(t, err) {
+		assert.Len(t, top, 2)
+	}
+}
@@ -0,0 +1,172 @@
+// Package projection offers read models that are built from the domain events.
+package projection
+
+import (
+	"hex-microservice/domain"
+	"hex-microservice/event"
+	"hex-microservice/lookup"
+	"hex-microservice/targeting"
+	"sync"
+	"time"
+)
+
+type activeRedirect struct {
+	URL         string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	Password    string
+	MaxUses     int
+	NotBefore   time.Time
+	Rules       targeting.Rules
+	Variants    targeting.Variants
+	Passthrough bool
+	Preview     bool
+	StatusCode  int
+	// Uses counts the consumed uses, Visits the visited events. A use is
+	// consumed before its visit is published, the replay counts the visits.
+	Uses   int
+	Visits int
+	// InvalidatedAt is the point in time of the invalidation, the zero time
+	// for an active redirect.
+	InvalidatedAt time.Time
+}
+
+// Redirects is the projection of the active redirects. It serves as
+// repository for the lookup service.
+type Redirects struct {
+	active map[domain.Key]activeRedirect
+	// invalidated keeps the invalidated redirects for a restore
+	invalidated map[domain.Key]activeRedirect
+	m           sync.RWMutex
+}
+
+// NewRedirects creates an empty projection of the active redirects.
+func NewRedirects() *Redirects {
+	return &Redirects{
+		active:      make(map[domain.Key]activeRedirect),
+		invalidated: make(map[domain.Key]activeRedirect),
+	}
+}
+
+// Handle applies the event to the projection.
+func (p *Redirects) Handle(e event.Event) {
+	key := domain.Key{Domain: e.Domain, Code: e.Code}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	switch e.Type {
+	case event.RedirectCreated:
+		p.active[key] = activeRedirect{
+			URL:         e.URL,
+			CreatedAt:   e.OccurredAt,
+			ExpiresAt:   e.ExpiresAt,
+			Password:    e.Password,
+			MaxUses:     e.MaxUses,
+			NotBefore:   e.NotBefore,
+			Rules:       e.Rules,
+			Variants:    e.Variants,
+			Passthrough: e.Passthrough,
+			Preview:     e.Preview,
+			StatusCode:  e.StatusCode,
+		}
+	case event.RedirectUpdated:
+		if red, ok := p.active[key]; ok {
+			red.URL = e.URL
+			p.active[key] = red
+		}
+	case event.RedirectInvalidated:
+		if red, ok := p.active[key]; ok {
+			red.InvalidatedAt = e.OccurredAt
+			p.invalidated[key] = red
+			delete(p.active, key)
+		}
+	case event.RedirectRestored:
+		if red, ok := p.invalidated[key]; ok {
+			red.InvalidatedAt = time.Time{}
+			p.active[key] = red
+			delete(p.invalidated, key)
+		}
+	case event.RedirectVisited:
+		if red, ok := p.active[key]; ok && red.MaxUses > 0 {
+			red.Visits++
+			if red.Uses < red.Visits {
+				red.Uses = red.Visits
+			}
+			p.active[key] = red
+		}
+	}
+}
+
+// Lookup is the implementation for lookup.Repository#Lookup.
+func (p *Redirects) Lookup(d, code string, now time.Time) (lookup.RedirectStorage, error) {
+	p.m.RLock()
+	red, ok := p.active[domain.Key{Domain: d, Code: code}]
+	p.m.RUnlock()
+
+	if !ok || lookup.IsExpired(red.ExpiresAt, now) {
+		return lookup.RedirectStorage{}, lookup.ErrNotFound
+	}
+
+	return lookup.RedirectStorage{
+		Code:        code,
+		URL:         red.URL,
+		CreatedAt:   red.CreatedAt,
+		Password:    red.Password,
+		MaxUses:     red.MaxUses,
+		Uses:        red.Uses,
+		NotBefore:   red.NotBefore,
+		Rules:       red.Rules,
+		Variants:    red.Variants,
+		Passthrough: red.Passthrough,
+		Preview:     red.Preview,
+		StatusCode:  red.StatusCode,
+	}, nil
+}
+
+// Use is the implementation for lookup.Repository#Use.
+func (p *Redirects) Use(d, code string, now time.Time) error {
+	key := domain.Key{Domain: d, Code: code}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	red, ok := p.active[key]
+	if !ok || lookup.IsExpired(red.ExpiresAt, now) {
+		return lookup.ErrNotFound
+	}
+
+	if red.MaxUses > 0 && red.Uses >= red.MaxUses {
+		return lookup.ErrExhausted
+	}
+
+	red.Uses++
+	p.active[key] = red
+
+	return nil
+}
+
+// Purge is the implementation for purger.Repository#Purge, it drops the
+// invalidated redirects that can't be restored anymore and the redirects that
+// expired before the point in time.
+func (p *Redirects) Purge(before time.Time) (int, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := 0
+	for key, red := range p.invalidated {
+		if red.InvalidatedAt.Before(before) {
+			delete(p.invalidated, key)
+			n++
+		}
+	}
+
+	for key, red := range p.active {
+		if lookup.IsExpired(red.ExpiresAt, before) {
+			delete(p.active, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,70 @@
+// Package purger offers the retention policy of the invalidated redirects.
+// An invalidated redirect is kept for a grace period and is permanently
+// removed afterwards.
+package purger
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DefaultGracePeriod is the default period an invalidated redirect is kept.
+const DefaultGracePeriod = 30 * 24 * time.Hour
+
+// Repository defines the method the purger expects from
+// a repository implementation.
+type Repository interface {
+	// Purge permanently removes the redirects that were invalidated before
+	// the given point in time and returns their number.
+	Purge(before time.Time) (int, error)
+}
+
+// Purger removes the invalidated redirects after the grace period.
+type Purger struct {
+	logger     logr.Logger
+	repository Repository
+	grace      time.Duration
+}
+
+// New creates a new purger.
+func New(l logr.Logger, r Repository, grace time.Duration) *Purger {
+	return &Purger{
+		logger:     l,
+		repository: r,
+		grace:      grace,
+	}
+}
+
+// Purge removes the redirects whose grace period is over and returns their
+// number.
+func (p *Purger) Purge(now time.Time) (int, error) {
+	n, err := p.repository.Purge(now.Add(-p.grace))
+	if err != nil {
+		return n, err
+	}
+
+	if n > 0 {
+		p.logger.Info("purged invalidated redirects", "count", n)
+	}
+
+	return n, nil
+}
+
+// Run purges in the given interval until the context is done.
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if _, err := p.Purge(now); err != nil {
+				p.logger.Error(err, "error purging invalidated redirects")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package purger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+type repositoryFn func(before time.Time) (int, error)
+
+func (fn repositoryFn) Purge(before time.Time) (int, error) { return fn(before) }
+
+func TestPurgeSubtractsGracePeriod(t *testing.T) {
+	now := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	var purgedBefore time.Time
+
+	p := New(discardingLogger, repositoryFn(func(before time.Time) (int, error) {
+		purgedBefore = before
+		return 2, nil
+	}), 24*time.Hour)
+
+	n, err := p.Purge(now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, n)
+		assert.Equal(t, now.Add(-24*time.Hour), purgedBefore)
+	}
+}
+
+func TestPurgeError(t *testing.T) {
+	errRepository := errors.New("repository")
+
+	p := New(discardingLogger, repositoryFn(func(time.Time) (int, error) {
+		return 0, errRepository
+	}), time.Hour)
+
+	_, err := p.Purge(time.Now())
+	assert.ErrorIs(t, err, errRepository)
+}
+
+func TestRunStopsWithContext(t *testing.T) {
+	var calls int64
+
+	p := New(discardingLogger, repositoryFn(func(time.Time) (int, error) {
+		atomic.AddInt64(&calls, 1)
+		return 0, nil
+	}), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		p.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&calls) > 0 }, time.Second, time.Millisecond)
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purger did not stop")
+	}
+}
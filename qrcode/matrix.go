@@ -0,0 +1,403 @@
+package qrcode
+
+// penalty weights of the mask evaluation
+const (
+	penaltyRun     = 3
+	penaltyBlock   = 3
+	penaltyFinder  = 40
+	penaltyBalance = 10
+
+	masks        = 8
+	minRunLength = 5
+)
+
+// generators of the BCH codes of the format and the version information
+const (
+	formatGenerator  = 0x537
+	formatMask       = 0x5412
+	versionGenerator = 0x1f25
+)
+
+// matrix is the symbol under construction, the function modules are never
+// masked.
+type matrix struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func newMatrix(version int) *matrix {
+	size := version*4 + 17
+
+	m := &matrix{
+		version:    version,
+		size:       size,
+		modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+
+	for y := 0; y < size; y++ {
+		m.modules[y] = make([]bool, size)
+		m.isFunction[y] = make([]bool, size)
+	}
+
+	return m
+}
+
+func (m *matrix) setFunction(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder and alignment patterns and
+// reserves the format and version information.
+func (m *matrix) drawFunctionPatterns() {
+	for i := 0; i < m.size; i++ {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	m.drawFinder(3, 3)
+	m.drawFinder(m.size-4, 3)
+	m.drawFinder(3, m.size-4)
+
+	positions := alignmentPositions(m.version)
+	last := len(positions) - 1
+
+	for i, x := range positions {
+		for j, y := range positions {
+			// the corners of the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+
+			m.drawAlignment(x, y)
+		}
+	}
+
+	// the format information is drawn with the final mask
+	m.drawFormat(Medium, 0)
+	m.drawVersion()
+}
+
+// drawFinder draws the finder pattern with its separator around the center.
+func (m *matrix) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= m.size || yy >= m.size {
+				continue
+			}
+
+			dist := max(abs(dx), abs(dy))
+			m.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws the alignment pattern around the center.
+func (m *matrix) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			m.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format information and the dark
+// module.
+func (m *matrix) drawFormat(level Level, mask int) {
+	bits := formatInformation(level, mask)
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// around the top left finder pattern
+	for i := 0; i <= 5; i++ {
+		m.setFunction(8, i, bit(i))
+	}
+
+	m.setFunction(8, 7, bit(6))
+	m.setFunction(8, 8, bit(7))
+	m.setFunction(7, 8, bit(8))
+
+	for i := 9; i < 15; i++ {
+		m.setFunction(14-i, 8, bit(i))
+	}
+
+	// below the top right and right of the bottom left finder pattern
+	for i := 0; i < 8; i++ {
+		m.setFunction(m.size-1-i, 8, bit(i))
+	}
+
+	for i := 8; i < 15; i++ {
+		m.setFunction(8, m.size-15+i, bit(i))
+	}
+
+	m.setFunction(8, m.size-8, true)
+}
+
+// drawVersion draws both copies of the version information of the versions
+// 7 and above.
+func (m *matrix) drawVersion() {
+	if m.version < 7 {
+		return
+	}
+
+	bits := versionInformation(m.version)
+
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := m.size-11+i%3, i/3
+
+		m.setFunction(a, b, dark)
+		m.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the bits of the codewords in the zigzag order, the
+// remainder bits stay light.
+func (m *matrix) drawCodewords(codewords []byte) {
+	i := 0
+
+	for right := m.size - 1; right >= 1; right -= 2 {
+		// the vertical timing pattern is skipped
+		if right == 6 {
+			right = 5
+		}
+
+		upward := (right+1)&2 == 0
+
+		for vert := 0; vert < m.size; vert++ {
+			y := vert
+			if upward {
+				y = m.size - 1 - vert
+			}
+
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if m.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+
+				m.modules[y][x] = (codewords[i/8]>>(7-i%8))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty and draws its
+// format information.
+func (m *matrix) applyBestMask(level Level) {
+	best, bestPenalty := 0, -1
+
+	for mask := 0; mask < masks; mask++ {
+		m.applyMask(mask)
+		m.drawFormat(level, mask)
+
+		if penalty := m.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+
+		// the mask is its own inverse
+		m.applyMask(mask)
+	}
+
+	m.applyMask(best)
+	m.drawFormat(level, best)
+}
+
+// applyMask inverts the modules of the mask pattern, except for the
+// function modules.
+func (m *matrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if !m.isFunction[y][x] && maskPattern(mask, x, y) {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// maskPattern reports whether the mask inverts the module.
+func maskPattern(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty evaluates the symbol, the lower the penalty the easier the symbol
+// is read.
+func (m *matrix) penalty() int {
+	result := 0
+
+	// the runs of the same color and the patterns that look like a finder
+	// in the rows and the columns
+	line := make([]bool, m.size)
+	for i := 0; i < m.size; i++ {
+		result += linePenalty(m.modules[i])
+
+		for j := 0; j < m.size; j++ {
+			line[j] = m.modules[j][i]
+		}
+
+		result += linePenalty(line)
+	}
+
+	// the blocks of 2x2 modules of the same color
+	for y := 0; y < m.size-1; y++ {
+		for x := 0; x < m.size-1; x++ {
+			c := m.modules[y][x]
+			if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+				result += penaltyBlock
+			}
+		}
+	}
+
+	// the deviation of the dark modules from the half in steps of 5%
+	dark := 0
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.modules[y][x] {
+				dark++
+			}
+		}
+	}
+
+	total := m.size * m.size
+	result += abs(dark*20-total*10) / total * penaltyBalance
+
+	return result
+}
+
+// finderLike is the dark-light ratio 1:1:3:1:1 of a finder pattern.
+var finderLike = []bool{true, false, true, true, true, false, true}
+
+// linePenalty evaluates the runs and the finder-like patterns of a line.
+func linePenalty(line []bool) int {
+	result := 0
+
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+
+		if run >= minRunLength {
+			result += penaltyRun + run - minRunLength
+		}
+
+		run = 1
+	}
+
+	for i := 0; i+len(finderLike) <= len(line); i++ {
+		if !matches(line[i:], finderLike) {
+			continue
+		}
+
+		// four light modules before or after the pattern
+		if lightRun(line, i-4, i) || lightRun(line, i+len(finderLike), i+len(finderLike)+4) {
+			result += penaltyFinder
+		}
+	}
+
+	return result
+}
+
+// matches reports whether the line starts with the pattern.
+func matches(line, pattern []bool) bool {
+	for i, p := range pattern {
+		if line[i] != p {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lightRun reports whether the modules in [from,to) are light, the modules
+// outside of the line are light.
+func lightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// alignmentPositions returns the coordinates of the centers of the alignment
+// patterns in both dimensions.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+
+	result := make([]int, numAlign)
+	result[0] = 6
+
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+
+	return result
+}
+
+// formatInformation returns the 15 bits of the level and the mask with
+// their BCH code.
+func formatInformation(level Level, mask int) int {
+	data := level.formatBits()<<3 | mask
+
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * formatGenerator)
+	}
+
+	return (data<<10 | rem) ^ formatMask
+}
+
+// versionInformation returns the 18 bits of the version with their BCH code.
+func versionInformation(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * versionGenerator)
+	}
+
+	return version<<12 | rem
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+
+	return a
+}
@@ -0,0 +1,280 @@
+// Package qrcode encodes the short urls as QR codes. It implements the byte
+// mode of ISO/IEC 18004 in pure Go, so that it runs without cgo or system
+// libraries.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooLong signals that the content exceeds the capacity of the largest
+// version at the error correction level.
+var ErrTooLong = errors.New("content too long")
+
+// Level is the error correction level, the higher the level the more of a
+// damaged code can be restored and the larger the code gets.
+type Level string
+
+const (
+	// Low restores about 7% of the code.
+	Low Level = "l"
+	// Medium restores about 15% of the code.
+	Medium Level = "m"
+	// Quartile restores about 25% of the code.
+	Quartile Level = "q"
+	// High restores about 30% of the code.
+	High Level = "h"
+)
+
+// DefaultLevel is the error correction level by default.
+const DefaultLevel = Medium
+
+// Levels are the supported error correction levels.
+var Levels = []Level{Low, Medium, Quartile, High}
+
+// String implements fmt.Stringer.
+func (l Level) String() string { return string(l) }
+
+// index returns the row of the level in the tables.
+func (l Level) index() int {
+	switch l {
+	case Low:
+		return 0
+	case Quartile:
+		return 2
+	case High:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// formatBits returns the bits of the level in the format information.
+func (l Level) formatBits() int {
+	switch l {
+	case Low:
+		return 1
+	case Quartile:
+		return 3
+	case High:
+		return 2
+	default:
+		return 0
+	}
+}
+
+const (
+	minVersion = 1
+	maxVersion = 40
+
+	// modeByte is the mode indicator of the byte mode.
+	modeByte = 0x4
+
+	padFirst  = 0xec
+	padSecond = 0x11
+)
+
+// eccCodewordsPerBlock are the error correction codewords of a block per
+// level and version, the version 0 is unused.
+var eccCodewordsPerBlock = [4][maxVersion + 1]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// eccBlocks are the number of error correction blocks per level and version,
+// the version 0 is unused.
+var eccBlocks = [4][maxVersion + 1]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Code is an encoded QR code.
+type Code struct {
+	version int
+	size    int
+	// modules are the rows of the modules, true is dark
+	modules [][]bool
+}
+
+// Encode encodes the content in byte mode with the smallest version that
+// fits at the error correction level.
+func Encode(content string, level Level) (*Code, error) {
+	data := []byte(content)
+
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if dataBits(version, len(data)) <= dataCodewords(version, level)*8 {
+			break
+		}
+	}
+
+	if version > maxVersion {
+		return nil, fmt.Errorf("qrcode.Encode %d bytes at level %s: %w", len(data), level, ErrTooLong)
+	}
+
+	codewords := interleave(version, level, encodeData(version, level, data))
+
+	m := newMatrix(version)
+	m.drawFunctionPatterns()
+	m.drawCodewords(codewords)
+	m.applyBestMask(level)
+
+	return &Code{version: version, size: m.size, modules: m.modules}, nil
+}
+
+// Version returns the version of the code, 1 to 40.
+func (c *Code) Version() int { return c.version }
+
+// Size returns the number of modules per side without the quiet zone.
+func (c *Code) Size() int { return c.size }
+
+// Dark reports whether the module is dark, the modules outside of the code
+// are light.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.size || y >= c.size {
+		return false
+	}
+
+	return c.modules[y][x]
+}
+
+// charCountBits returns the length of the character count in byte mode.
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+
+	return 16
+}
+
+// dataBits returns the number of bits the content takes in byte mode.
+func dataBits(version, n int) int {
+	return 4 + charCountBits(version) + n*8
+}
+
+// rawDataModules returns the number of modules that hold codewords, the
+// remainder bits included.
+func rawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+
+		if version >= 7 {
+			result -= 36
+		}
+	}
+
+	return result
+}
+
+// dataCodewords returns the number of data codewords of the version at the
+// error correction level.
+func dataCodewords(version int, level Level) int {
+	l := level.index()
+
+	return rawDataModules(version)/8 - eccCodewordsPerBlock[l][version]*eccBlocks[l][version]
+}
+
+// encodeData returns the data codewords, the segment is terminated and
+// padded to the capacity.
+func encodeData(version int, level Level, data []byte) []byte {
+	var bb bitBuffer
+
+	bb.append(modeByte, 4)
+	bb.append(len(data), charCountBits(version))
+
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	capacity := dataCodewords(version, level) * 8
+
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+
+	for pad := padFirst; len(bb) < capacity; pad ^= padFirst ^ padSecond {
+		bb.append(pad, 8)
+	}
+
+	return bb.bytes()
+}
+
+// interleave splits the data into blocks, appends their error correction
+// codewords and interleaves the blocks.
+func interleave(version int, level Level, data []byte) []byte {
+	l := level.index()
+	numBlocks := eccBlocks[l][version]
+	blockEccLen := eccCodewordsPerBlock[l][version]
+	rawCodewords := rawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockEccLen)
+
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortBlockLen - blockEccLen
+		if i >= numShortBlocks {
+			n++
+		}
+
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+n]...)
+		k += n
+
+		ecc := reedSolomonRemainder(block, divisor)
+
+		// the short blocks get a placeholder, so that all blocks align
+		if i < numShortBlocks {
+			block = append(block, 0)
+		}
+
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := 0; i < len(blocks[0]); i++ {
+		for j, block := range blocks {
+			// skip the placeholder of the short blocks
+			if i != shortBlockLen-blockEccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	return result
+}
+
+// bitBuffer is a sequence of bits, most significant bit first.
+type bitBuffer []bool
+
+// append appends the n least significant bits of the value.
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (value>>i)&1 != 0)
+	}
+}
+
+// bytes packs the bits into bytes, the length is a multiple of eight.
+func (bb bitBuffer) bytes() []byte {
+	result := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+
+	return result
+}
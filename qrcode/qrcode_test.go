@@ -0,0 +1,215 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// the data codewords of "HELLO WORLD" in version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, reedSolomonRemainder(data, reedSolomonDivisor(10)))
+}
+
+func TestFormatAndVersionInformation(t *testing.T) {
+	assert.Equal(t, 0b101010000010010, formatInformation(Medium, 0))
+	assert.Equal(t, 0b111011111000100, formatInformation(Low, 0))
+	assert.Equal(t, 0b001011010001001, formatInformation(High, 0))
+	assert.Equal(t, 0x07c94, versionInformation(7))
+	assert.Equal(t, 0x28c69, versionInformation(40))
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	for version, expected := range map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		15: {6, 26, 48, 70},
+		32: {6, 34, 60, 86, 112, 138},
+		36: {6, 24, 50, 76, 102, 128, 154},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	} {
+		assert.Equal(t, expected, alignmentPositions(version), version)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	for _, tt := range []struct {
+		version int
+		level   Level
+		bytes   int
+	}{
+		{version: 1, level: Low, bytes: 17},
+		{version: 1, level: High, bytes: 7},
+		{version: 10, level: Medium, bytes: 213},
+		{version: 27, level: Quartile, bytes: 805},
+		{version: 40, level: Low, bytes: 2953},
+		{version: 40, level: High, bytes: 1273},
+	} {
+		assert.Equal(t, tt.bytes, (dataCodewords(tt.version, tt.level)*8-dataBits(tt.version, 0))/8, "%d-%s", tt.version, tt.level)
+	}
+
+	_, err := Encode(strings.Repeat("x", 1274), High)
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestEncode(t *testing.T) {
+	for _, tt := range []struct {
+		content string
+		level   Level
+		version int
+	}{
+		{content: "https://s.example/abc", level: Low, version: 2},
+		{content: "https://s.example/abc", level: High, version: 3},
+		{content: "https://service.example/service/" + strings.Repeat("x", 120), level: Medium, version: 8},
+		{content: strings.Repeat("https://example.com/", 40), level: Quartile, version: 27},
+	} {
+		code, err := Encode(tt.content, tt.level)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, tt.version, code.Version(), tt.content)
+		assert.Equal(t, tt.version*4+17, code.Size())
+		assert.Equal(t, tt.content, decode(t, code, tt.level))
+	}
+}
+
+func TestRender(t *testing.T) {
+	code, err := Encode("https://s.example/abc", Medium)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var b bytes.Buffer
+	if assert.NoError(t, code.PNG(&b, 256)) {
+		img, err := png.Decode(&b)
+		if assert.NoError(t, err) {
+			// 25 modules and the quiet zone of 8 modules are scaled by 7
+			assert.Equal(t, 231, img.Bounds().Dx())
+
+			// the top left finder pattern
+			r, _, _, _ := img.At(4*7, 4*7).RGBA()
+			assert.Zero(t, r)
+		}
+	}
+
+	b.Reset()
+	if assert.NoError(t, code.SVG(&b, 256)) {
+		assert.Contains(t, b.String(), `width="256"`)
+		assert.Contains(t, b.String(), `viewBox="0 0 33 33"`)
+	}
+}
+
+// decode reads the content of the code back, it checks the format
+// information and the error correction codewords of every block.
+func decode(t *testing.T, code *Code, level Level) string {
+	t.Helper()
+
+	// the first copy of the format information
+	format := 0
+	for i := 0; i <= 5; i++ {
+		format |= bit(code.Dark(8, i)) << i
+	}
+
+	format |= bit(code.Dark(8, 7))<<6 | bit(code.Dark(8, 8))<<7 | bit(code.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		format |= bit(code.Dark(14-i, 8)) << i
+	}
+
+	mask := (format ^ formatMask) >> 10 & 0x7
+	assert.Equal(t, formatInformation(level, mask), format)
+
+	// the codewords in the zigzag order without the mask
+	m := newMatrix(code.Version())
+	m.drawFunctionPatterns()
+
+	var bb bitBuffer
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := 0; vert < m.size; vert++ {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = m.size - 1 - vert
+			}
+
+			for j := 0; j < 2; j++ {
+				if x := right - j; !m.isFunction[y][x] {
+					bb = append(bb, code.Dark(x, y) != maskPattern(mask, x, y))
+				}
+			}
+		}
+	}
+
+	codewords := bitBuffer(bb[:len(bb)/8*8]).bytes()
+
+	// the blocks are deinterleaved and checked
+	l := level.index()
+	numBlocks := eccBlocks[l][code.Version()]
+	blockEccLen := eccCodewordsPerBlock[l][code.Version()]
+	numShortBlocks := numBlocks - len(codewords)%numBlocks
+	shortDataLen := len(codewords)/numBlocks - blockEccLen
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortDataLen; i++ {
+		for j := range blocks {
+			if i < shortDataLen || j >= numShortBlocks {
+				blocks[j] = append(blocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+
+	var data []byte
+	divisor := reedSolomonDivisor(blockEccLen)
+	for i := 0; i < blockEccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+
+	for _, block := range blocks {
+		n := len(block) - blockEccLen
+		assert.Equal(t, block[n:], reedSolomonRemainder(block[:n], divisor))
+		data = append(data, block[:n]...)
+	}
+
+	// the segment in byte mode
+	assert.Equal(t, byte(modeByte), data[0]>>4)
+
+	if charCountBits(code.Version()) == 8 {
+		n := int(data[0]&0xf)<<4 | int(data[1]>>4)
+		return string(shift(data[1:1+n+1], 4)[:n])
+	}
+
+	n := int(data[0]&0xf)<<12 | int(data[1])<<4 | int(data[2]>>4)
+	return string(shift(data[2:2+n+1], 4)[:n])
+}
+
+// shift returns the bytes shifted left by the bits.
+func shift(data []byte, bits int) []byte {
+	result := make([]byte, len(data)-1)
+	for i := range result {
+		result[i] = data[i]<<bits | data[i+1]>>(8-bits)
+	}
+
+	return result
+}
+
+func bit(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,84 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// QuietZone is the number of light modules around the code that scanners
+// need to find it.
+const QuietZone = 4
+
+// scale returns the pixels per module, so that the code with its quiet zone
+// fits into the size. A module takes at least one pixel.
+func (c *Code) scale(size int) int {
+	scale := size / (c.size + 2*QuietZone)
+	if scale < 1 {
+		return 1
+	}
+
+	return scale
+}
+
+// PNG writes the code as PNG image of at most size x size pixels, smaller
+// sizes than the modules are enlarged. The modules are scaled by whole
+// pixels to keep them sharp.
+func (c *Code) PNG(w io.Writer, size int) error {
+	scale := c.scale(size)
+	width := (c.size + 2*QuietZone) * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for py := 0; py < width; py++ {
+		for px := 0; px < width; px++ {
+			if c.Dark(px/scale-QuietZone, py/scale-QuietZone) {
+				img.SetColorIndex(px, py, 1)
+			}
+		}
+	}
+
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("qrcode.PNG: %w", err)
+	}
+
+	return nil
+}
+
+// SVG writes the code as SVG image of size x size pixels. The image scales
+// without loss, the dark modules of a row are joined into runs.
+func (c *Code) SVG(w io.Writer, size int) error {
+	width := c.size + 2*QuietZone
+
+	var path strings.Builder
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; {
+			if !c.Dark(x, y) {
+				x++
+				continue
+			}
+
+			run := 1
+			for c.Dark(x+run, y) {
+				run++
+			}
+
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", x+QuietZone, y+QuietZone, run, run)
+			x += run
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#fff"/>
+<path fill="#000" d="%s"/>
+</svg>
+`, size, size, width, width, path.String())
+	if err != nil {
+		return fmt.Errorf("qrcode.SVG: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package ranker
+
+// RedirectStorage is the storage view for the ranker service.
+type RedirectStorage struct {
+	Code string
+	URL  string
+	Hits uint64
+}
+
+// RankingQuery is the request query of the ranker service.
+type RankingQuery struct {
+	// Domain is the namespace of the ranked codes, empty for the default
+	// domain.
+	Domain string
+	Limit  int
+}
+
+// RedirectResult is the result of the ranker service.
+type RedirectResult struct {
+	Code string
+	URL  string
+	Hits uint64
+}
+
+// VariantStorage is the storage view of a variant of a redirect for the
+// ranker service, the variants are numbered starting with 1.
+type VariantStorage struct {
+	Variant int
+	URL     string
+	Weight  int
+	Hits    uint64
+}
+
+// VariantResult is the result of the variants of a redirect.
+type VariantResult struct {
+	Variant int
+	URL     string
+	Weight  int
+	Hits    uint64
+}
@@ -0,0 +1,96 @@
+// Package ranker offers a service to rank redirects by their hits.
+package ranker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// MaxLimit is the maximum number of redirects a ranking may contain.
+const MaxLimit = 100
+
+var (
+	// ErrQueryInvalid signals that the ranking query is not valid.
+	ErrQueryInvalid = errors.New("ranking query invalid")
+	// ErrNotFound signals that a redirect with variants is not found.
+	ErrNotFound = errors.New("redirect not found")
+)
+
+// Repository defines the methods the service expects from
+// a repository implementation.
+type Repository interface {
+	// Top returns the active redirects of the domain with the most hits in
+	// descending order.
+	Top(domain string, limit int, now time.Time) ([]RedirectStorage, error)
+	// Variants returns the variants of an active redirect of the domain with
+	// their hits in the order of their numbers. A redirect without variants
+	// has none.
+	Variants(domain, code string, now time.Time) ([]VariantStorage, error)
+}
+
+// Service describes the methods the service offers.
+type Service interface {
+	// Top returns the most visited redirects of the domain.
+	// Raises an error if the limit is out of range.
+	Top(q RankingQuery) ([]RedirectResult, error)
+	// Variants returns the variants of a redirect of the domain with their
+	// hits to compare them. Raises ErrNotFound if the redirect doesn't exist
+	// or has no variants.
+	Variants(domain, code string) ([]VariantResult, error)
+}
+
+// service implements the Service interface and holds
+// references.
+type service struct {
+	logger     logr.Logger
+	repository Repository
+}
+
+// New creates a new ranker service.
+func New(l logr.Logger, r Repository) Service {
+	return &service{
+		logger:     l,
+		repository: r,
+	}
+}
+
+// Top returns the most visited redirects.
+func (s *service) Top(q RankingQuery) ([]RedirectResult, error) {
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return nil, fmt.Errorf("service.Top limit %d: %w", q.Limit, ErrQueryInvalid)
+	}
+
+	stored, err := s.repository.Top(q.Domain, q.Limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RedirectResult, len(stored))
+	for i, r := range stored {
+		results[i] = fromRedirectStorageToRedirectResult(r)
+	}
+
+	return results, nil
+}
+
+// Variants returns the variants of a redirect with their hits.
+func (s *service) Variants(domain, code string) ([]VariantResult, error) {
+	stored, err := s.repository.Variants(domain, code, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("service.Variants: %w", err)
+	}
+
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("service.Variants %s: %w", code, ErrNotFound)
+	}
+
+	results := make([]VariantResult, len(stored))
+	for i, v := range stored {
+		results[i] = VariantResult(v)
+	}
+
+	return results, nil
+}
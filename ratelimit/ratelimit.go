@@ -0,0 +1,151 @@
+// Package ratelimit offers a token bucket per client. A bucket holds up to the
+// limit of tokens and is refilled evenly within the window, every request
+// takes a token.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Result is the state of the bucket of a client after a request.
+type Result struct {
+	// Allowed signals that the request took a token.
+	Allowed bool
+	// Limit is the capacity of the bucket.
+	Limit int
+	// Remaining are the whole tokens left.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the tokens of a denied request are refilled.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter holds the buckets of the clients.
+type Limiter struct {
+	logger logr.Logger
+	limit  int
+	// rate is the number of tokens per second
+	rate float64
+
+	buckets map[string]*bucket
+	m       sync.Mutex
+}
+
+// New creates a new limiter that allows the limit of requests per window and
+// client.
+func New(l logr.Logger, limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		logger:  l,
+		limit:   limit,
+		rate:    float64(limit) / window.Seconds(),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of the client if there is one left.
+func (l *Limiter) Allow(client string, now time.Time) Result {
+	return l.AllowN(client, 1, now)
+}
+
+// AllowN takes n tokens from the bucket of the client if there are enough
+// left, otherwise it takes none. A request that stands for several, e.g. a
+// batch, takes a token per item.
+func (l *Limiter) AllowN(client string, n int, now time.Time) Result {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = l.refilled(b, now)
+	b.last = now
+
+	result := Result{Limit: l.limit}
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(float64(n) - b.tokens)
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = l.duration(float64(l.limit) - b.tokens)
+
+	return result
+}
+
+// Refund returns a token that a request took to the bucket of the client, a
+// request that shouldn't count is taken first and refunded afterwards.
+func (l *Limiter) Refund(client string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if b, ok := l.buckets[client]; ok {
+		b.tokens = math.Min(float64(l.limit), b.tokens+1)
+	}
+}
+
+// Cleanup removes the buckets that are full again, a client without a bucket
+// starts with a full one. It returns the number of the removed buckets.
+func (l *Limiter) Cleanup(now time.Time) int {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	n := 0
+	for client, b := range l.buckets {
+		if l.refilled(b, now) >= float64(l.limit) {
+			delete(l.buckets, client)
+			n++
+		}
+	}
+
+	return n
+}
+
+// Run removes the idle buckets in the given interval until the context is
+// done.
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if n := l.Cleanup(now); n > 0 {
+				l.logger.V(1).Info("removed idle rate limit buckets", "count", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refilled returns the tokens of the bucket at the point in time.
+func (l *Limiter) refilled(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return math.Min(float64(l.limit), b.tokens+elapsed*l.rate)
+}
+
+// duration returns the time the tokens take to be refilled, rounded up to
+// whole seconds.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens/l.rate)) * time.Second
+}
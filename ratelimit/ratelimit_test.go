@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/go-logr/stdr"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardingLogger = stdr.New(log.New(io.Discard, "", log.Lshortfile))
+
+func TestAllowExhaustsAndRefills(t *testing.T) {
+	now := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+	l := New(discardingLogger, 3, time.Minute)
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		result := l.Allow("client", now)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	denied := l.Allow("client", now)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, 0, denied.Remaining)
+	assert.Equal(t, 20*time.Second, denied.RetryAfter)
+	assert.Equal(t, time.Minute, denied.Reset)
+
+	// the other clients have their own buckets
+	assert.True(t, l.Allow("other", now).Allowed)
+
+	// a token is refilled every 20 seconds
+	refilled := l.Allow("client", now.Add(20*time.Second))
+	assert.True(t, refilled.Allowed)
+	assert.Equal(t, 0, refilled.Remaining)
+	assert.False(t, l.Allow("client", now.Add(20*time.Second)).Allowed)
+}
+
+func TestCleanupRemovesFullBuckets(t *testing.T) {
+	now := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+	l := New(discardingLogger, 2, time.Minute)
+
+	l.Allow("idle", now)
+	l.Allow("busy", now.Add(time.Minute))
+
+	assert.Equal(t, 0, l.Cleanup(now.Add(10*time.Second)))
+	assert.Equal(t, 1, l.Cleanup(now.Add(time.Minute)))
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "busy")
+}
+
+func TestRefund(t *testing.T) {
+	now := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+	l := New(discardingLogger, 1, time.Minute)
+
+	assert.True(t, l.Allow("client", now).Allowed)
+	l.Refund("client")
+	assert.True(t, l.Allow("client", now).Allowed)
+	assert.False(t, l.Allow("client", now).Allowed)
+
+	// the bucket doesn't exceed the limit
+	l.Refund("client")
+	l.Refund("client")
+	assert.Equal(t, 0, l.Allow("client", now).Remaining)
+
+	// an unknown client has a full bucket anyway
+	l.Refund("unknown")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestAllowNTakesAllOrNothing(t *testing.T) {
+	now := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+	l := New(discardingLogger, 3, time.Minute)
+
+	assert.True(t, l.Allow("client", now).Allowed)
+
+	denied := l.AllowN("client", 3, now)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, 2, denied.Remaining)
+	assert.Equal(t, 20*time.Second, denied.RetryAfter)
+
+	allowed := l.AllowN("client", 2, now)
+	assert.True(t, allowed.Allowed)
+	assert.Equal(t, 0, allowed.Remaining)
+}
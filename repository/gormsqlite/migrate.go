@@ -0,0 +1,118 @@
+package gormsqlite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// addDomain rebuilds the tables of a database of a former version with the
+// domain in their primary key, AutoMigrate only adds the missing columns. The
+// existing redirects belong to the default domain.
+func addDomain(database *gorm.DB) error {
+	return database.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&redirect{}, &variantHit{}} {
+			table := tx.NewScope(model).TableName()
+			if !tx.HasTable(table) || tx.Dialect().HasColumn(table, "domain") {
+				continue
+			}
+
+			if err := rebuild(tx, model, table); err != nil {
+				return fmt.Errorf("rebuilding %s: %w", table, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// stampInvalidation sets the point in time of the invalidation of the redirects
+// of a former version that were invalidated without it, so that they are
+// purged after the grace period from now on like the sqlite repository does.
+func stampInvalidation(database *gorm.DB, now time.Time) error {
+	return database.Model(&redirect{}).
+		Where("active = ? AND (invalidated_at IS NULL OR invalidated_at = ?)", false, time.Time{}).
+		UpdateColumn("invalidated_at", now).Error
+}
+
+// rebuild creates the table of the model anew and copies the rows of the
+// existing table, its columns are a subset of the columns of the model.
+func rebuild(tx *gorm.DB, model any, table string) error {
+	former := table + "_without_domain"
+
+	columns, err := columnNames(tx, table)
+	if err != nil {
+		return err
+	}
+
+	// the names of the indexes are unique per database, they are created anew
+	indexes, err := indexNames(tx, table)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if err := tx.Exec(fmt.Sprintf("DROP INDEX %q", index)).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec(fmt.Sprintf("ALTER TABLE %q RENAME TO %q", table, former)).Error; err != nil {
+		return err
+	}
+
+	if err := tx.CreateTable(model).Error; err != nil {
+		return err
+	}
+
+	list := `"` + strings.Join(columns, `", "`) + `"`
+	if err := tx.Exec(fmt.Sprintf("INSERT INTO %q (%s) SELECT %s FROM %q", table, list, list, former)).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(fmt.Sprintf("DROP TABLE %q", former)).Error
+}
+
+// columnNames returns the names of the columns of the table.
+func columnNames(tx *gorm.DB, table string) ([]string, error) {
+	rows, err := tx.Raw("SELECT name FROM pragma_table_info(?)", table).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// indexNames returns the names of the explicitly created indexes of the table.
+func indexNames(tx *gorm.DB, table string) ([]string, error) {
+	rows, err := tx.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
@@ -1,13 +1,53 @@
 package gormsqlite
 
 import (
+	"hex-microservice/targeting"
 	"time"
 )
 
 type redirect struct {
-	Code      string `gorm:"primary_key"`
+	// Code leads the primary key, gorm skips the primary key condition if
+	// its first field is blank, as the Domain of the default domain is
+	Code string `gorm:"primary_key"`
+	// Domain is the namespace of the code, empty for the default domain
+	Domain    string `gorm:"primary_key;default:''"`
 	Active    bool
 	Token     string
-	URL       string
+	URL       string `gorm:"index"`
 	CreatedAt time.Time
+	ExpiresAt time.Time
+	// InvalidatedAt is the zero time for an active redirect
+	InvalidatedAt time.Time
+	// Password is the hash of the password, empty if the redirect isn't protected
+	Password string
+	// MaxUses limits the number of redirects, zero is unlimited
+	MaxUses int
+	Uses    int
+	// NotBefore is the zero time if the redirect is active immediately
+	NotBefore time.Time
+	// Rules are the conditional destinations, stored as JSON
+	Rules targeting.Rules `gorm:"type:text"`
+	// Variants are the weighted destinations, stored as JSON
+	Variants targeting.Variants `gorm:"type:text"`
+	// Passthrough passes the path and the query of a request to the destination
+	Passthrough bool
+	// Preview shows the preview page instead of redirecting
+	Preview    bool
+	StatusCode int
+	Hits       uint64
+	// Owner is the id of the API key the redirect was created with
+	Owner string
+}
+
+// variantHit counts the hits of a variant of a redirect
+type variantHit struct {
+	Code    string `gorm:"primary_key"`
+	Domain  string `gorm:"primary_key;default:''"`
+	Variant int    `gorm:"primary_key;auto_increment:false"`
+	Hits    uint64
+}
+
+type sequence struct {
+	Name  string `gorm:"primary_key"`
+	Value uint64
 }
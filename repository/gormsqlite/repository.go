@@ -2,17 +2,29 @@ package gormsqlite
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"hex-microservice/adder"
+	"hex-microservice/domain"
+	"hex-microservice/hashed"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
 	"hex-microservice/repository"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// sequenceName is the name of the sequence for the sequential code generation.
+const sequenceName = "redirects"
+
 type gormSqliteRepository struct {
 	parent context.Context
 	db     *gorm.DB
@@ -25,7 +37,20 @@ func New(parent context.Context, url string) (repository.RedirectRepository, rep
 		panic("Failed to connect to database!")
 	}
 
-	database.AutoMigrate(&redirect{})
+	if err := addDomain(database); err != nil {
+		database.Close()
+		return nil, nil, fmt.Errorf("gormsqlite.New adding the domain: %w", err)
+	}
+
+	if err := database.AutoMigrate(&redirect{}, &sequence{}, &variantHit{}).Error; err != nil {
+		database.Close()
+		return nil, nil, fmt.Errorf("gormsqlite.New migrating: %w", err)
+	}
+
+	if err := stampInvalidation(database, time.Now()); err != nil {
+		database.Close()
+		return nil, nil, fmt.Errorf("gormsqlite.New stamping the invalidations: %w", err)
+	}
 
 	return &gormSqliteRepository{
 		parent: parent,
@@ -33,11 +58,11 @@ func New(parent context.Context, url string) (repository.RedirectRepository, rep
 	}, database.Close, nil
 }
 
-func (g *gormSqliteRepository) Lookup(code string) (lookup.RedirectStorage, error) {
+func (g *gormSqliteRepository) Lookup(d, code string, now time.Time) (lookup.RedirectStorage, error) {
 	var red lookup.RedirectStorage
 	var stored redirect
 
-	if err := g.db.Where("code = ? and active = ?", code, true).First(&stored).Error; err != nil {
+	if err := g.db.Where("domain = ? and code = ? and active = ?", d, code, true).First(&stored).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return red, lookup.ErrNotFound
 		}
@@ -45,9 +70,48 @@ func (g *gormSqliteRepository) Lookup(code string) (lookup.RedirectStorage, erro
 		return red, err
 	}
 
+	// the comparison of timestamps stored by gorm is not reliable in sqlite,
+	// therefore the expiry is checked after the retrieval
+	if lookup.IsExpired(stored.ExpiresAt, now) {
+		return red, lookup.ErrNotFound
+	}
+
 	return fromRedirectToLookupRedirectStorage(stored), nil
 }
 
+func (g *gormSqliteRepository) Use(d, code string, now time.Time) error {
+	// the check of the redirect and the consumption of a use are atomic, so
+	// that a redirect that is gone meanwhile isn't reported as exhausted
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		var stored redirect
+
+		if err := tx.Where("domain = ? and code = ? and active = ?", d, code, true).First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return lookup.ErrNotFound
+			}
+
+			return err
+		}
+
+		// see Lookup, the expiry is checked after the retrieval
+		if lookup.IsExpired(stored.ExpiresAt, now) {
+			return lookup.ErrNotFound
+		}
+
+		result := tx.Model(&redirect{}).Where("domain = ? AND code = ? AND active = ? AND (max_uses = 0 OR uses < max_uses)", d, code, true).
+			UpdateColumn("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return lookup.ErrExhausted
+		}
+
+		return nil
+	})
+}
+
 // see: https://github.com/go-gorm/gorm/issues/2903
 func isDuplicateKeyError(err error) bool {
 	return strings.HasPrefix(err.Error(), "UNIQUE constraint failed")
@@ -57,7 +121,7 @@ func (g *gormSqliteRepository) Store(red adder.RedirectStorage) error {
 	store := fromAdderRedirectStorageToRedirect(red)
 	store.Active = true
 
-	if err := g.db.Create(store).Error; err != nil {
+	if err := g.db.Create(&store).Error; err != nil {
 		if isDuplicateKeyError(err) {
 			return adder.ErrDuplicate
 		}
@@ -68,16 +132,275 @@ func (g *gormSqliteRepository) Store(red adder.RedirectStorage) error {
 	return nil
 }
 
-func (g *gormSqliteRepository) Invalidate(code, token string) error {
+func (g *gormSqliteRepository) StoreAll(reds []adder.RedirectStorage) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		for i, red := range reds {
+			store := fromAdderRedirectStorageToRedirect(red)
+			store.Active = true
+
+			if err := tx.Create(&store).Error; err != nil {
+				if isDuplicateKeyError(err) {
+					err = adder.ErrDuplicate
+				}
+
+				return &adder.ItemError{Index: i, Err: err}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (g *gormSqliteRepository) LookupByURL(d, url string) (adder.RedirectStorage, error) {
+	rows, err := g.db.Model(&redirect{}).Where("domain = ? AND url = ? AND active = ? AND password = ? AND max_uses = ? AND rules = ? AND variants = ? AND passthrough = ? AND preview = ?", d, url, true, "", 0, "", "", false, false).Order("created_at asc").Rows()
+	if err != nil {
+		return adder.RedirectStorage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stored redirect
+		if err := g.db.ScanRows(rows, &stored); err != nil {
+			return adder.RedirectStorage{}, err
+		}
+
+		// see Lookup, the expiry and the activation are checked after the retrieval
+		if stored.ExpiresAt.IsZero() && stored.NotBefore.IsZero() {
+			return fromRedirectToAdderRedirectStorage(stored), nil
+		}
+	}
+
+	return adder.RedirectStorage{}, adder.ErrNotFound
+}
+
+func (g *gormSqliteRepository) Update(d, code, token, url string, now time.Time) error {
 	var stored redirect
 
-	if err := g.db.Where("code = ? AND token = ?", code, token).First(&stored).Error; err != nil {
+	if err := g.db.Where("domain = ? AND code = ? AND active = ?", d, code, true).First(&stored).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return updater.ErrNotFound
+		}
+
+		return err
+	}
+
+	// see Lookup, the expiry and the hashed token are checked after the retrieval
+	if !hashed.Verify(stored.Token, token) || lookup.IsExpired(stored.ExpiresAt, now) {
+		return updater.ErrNotFound
+	}
+
+	return g.db.Model(&stored).Update("url", url).Error
+}
+
+func (g *gormSqliteRepository) Invalidate(d, code, token string, now time.Time) error {
+	// the check of the activity and the invalidation are atomic, an invalidated
+	// redirect keeps the point in time of its first invalidation
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		var stored redirect
+
+		if err := tx.Where("domain = ? AND code = ? AND active = ?", d, code, true).First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return invalidator.ErrNotFound
+			}
+
+			return err
+		}
+
+		if !hashed.Verify(stored.Token, token) {
 			return invalidator.ErrNotFound
 		}
 
+		return tx.Model(&stored).Updates(map[string]any{"active": false, "invalidated_at": now}).Error
+	})
+}
+
+func (g *gormSqliteRepository) Restore(d, code, token string, invalidatedSince time.Time) error {
+	// the check of the invalidation and the reactivation are atomic
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		var stored redirect
+
+		if err := tx.Where("domain = ? AND code = ? AND active = ?", d, code, false).First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return restorer.ErrNotFound
+			}
+
+			return err
+		}
+
+		if !hashed.Verify(stored.Token, token) {
+			return restorer.ErrNotFound
+		}
+
+		if stored.InvalidatedAt.Before(invalidatedSince) {
+			return restorer.ErrWindowClosed
+		}
+
+		return tx.Model(&stored).Updates(map[string]any{"active": true, "invalidated_at": time.Time{}}).Error
+	})
+}
+
+func (g *gormSqliteRepository) Purge(before time.Time) (int, error) {
+	var n int
+
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		purged := tx.Model(&redirect{}).Select("domain, code").Where("active = ? AND invalidated_at < ?", false, before).SubQuery()
+		if err := tx.Where("(domain, code) IN ?", purged).Delete(&variantHit{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("active = ? AND invalidated_at < ?", false, before).Delete(&redirect{})
+		n = int(result.RowsAffected)
+
+		return result.Error
+	})
+
+	return n, err
+}
+
+func (g *gormSqliteRepository) NextSequence() (uint64, error) {
+	var next sequence
+
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.FirstOrCreate(&next, sequence{Name: sequenceName}).Error; err != nil {
+			return err
+		}
+
+		next.Value++
+
+		return tx.Model(&next).UpdateColumn("value", next.Value).Error
+	})
+
+	return next.Value, err
+}
+
+func (g *gormSqliteRepository) IncrementHits(hits map[domain.Key]uint64) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		for key, n := range hits {
+			if err := tx.Model(&redirect{}).Where("domain = ? AND code = ?", key.Domain, key.Code).
+				UpdateColumn("hits", gorm.Expr("hits + ?", n)).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (g *gormSqliteRepository) IncrementVariantHits(hits map[domain.Key]map[int]uint64) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		for key, variants := range hits {
+			for variant, n := range variants {
+				var hit variantHit
+				if err := tx.FirstOrCreate(&hit, variantHit{Domain: key.Domain, Code: key.Code, Variant: variant}).Error; err != nil {
+					return err
+				}
+
+				if err := tx.Model(&hit).UpdateColumn("hits", gorm.Expr("hits + ?", n)).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (g *gormSqliteRepository) Top(d string, limit int, now time.Time) ([]ranker.RedirectStorage, error) {
+	rows, err := g.db.Model(&redirect{}).Where("domain = ? AND active = ? AND password = ?", d, true, "").Order("hits desc, code asc").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := make([]ranker.RedirectStorage, 0, limit)
+	for len(top) < limit && rows.Next() {
+		var stored redirect
+		if err := g.db.ScanRows(rows, &stored); err != nil {
+			return nil, err
+		}
+
+		// see Lookup, expired redirects are skipped after the retrieval
+		if lookup.IsExpired(stored.ExpiresAt, now) {
+			continue
+		}
+
+		top = append(top, fromRedirectToRankerRedirectStorage(stored))
+	}
+
+	return top, rows.Err()
+}
+
+func (g *gormSqliteRepository) Scheduled(d string, now time.Time) ([]scheduler.RedirectStorage, error) {
+	rows, err := g.db.Model(&redirect{}).Where("domain = ? AND active = ? AND password = ?", d, true, "").Order("not_before asc, code asc").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scheduled := make([]scheduler.RedirectStorage, 0)
+	for rows.Next() {
+		var stored redirect
+		if err := g.db.ScanRows(rows, &stored); err != nil {
+			return nil, err
+		}
+
+		// see Lookup, the activation and the expiry are checked after the retrieval
+		if !now.Before(stored.NotBefore) || lookup.IsExpired(stored.ExpiresAt, now) {
+			continue
+		}
+
+		scheduled = append(scheduled, fromRedirectToSchedulerRedirectStorage(stored))
+	}
+
+	return scheduled, rows.Err()
+}
+
+func (g *gormSqliteRepository) Variants(d, code string, now time.Time) ([]ranker.VariantStorage, error) {
+	var stored redirect
+
+	if err := g.db.Where("domain = ? and code = ? and active = ? and password = ?", d, code, true, "").First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ranker.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	// see Lookup, the expiry is checked after the retrieval
+	if lookup.IsExpired(stored.ExpiresAt, now) {
+		return nil, ranker.ErrNotFound
+	}
+
+	var hits []variantHit
+	if err := g.db.Where("domain = ? AND code = ?", d, code).Find(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	variants := make([]ranker.VariantStorage, len(stored.Variants))
+	for i, v := range stored.Variants {
+		variants[i] = ranker.VariantStorage{
+			Variant: i + 1,
+			URL:     v.URL,
+			Weight:  v.Weight,
+		}
+	}
+
+	for _, hit := range hits {
+		if hit.Variant >= 1 && hit.Variant <= len(variants) {
+			variants[hit.Variant-1].Hits = hit.Hits
+		}
+	}
+
+	return variants, nil
+}
+
+func (g *gormSqliteRepository) Ping(ctx context.Context) error {
+	var one int
+
+	err := g.db.DB().QueryRowContext(ctx, "SELECT 1 FROM redirects LIMIT 1").Scan(&one)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
 
-	return g.db.Model(&stored).Update("active", false).Error
+	return nil
 }
@@ -4,24 +4,66 @@ import (
 	"hex-microservice/adder"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/scheduler"
 )
 
 // Hey, this code is generated. You know the drill: DO NOT EDIT
 
 func fromRedirectToLookupRedirectStorage(i redirect) lookup.RedirectStorage {
 	return lookup.RedirectStorage{
-		Code:      i.Code,
-		URL:       i.URL,
-		CreatedAt: i.CreatedAt,
+		Code:        i.Code,
+		URL:         i.URL,
+		CreatedAt:   i.CreatedAt,
+		Password:    i.Password,
+		MaxUses:     i.MaxUses,
+		Uses:        i.Uses,
+		NotBefore:   i.NotBefore,
+		Rules:       i.Rules,
+		Variants:    i.Variants,
+		Passthrough: i.Passthrough,
+		Preview:     i.Preview,
+		StatusCode:  i.StatusCode,
 	}
 }
 
 func fromAdderRedirectStorageToRedirect(i adder.RedirectStorage) redirect {
 	return redirect{
-		Code:      i.Code,
-		URL:       i.URL,
-		Token:     i.Token,
-		CreatedAt: i.CreatedAt,
+		Domain:      i.Domain,
+		Code:        i.Code,
+		URL:         i.URL,
+		Token:       i.Token,
+		CreatedAt:   i.CreatedAt,
+		ExpiresAt:   i.ExpiresAt,
+		Password:    i.Password,
+		MaxUses:     i.MaxUses,
+		NotBefore:   i.NotBefore,
+		Rules:       i.Rules,
+		Variants:    i.Variants,
+		Passthrough: i.Passthrough,
+		Preview:     i.Preview,
+		StatusCode:  i.StatusCode,
+		Owner:       i.Owner,
+	}
+}
+
+func fromRedirectToAdderRedirectStorage(i redirect) adder.RedirectStorage {
+	return adder.RedirectStorage{
+		Domain:      i.Domain,
+		Code:        i.Code,
+		Token:       i.Token,
+		URL:         i.URL,
+		CreatedAt:   i.CreatedAt,
+		ExpiresAt:   i.ExpiresAt,
+		Password:    i.Password,
+		MaxUses:     i.MaxUses,
+		NotBefore:   i.NotBefore,
+		Rules:       i.Rules,
+		Variants:    i.Variants,
+		Passthrough: i.Passthrough,
+		Preview:     i.Preview,
+		StatusCode:  i.StatusCode,
+		Owner:       i.Owner,
 	}
 }
 
@@ -31,3 +73,21 @@ func fromRedirectToInvalidatorRedirectStorage(i redirect) invalidator.RedirectSt
 		Token: i.Token,
 	}
 }
+
+func fromRedirectToRankerRedirectStorage(i redirect) ranker.RedirectStorage {
+	return ranker.RedirectStorage{
+		Code: i.Code,
+		URL:  i.URL,
+		Hits: i.Hits,
+	}
+}
+
+func fromRedirectToSchedulerRedirectStorage(i redirect) scheduler.RedirectStorage {
+	return scheduler.RedirectStorage{
+		Code:      i.Code,
+		URL:       i.URL,
+		CreatedAt: i.CreatedAt,
+		ExpiresAt: i.ExpiresAt,
+		NotBefore: i.NotBefore,
+	}
+}
@@ -1,11 +1,38 @@
 package memory
 
-import "time"
+import (
+	"hex-microservice/targeting"
+	"time"
+)
 
 type redirect struct {
+	// Domain is the namespace of the code, empty for the default domain
+	Domain    string
 	Code      string
 	Active    bool
 	Token     string
 	URL       string
 	CreatedAt time.Time
+	ExpiresAt time.Time
+	// InvalidatedAt is the zero time for an active redirect
+	InvalidatedAt time.Time
+	// Password is the hash of the password, empty if the redirect isn't protected
+	Password string
+	// MaxUses limits the number of redirects, zero is unlimited
+	MaxUses int
+	Uses    int
+	// NotBefore is the zero time if the redirect is active immediately
+	NotBefore time.Time
+	// Rules are the conditional destinations, stored as JSON
+	Rules targeting.Rules
+	// Variants are the weighted destinations, stored as JSON
+	Variants targeting.Variants
+	// Passthrough passes the path and the query of a request to the destination
+	Passthrough bool
+	// Preview shows the preview page instead of redirecting
+	Preview    bool
+	StatusCode int
+	Hits       uint64
+	// Owner is the id of the API key the redirect was created with
+	Owner string
 }
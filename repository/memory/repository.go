@@ -4,55 +4,79 @@ import (
 	"context"
 	"errors"
 	"hex-microservice/adder"
+	"hex-microservice/domain"
+	"hex-microservice/hashed"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
 	"hex-microservice/repository"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var errNotFound = errors.New("not found")
 
 type memoryRepository struct {
-	memory map[string]redirect
-	m      sync.RWMutex
+	memory map[domain.Key]redirect
+	// byURL is the index of the redirects by their url
+	byURL map[string]map[domain.Key]struct{}
+	// variantHits are the hits of the redirects per variant
+	variantHits map[domain.Key]map[int]uint64
+	m           sync.RWMutex
+	sequence    uint64
 }
 
 func New(_ context.Context, _ string) (repository.RedirectRepository, repository.Close, error) {
 	return &memoryRepository{
-		memory: make(map[string]redirect),
-		m:      sync.RWMutex{},
+		memory:      make(map[domain.Key]redirect),
+		byURL:       make(map[string]map[domain.Key]struct{}),
+		variantHits: make(map[domain.Key]map[int]uint64),
+		m:           sync.RWMutex{},
 	}, func() error { return nil }, nil
 }
 
-// findByCode resolves a redirect by it's code.
-func (r *memoryRepository) findActiveByCode(code string) (redirect, error) {
-	r.m.RLock()
-	red, ok := r.memory[code]
-	r.m.RUnlock()
-
-	if !ok || !red.Active {
-		return red, errNotFound
+// index adds the redirect to the url index, the write lock must be held.
+func (r *memoryRepository) index(key domain.Key, url string) {
+	keys, ok := r.byURL[url]
+	if !ok {
+		keys = make(map[domain.Key]struct{})
+		r.byURL[url] = keys
 	}
 
-	return red, nil
+	keys[key] = struct{}{}
+}
+
+// unindex removes the redirect from the url index, the write lock must be held.
+func (r *memoryRepository) unindex(key domain.Key, url string) {
+	delete(r.byURL[url], key)
+
+	if len(r.byURL[url]) == 0 {
+		delete(r.byURL, url)
+	}
 }
 
-func (r *memoryRepository) findActiveByCodeAndToken(code, token string) (redirect, error) {
+// findActiveByCode resolves a non-expired redirect by it's code.
+func (r *memoryRepository) findActiveByCode(key domain.Key, now time.Time) (redirect, error) {
 	r.m.RLock()
-	red, ok := r.memory[code]
+	red, ok := r.memory[key]
 	r.m.RUnlock()
 
-	if !ok || !red.Active || red.Token != token {
+	if !ok || !red.Active || lookup.IsExpired(red.ExpiresAt, now) {
 		return red, errNotFound
 	}
 
 	return red, nil
 }
 
-func (r *memoryRepository) Lookup(code string) (lookup.RedirectStorage, error) {
+func (r *memoryRepository) Lookup(d, code string, now time.Time) (lookup.RedirectStorage, error) {
 	var red lookup.RedirectStorage
 
-	stored, err := r.findActiveByCode(code)
+	stored, err := r.findActiveByCode(domain.Key{Domain: d, Code: code}, now)
 	if err != nil {
 		if errors.Is(err, errNotFound) {
 			return red, lookup.ErrNotFound
@@ -64,40 +88,305 @@ func (r *memoryRepository) Lookup(code string) (lookup.RedirectStorage, error) {
 	return fromRedirectToLookupRedirectStorage(stored), nil
 }
 
-func (r *memoryRepository) Store(red adder.RedirectStorage) error {
-	// Check if already there
-	r.m.RLock()
-	_, ok := r.memory[red.Code]
-	r.m.RUnlock()
-	if ok {
-		return adder.ErrDuplicate
+func (r *memoryRepository) Use(d, code string, now time.Time) error {
+	key := domain.Key{Domain: d, Code: code}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	red, ok := r.memory[key]
+	if !ok || !red.Active || lookup.IsExpired(red.ExpiresAt, now) {
+		return lookup.ErrNotFound
+	}
+
+	if red.MaxUses > 0 && red.Uses >= red.MaxUses {
+		return lookup.ErrExhausted
 	}
 
+	red.Uses++
+	r.memory[key] = red
+
+	return nil
+}
+
+func (r *memoryRepository) Store(red adder.RedirectStorage) error {
 	store := fromAdderRedirectStorageToRedirect(red)
 	store.Active = true
 
+	key := domain.Key{Domain: red.Domain, Code: red.Code}
+
+	// the check and the write happen under the same lock
+	// to not overwrite a concurrently stored redirect
 	r.m.Lock()
-	r.memory[red.Code] = store
-	r.m.Unlock()
+	defer r.m.Unlock()
+
+	if _, ok := r.memory[key]; ok {
+		return adder.ErrDuplicate
+	}
+
+	r.memory[key] = store
+	r.index(key, red.URL)
 
 	return nil
 }
 
-func (r *memoryRepository) Invalidate(code, token string) error {
-	store, err := r.findActiveByCodeAndToken(code, token)
-	if err != nil {
-		if errors.Is(err, errNotFound) {
-			return invalidator.ErrNotFound
+func (r *memoryRepository) StoreAll(reds []adder.RedirectStorage) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// check all redirects before the first one is written
+	keys := make(map[domain.Key]struct{}, len(reds))
+	for i, red := range reds {
+		key := domain.Key{Domain: red.Domain, Code: red.Code}
+
+		_, stored := r.memory[key]
+		_, batched := keys[key]
+		if stored || batched {
+			return &adder.ItemError{Index: i, Err: adder.ErrDuplicate}
+		}
+
+		keys[key] = struct{}{}
+	}
+
+	for _, red := range reds {
+		store := fromAdderRedirectStorageToRedirect(red)
+		store.Active = true
+
+		key := domain.Key{Domain: red.Domain, Code: red.Code}
+		r.memory[key] = store
+		r.index(key, red.URL)
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) LookupByURL(d, url string) (adder.RedirectStorage, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	// the oldest matching redirect is used to get a stable result
+	var found *redirect
+	for key := range r.byURL[url] {
+		red := r.memory[key]
+		if key.Domain != d || !red.Active || !red.ExpiresAt.IsZero() || red.Password != "" || red.MaxUses > 0 || !red.NotBefore.IsZero() || len(red.Rules) > 0 || len(red.Variants) > 0 || red.Passthrough || red.Preview {
+			continue
+		}
+
+		if found == nil || red.CreatedAt.Before(found.CreatedAt) {
+			found = &red
+		}
+	}
+
+	if found == nil {
+		return adder.RedirectStorage{}, adder.ErrNotFound
+	}
+
+	return fromRedirectToAdderRedirectStorage(*found), nil
+}
+
+func (r *memoryRepository) Update(d, code, token, url string, now time.Time) error {
+	key := domain.Key{Domain: d, Code: code}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// the check and the update happen under the same lock
+	// to not resurrect a concurrently invalidated redirect
+	red, ok := r.memory[key]
+	if !ok || !red.Active || !hashed.Verify(red.Token, token) || lookup.IsExpired(red.ExpiresAt, now) {
+		return updater.ErrNotFound
+	}
+
+	r.unindex(key, red.URL)
+	r.index(key, url)
+
+	red.URL = url
+	r.memory[key] = red
+
+	return nil
+}
+
+func (r *memoryRepository) Invalidate(d, code, token string, now time.Time) error {
+	key := domain.Key{Domain: d, Code: code}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// the check and the write happen under the same lock
+	// to not lose a concurrently consumed use
+	red, ok := r.memory[key]
+	if !ok || !red.Active || !hashed.Verify(red.Token, token) {
+		return invalidator.ErrNotFound
+	}
+
+	red.Active = false
+	red.InvalidatedAt = now
+	r.memory[key] = red
+	r.unindex(key, red.URL)
+
+	return nil
+}
+
+func (r *memoryRepository) Restore(d, code, token string, invalidatedSince time.Time) error {
+	key := domain.Key{Domain: d, Code: code}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	red, ok := r.memory[key]
+	if !ok || red.Active || !hashed.Verify(red.Token, token) {
+		return restorer.ErrNotFound
+	}
+
+	if red.InvalidatedAt.Before(invalidatedSince) {
+		return restorer.ErrWindowClosed
+	}
+
+	red.Active = true
+	red.InvalidatedAt = time.Time{}
+	r.memory[key] = red
+	r.index(key, red.URL)
+
+	return nil
+}
+
+func (r *memoryRepository) Purge(before time.Time) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	n := 0
+	for key, red := range r.memory {
+		if !red.Active && red.InvalidatedAt.Before(before) {
+			delete(r.memory, key)
+			delete(r.variantHits, key)
+			n++
 		}
+	}
+
+	return n, nil
+}
 
-		return err
+func (r *memoryRepository) NextSequence() (uint64, error) {
+	return atomic.AddUint64(&r.sequence, 1), nil
+}
+
+func (r *memoryRepository) IncrementHits(hits map[domain.Key]uint64) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for key, n := range hits {
+		if red, ok := r.memory[key]; ok {
+			red.Hits += n
+			r.memory[key] = red
+		}
 	}
 
-	store.Active = false
+	return nil
+}
 
+func (r *memoryRepository) IncrementVariantHits(hits map[domain.Key]map[int]uint64) error {
 	r.m.Lock()
-	r.memory[store.Code] = store
-	r.m.Unlock()
+	defer r.m.Unlock()
+
+	for key, variants := range hits {
+		if _, ok := r.memory[key]; !ok {
+			continue
+		}
+
+		if _, ok := r.variantHits[key]; !ok {
+			r.variantHits[key] = make(map[int]uint64)
+		}
+
+		for variant, n := range variants {
+			r.variantHits[key][variant] += n
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) Top(d string, limit int, now time.Time) ([]ranker.RedirectStorage, error) {
+	r.m.RLock()
+	candidates := make([]redirect, 0, len(r.memory))
+	for _, red := range r.memory {
+		if red.Domain == d && red.Active && red.Password == "" && !lookup.IsExpired(red.ExpiresAt, now) {
+			candidates = append(candidates, red)
+		}
+	}
+	r.m.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Hits != candidates[j].Hits {
+			return candidates[i].Hits > candidates[j].Hits
+		}
+
+		return candidates[i].Code < candidates[j].Code
+	})
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	top := make([]ranker.RedirectStorage, len(candidates))
+	for i, red := range candidates {
+		top[i] = fromRedirectToRankerRedirectStorage(red)
+	}
+
+	return top, nil
+}
+
+func (r *memoryRepository) Scheduled(d string, now time.Time) ([]scheduler.RedirectStorage, error) {
+	r.m.RLock()
+	scheduled := make([]redirect, 0)
+	for _, red := range r.memory {
+		if red.Domain == d && red.Active && red.Password == "" && now.Before(red.NotBefore) && !lookup.IsExpired(red.ExpiresAt, now) {
+			scheduled = append(scheduled, red)
+		}
+	}
+	r.m.RUnlock()
+
+	sort.Slice(scheduled, func(i, j int) bool {
+		if !scheduled[i].NotBefore.Equal(scheduled[j].NotBefore) {
+			return scheduled[i].NotBefore.Before(scheduled[j].NotBefore)
+		}
+
+		return scheduled[i].Code < scheduled[j].Code
+	})
+
+	results := make([]scheduler.RedirectStorage, len(scheduled))
+	for i, red := range scheduled {
+		results[i] = fromRedirectToSchedulerRedirectStorage(red)
+	}
+
+	return results, nil
+}
+
+func (r *memoryRepository) Variants(d, code string, now time.Time) ([]ranker.VariantStorage, error) {
+	key := domain.Key{Domain: d, Code: code}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	red, ok := r.memory[key]
+	if !ok || !red.Active || red.Password != "" || lookup.IsExpired(red.ExpiresAt, now) {
+		return nil, ranker.ErrNotFound
+	}
+
+	variants := make([]ranker.VariantStorage, len(red.Variants))
+	for i, v := range red.Variants {
+		variants[i] = ranker.VariantStorage{
+			Variant: i + 1,
+			URL:     v.URL,
+			Weight:  v.Weight,
+			Hits:    r.variantHits[key][i+1],
+		}
+	}
+
+	return variants, nil
+}
 
+// Ping is the implementation for repository.RedirectRepository#Ping, the memory
+// is always reachable.
+func (r *memoryRepository) Ping(_ context.Context) error {
 	return nil
 }
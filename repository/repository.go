@@ -1,18 +1,57 @@
 package repository
 
 import (
+	"context"
 	"hex-microservice/adder"
+	"hex-microservice/domain"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/scheduler"
+	"time"
 )
 
-// RedirectRepository provides a storage abstraction for service needs.
+// RedirectRepository provides a storage abstraction for service needs. The
+// codes are unique per domain, the default domain is the empty string.
 type RedirectRepository interface {
 	// Lookup returns the storage representation of the redirect for the lookup service.
-	Lookup(code string) (lookup.RedirectStorage, error)
+	// Expired redirects are treated as not found.
+	Lookup(domain, code string, now time.Time) (lookup.RedirectStorage, error)
+	// Use atomically consumes one use of a redirect with max uses for the lookup service.
+	Use(domain, code string, now time.Time) error
 	// Store persists a redirect from the adder service.
 	Store(redirect adder.RedirectStorage) error
-	// Delete deletes a stored redirect.
-	Invalidate(code, token string) error
+	// LookupByURL returns an active redirect of the url on the domain that never expires,
+	// is neither protected nor limited, is activated and has no rules, variants, passthrough
+	// or preview for the adder service.
+	LookupByURL(domain, url string) (adder.RedirectStorage, error)
+	// StoreAll persists all redirects from the adder service in a single transaction.
+	StoreAll(redirects []adder.RedirectStorage) error
+	// Update changes the url of an active redirect for the updater service.
+	// Expired redirects are treated as not found.
+	Update(domain, code, token, url string, now time.Time) error
+	// Invalidate deactivates a stored redirect for the invalidator service.
+	Invalidate(domain, code, token string, now time.Time) error
+	// Restore reactivates an invalidated redirect for the restorer service.
+	Restore(domain, code, token string, invalidatedSince time.Time) error
+	// Purge permanently removes the redirects invalidated before the given point in time.
+	Purge(before time.Time) (int, error)
+	// NextSequence returns the next value of a counter for the sequential code generation.
+	NextSequence() (uint64, error)
+	// IncrementHits adds the given number of hits per redirect.
+	IncrementHits(hits map[domain.Key]uint64) error
+	// IncrementVariantHits adds the given number of hits per redirect and variant.
+	IncrementVariantHits(hits map[domain.Key]map[int]uint64) error
+	// Top returns the active redirects of the domain with the most hits for the ranker service.
+	// The protected redirects aren't listed, their urls are secret.
+	Top(domain string, limit int, now time.Time) ([]ranker.RedirectStorage, error)
+	// Scheduled returns the active redirects of the domain that aren't activated yet for the
+	// scheduler service. The protected redirects aren't listed.
+	Scheduled(domain string, now time.Time) ([]scheduler.RedirectStorage, error)
+	// Variants returns the variants of an active redirect with their hits for the ranker service.
+	// A protected redirect is treated as not found.
+	Variants(domain, code string, now time.Time) ([]ranker.VariantStorage, error)
+	// Ping verifies that the storage is reachable for the readiness check.
+	Ping(ctx context.Context) error
 }
 
 type Close func() error
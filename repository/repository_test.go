@@ -2,14 +2,27 @@ package repository_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"hex-microservice/adder"
+	"hex-microservice/domain"
+	"hex-microservice/hashed"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
 	"hex-microservice/repository"
 	"hex-microservice/repository/gormsqlite"
 	"hex-microservice/repository/memory"
 	"hex-microservice/repository/sqlite"
+	"hex-microservice/restorer"
+	"hex-microservice/targeting"
+	"hex-microservice/updater"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -47,7 +60,7 @@ func TestLookupNonExisting(t *testing.T) {
 			if assert.NoError(t, err) {
 				defer close()
 
-				_, err := repo.Lookup(code)
+				_, err := repo.Lookup(domain.Default, code, time.Now())
 				assert.ErrorIs(t, err, lookup.ErrNotFound)
 			}
 		})
@@ -79,7 +92,7 @@ func TestStoreAndReadBack(t *testing.T) {
 					URL:   url,
 				})
 				if assert.NoError(t, err) {
-					lookedUp, err := repo.Lookup(code)
+					lookedUp, err := repo.Lookup(domain.Default, code, time.Now())
 					if assert.NoError(t, err) {
 						assert.Equal(t, code, lookedUp.Code)
 					}
@@ -89,6 +102,46 @@ func TestStoreAndReadBack(t *testing.T) {
 	}
 }
 
+func TestLookupExpired(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		code  = "code"
+		token = "token"
+		url   = "https://example.com"
+	)
+
+	now := time.Now()
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				err = repo.Store(adder.RedirectStorage{
+					Code:      code,
+					Token:     token,
+					URL:       url,
+					CreatedAt: now,
+					ExpiresAt: now.Add(time.Hour),
+				})
+				if assert.NoError(t, err) {
+					_, err := repo.Lookup(domain.Default, code, now)
+					assert.NoError(t, err)
+
+					_, err = repo.Lookup(domain.Default, code, now.Add(2*time.Hour))
+					assert.ErrorIs(t, err, lookup.ErrNotFound)
+				}
+			}
+		})
+	}
+}
+
 func TestStoreTwice(t *testing.T) {
 	ctx := context.Background()
 
@@ -127,6 +180,83 @@ func TestStoreTwice(t *testing.T) {
 	}
 }
 
+func TestStoreAllIsAtomic(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		code  = "code"
+		taken = "taken"
+		token = "token"
+		url   = "https://example.com"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				err = repo.Store(adder.RedirectStorage{
+					Code:  taken,
+					Token: token,
+					URL:   url,
+				})
+				if assert.NoError(t, err) {
+					err := repo.StoreAll([]adder.RedirectStorage{
+						{Code: code, Token: token, URL: url},
+						{Code: taken, Token: token, URL: url},
+					})
+
+					var itemErr *adder.ItemError
+					if assert.ErrorAs(t, err, &itemErr) {
+						assert.Equal(t, 1, itemErr.Index)
+						assert.ErrorIs(t, err, adder.ErrDuplicate)
+					}
+
+					_, err = repo.Lookup(domain.Default, code, time.Now())
+					assert.ErrorIs(t, err, lookup.ErrNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreAllDuplicateWithinBatch(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		code  = "code"
+		token = "token"
+		url   = "https://example.com"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				err := repo.StoreAll([]adder.RedirectStorage{
+					{Code: code, Token: token, URL: url},
+					{Code: code, Token: token, URL: url},
+				})
+				assert.ErrorIs(t, err, adder.ErrDuplicate)
+
+				_, err = repo.Lookup(domain.Default, code, time.Now())
+				assert.ErrorIs(t, err, lookup.ErrNotFound)
+			}
+		})
+	}
+}
+
 func TestInvalidateNonExisting(t *testing.T) {
 	ctx := context.Background()
 
@@ -145,7 +275,7 @@ func TestInvalidateNonExisting(t *testing.T) {
 			if assert.NoError(t, err) {
 				defer close()
 
-				err := repo.Invalidate(code, token)
+				err := repo.Invalidate(domain.Default, code, token, time.Now())
 				assert.ErrorIs(t, err, invalidator.ErrNotFound)
 			}
 		})
@@ -178,7 +308,7 @@ func TestInvalidateInvalidToken(t *testing.T) {
 					URL:   url,
 				})
 				if assert.NoError(t, err) {
-					err := repo.Invalidate(code, invalidToken)
+					err := repo.Invalidate(domain.Default, code, invalidToken, time.Now())
 					assert.ErrorIs(t, err, invalidator.ErrNotFound)
 				}
 			}
@@ -211,9 +341,9 @@ func TestInvalidate(t *testing.T) {
 					URL:   url,
 				})
 				if assert.NoError(t, err) {
-					err := repo.Invalidate(code, token)
+					err := repo.Invalidate(domain.Default, code, token, time.Now())
 					if assert.NoError(t, err) {
-						_, err := repo.Lookup(code)
+						_, err := repo.Lookup(domain.Default, code, time.Now())
 						assert.ErrorIs(t, err, lookup.ErrNotFound)
 					}
 				}
@@ -222,13 +352,13 @@ func TestInvalidate(t *testing.T) {
 	}
 }
 
-func TestInvalidateAndAdd(t *testing.T) {
+func TestInvalidateTwice(t *testing.T) {
 	ctx := context.Background()
+	now := time.Now()
 
 	const (
-		code  = "code"
+		code  = "invalidated-twice"
 		token = "token"
-		url   = "https://example.com"
 	)
 
 	for _, ri := range repositoryImplementations {
@@ -244,21 +374,971 @@ func TestInvalidateAndAdd(t *testing.T) {
 				err = repo.Store(adder.RedirectStorage{
 					Code:  code,
 					Token: token,
+					URL:   "https://example.com",
+				})
+				if assert.NoError(t, err) && assert.NoError(t, repo.Invalidate(domain.Default, code, token, now.Add(-2*time.Hour))) {
+					// the invalidated redirect isn't found anymore and keeps its first invalidation
+					assert.ErrorIs(t, repo.Invalidate(domain.Default, code, token, now), invalidator.ErrNotFound)
+					assert.ErrorIs(t, repo.Restore(domain.Default, code, token, now.Add(-time.Hour)), restorer.ErrWindowClosed)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidateHashedToken(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		code  = "hashed"
+		token = "token"
+		url   = "https://example.com"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				hashedToken, err := hashed.Token(token)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				err = repo.Store(adder.RedirectStorage{
+					Code:  code,
+					Token: hashedToken,
 					URL:   url,
 				})
 				if assert.NoError(t, err) {
-					err := repo.Invalidate(code, token)
-					if assert.NoError(t, err) {
-						err = repo.Store(adder.RedirectStorage{
-							Code:  code,
-							Token: token,
-							URL:   url,
-						})
+					assert.ErrorIs(t, repo.Update(domain.Default, code, hashedToken, url, time.Now()), updater.ErrNotFound)
+					assert.ErrorIs(t, repo.Invalidate(domain.Default, code, hashedToken, time.Now()), invalidator.ErrNotFound)
 
-						assert.ErrorIs(t, err, adder.ErrDuplicate)
-					}
+					assert.NoError(t, repo.Update(domain.Default, code, token, url, time.Now()))
+					assert.NoError(t, repo.Invalidate(domain.Default, code, token, time.Now()))
 				}
 			}
 		})
 	}
 }
+
+func TestSqliteHashesPlaintextTokens(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "redirects.db")
+
+	const (
+		code  = "code"
+		token = "token"
+		url   = "https://example.com/plaintext"
+	)
+
+	repo, close, err := sqlite.New(ctx, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a database of a former version holds the plaintext token
+	err = repo.Store(adder.RedirectStorage{Code: code, Token: token, URL: url, CreatedAt: time.Now()})
+	close()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	repo, close, err = sqlite.New(ctx, dsn)
+	if assert.NoError(t, err) {
+		defer close()
+
+		stored, err := repo.LookupByURL(domain.Default, url)
+		if assert.NoError(t, err) {
+			assert.True(t, hashed.IsHashed(stored.Token))
+			assert.True(t, hashed.Verify(stored.Token, token))
+		}
+
+		assert.NoError(t, repo.Invalidate(domain.Default, code, token, time.Now()))
+	}
+}
+
+func TestGormSqliteAddsDomain(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "redirects.db")
+
+	const (
+		code = "code"
+		url  = "https://example.com/former"
+	)
+
+	// a database of a former version has the code as primary key
+	database, err := sql.Open("sqlite3", dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, statement := range []string{
+		`CREATE TABLE "redirects" ("code" varchar(255), "active" bool, "token" varchar(255), "url" varchar(255), "created_at" datetime, "expires_at" datetime, "password" varchar(255), "hits" bigint, PRIMARY KEY ("code"))`,
+		`CREATE INDEX idx_redirects_url ON "redirects"(url)`,
+		`CREATE TABLE "variant_hits" ("code" varchar(255), "variant" integer, "hits" bigint, PRIMARY KEY ("code", "variant"))`,
+		`INSERT INTO "redirects" VALUES ('` + code + `', 1, 'token', '` + url + `', '2024-01-02 03:04:05+00:00', '0001-01-01 00:00:00+00:00', '', 3)`,
+		`INSERT INTO "redirects" VALUES ('invalidated', 0, 'token', '` + url + `', '2024-01-02 03:04:05+00:00', '0001-01-01 00:00:00+00:00', '', 0)`,
+		`INSERT INTO "variant_hits" VALUES ('` + code + `', 1, 2)`,
+	} {
+		if _, err := database.Exec(statement); !assert.NoError(t, err, statement) {
+			database.Close()
+			return
+		}
+	}
+	database.Close()
+
+	// the rebuilt database is opened again without another rebuild
+	_, close, err := gormsqlite.New(ctx, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	close()
+
+	repo, close, err := gormsqlite.New(ctx, dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer close()
+
+	// the existing redirects belong to the default domain
+	if stored, err := repo.Lookup(domain.Default, code, time.Now()); assert.NoError(t, err) {
+		assert.Equal(t, url, stored.URL)
+	}
+
+	if top, err := repo.Top(domain.Default, 1, time.Now()); assert.NoError(t, err) && assert.Len(t, top, 1) {
+		assert.Equal(t, uint64(3), top[0].Hits)
+	}
+
+	// the code is unique per domain
+	assert.NoError(t, repo.Store(adder.RedirectStorage{Domain: "go.example", Code: code, Token: "token", URL: url, CreatedAt: time.Now()}))
+
+	// the former invalidations count from the migration on
+	if n, err := repo.Purge(time.Now().Add(-time.Hour)); assert.NoError(t, err) {
+		assert.Equal(t, 0, n)
+	}
+
+	if n, err := repo.Purge(time.Now().Add(time.Minute)); assert.NoError(t, err) {
+		assert.Equal(t, 1, n)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/purge"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.StoreAll([]adder.RedirectStorage{
+					{Code: "purged", Token: token, URL: url, CreatedAt: now},
+					{Code: "graced", Token: token, URL: url, CreatedAt: now},
+					{Code: "active", Token: token, URL: url, CreatedAt: now},
+				}))
+				assert.NoError(t, repo.Invalidate(domain.Default, "purged", token, now.Add(-2*time.Hour)))
+				assert.NoError(t, repo.Invalidate(domain.Default, "graced", token, now))
+
+				n, err := repo.Purge(now.Add(-time.Hour))
+				if assert.NoError(t, err) {
+					assert.Equal(t, 1, n)
+				}
+
+				// the code of a purged redirect is available again
+				assert.NoError(t, repo.Store(adder.RedirectStorage{Code: "purged", Token: token, URL: url, CreatedAt: now}))
+				assert.ErrorIs(t, repo.Store(adder.RedirectStorage{Code: "graced", Token: token, URL: url, CreatedAt: now}), adder.ErrDuplicate)
+
+				_, err = repo.Lookup(domain.Default, "active", now)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token   = "token"
+		url     = "https://example.com/use"
+		maxUses = 3
+		lookups = 10
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.Store(adder.RedirectStorage{Code: "limited", Token: token, URL: url, CreatedAt: now, MaxUses: maxUses}))
+				assert.ErrorIs(t, repo.Use(domain.Default, "unknown", now), lookup.ErrNotFound)
+
+				// the concurrent lookups race for the uses
+				var (
+					wg        sync.WaitGroup
+					used      int32
+					exhausted int32
+				)
+				for i := 0; i < lookups; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						err := repo.Use(domain.Default, "limited", now)
+						switch {
+						case err == nil:
+							atomic.AddInt32(&used, 1)
+						case errors.Is(err, lookup.ErrExhausted):
+							atomic.AddInt32(&exhausted, 1)
+						default:
+							assert.NoError(t, err)
+						}
+					}()
+				}
+				wg.Wait()
+
+				assert.Equal(t, int32(maxUses), used)
+				assert.Equal(t, int32(lookups-maxUses), exhausted)
+
+				red, err := repo.Lookup(domain.Default, "limited", now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, maxUses, red.MaxUses)
+					assert.Equal(t, maxUses, red.Uses)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduled(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/scheduled"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now().UTC().Truncate(time.Second)
+
+				assert.NoError(t, repo.StoreAll([]adder.RedirectStorage{
+					{Code: "scheduled-later", Token: token, URL: url, CreatedAt: now, NotBefore: now.Add(2 * time.Hour)},
+					{Code: "scheduled-soon", Token: token, URL: url, CreatedAt: now, NotBefore: now.Add(time.Hour)},
+					{Code: "scheduled-past", Token: token, URL: url, CreatedAt: now, NotBefore: now.Add(-time.Hour)},
+					{Code: "scheduled-expired", Token: token, URL: url, CreatedAt: now, NotBefore: now.Add(time.Hour), ExpiresAt: now.Add(time.Minute)},
+					{Code: "scheduled-invalidated", Token: token, URL: url, CreatedAt: now, NotBefore: now.Add(time.Hour)},
+					{Code: "unscheduled", Token: token, URL: url, CreatedAt: now},
+				}))
+				assert.NoError(t, repo.Invalidate(domain.Default, "scheduled-invalidated", token, now))
+
+				scheduled, err := repo.Scheduled(domain.Default, now.Add(2*time.Minute))
+				if assert.NoError(t, err) && assert.Len(t, scheduled, 2) {
+					assert.Equal(t, "scheduled-soon", scheduled[0].Code)
+					assert.True(t, now.Add(time.Hour).Equal(scheduled[0].NotBefore))
+					assert.Equal(t, "scheduled-later", scheduled[1].Code)
+				}
+
+				red, err := repo.Lookup(domain.Default, "scheduled-soon", now)
+				if assert.NoError(t, err) {
+					assert.True(t, now.Add(time.Hour).Equal(red.NotBefore))
+				}
+
+				// only the redirects without activation are reused
+				found, err := repo.LookupByURL(domain.Default, url)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "unscheduled", found.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/rules"
+	)
+
+	rules := targeting.Rules{
+		{Device: targeting.DeviceMobile, URL: "https://apps.example/"},
+		{Language: "de", Query: map[string]string{"campaign": "spring"}, URL: "https://example.com/de"},
+	}
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.StoreAll([]adder.RedirectStorage{
+					{Code: "targeted", Token: token, URL: url, CreatedAt: now.Add(-time.Hour), Rules: rules},
+					{Code: "untargeted", Token: token, URL: url, CreatedAt: now},
+				}))
+
+				red, err := repo.Lookup(domain.Default, "targeted", now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, rules, red.Rules)
+				}
+
+				red, err = repo.Lookup(domain.Default, "untargeted", now)
+				if assert.NoError(t, err) {
+					assert.Empty(t, red.Rules)
+				}
+
+				// only the redirects without rules are reused
+				found, err := repo.LookupByURL(domain.Default, url)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "untargeted", found.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestVariants(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/variants"
+	)
+
+	variants := targeting.Variants{
+		{URL: "https://example.com/a", Weight: 70},
+		{URL: "https://example.com/b", Weight: 30},
+	}
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.StoreAll([]adder.RedirectStorage{
+					{Code: "experiment", Token: token, URL: url, CreatedAt: now.Add(-time.Hour), Variants: variants},
+					{Code: "plain", Token: token, URL: url, CreatedAt: now},
+				}))
+
+				red, err := repo.Lookup(domain.Default, "experiment", now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, variants, red.Variants)
+				}
+
+				// only the redirects without variants are reused
+				found, err := repo.LookupByURL(domain.Default, url)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "plain", found.Code)
+				}
+
+				assert.NoError(t, repo.IncrementVariantHits(map[domain.Key]map[int]uint64{{Code: "experiment"}: {1: 3, 2: 1}}))
+				assert.NoError(t, repo.IncrementVariantHits(map[domain.Key]map[int]uint64{{Code: "experiment"}: {1: 2}}))
+
+				compared, err := repo.Variants(domain.Default, "experiment", now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, []ranker.VariantStorage{
+						{Variant: 1, URL: "https://example.com/a", Weight: 70, Hits: 5},
+						{Variant: 2, URL: "https://example.com/b", Weight: 30, Hits: 1},
+					}, compared)
+				}
+
+				compared, err = repo.Variants(domain.Default, "plain", now)
+				if assert.NoError(t, err) {
+					assert.Empty(t, compared)
+				}
+
+				_, err = repo.Variants(domain.Default, "unknown", now)
+				assert.ErrorIs(t, err, ranker.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/passthrough"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.StoreAll([]adder.RedirectStorage{
+					{Code: "passing", Token: token, URL: url, CreatedAt: now.Add(-time.Hour), Passthrough: true},
+					{Code: "exact", Token: token, URL: url, CreatedAt: now},
+				}))
+
+				red, err := repo.Lookup(domain.Default, "passing", now)
+				if assert.NoError(t, err) {
+					assert.True(t, red.Passthrough)
+				}
+
+				red, err = repo.Lookup(domain.Default, "exact", now)
+				if assert.NoError(t, err) {
+					assert.False(t, red.Passthrough)
+				}
+
+				// only the redirects without passthrough are reused
+				found, err := repo.LookupByURL(domain.Default, url)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "exact", found.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/preview"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.Store(adder.RedirectStorage{Code: "previewed", Token: token, URL: url, CreatedAt: now, Preview: true}))
+
+				red, err := repo.Lookup(domain.Default, "previewed", now)
+				if assert.NoError(t, err) {
+					assert.True(t, red.Preview)
+				}
+
+				// a redirect that is always previewed isn't reused
+				_, err = repo.LookupByURL(domain.Default, url)
+				assert.ErrorIs(t, err, adder.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/status"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.Store(adder.RedirectStorage{Code: "moved", Token: token, URL: url, CreatedAt: now, StatusCode: http.StatusMovedPermanently}))
+
+				red, err := repo.Lookup(domain.Default, "moved", now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, http.StatusMovedPermanently, red.StatusCode)
+				}
+
+				found, err := repo.LookupByURL(domain.Default, url)
+				if assert.NoError(t, err) {
+					assert.Equal(t, http.StatusMovedPermanently, found.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com/restore"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.StoreAll([]adder.RedirectStorage{
+					{Code: "restored", Token: token, URL: url, CreatedAt: now},
+					{Code: "closed", Token: token, URL: url, CreatedAt: now},
+				}))
+				assert.NoError(t, repo.Invalidate(domain.Default, "restored", token, now))
+				assert.NoError(t, repo.Invalidate(domain.Default, "closed", token, now.Add(-2*time.Hour)))
+
+				assert.ErrorIs(t, repo.Restore(domain.Default, "restored", "wrong", now.Add(-time.Hour)), restorer.ErrNotFound)
+				assert.ErrorIs(t, repo.Restore(domain.Default, "missing", token, now.Add(-time.Hour)), restorer.ErrNotFound)
+				assert.ErrorIs(t, repo.Restore(domain.Default, "closed", token, now.Add(-time.Hour)), restorer.ErrWindowClosed)
+
+				if assert.NoError(t, repo.Restore(domain.Default, "restored", token, now.Add(-time.Hour))) {
+					_, err := repo.Lookup(domain.Default, "restored", now)
+					assert.NoError(t, err)
+
+					// an active redirect isn't restored again
+					assert.ErrorIs(t, repo.Restore(domain.Default, "restored", token, now.Add(-time.Hour)), restorer.ErrNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidateAndAdd(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		code  = "code"
+		token = "token"
+		url   = "https://example.com"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				err = repo.Store(adder.RedirectStorage{
+					Code:  code,
+					Token: token,
+					URL:   url,
+				})
+				if assert.NoError(t, err) {
+					err := repo.Invalidate(domain.Default, code, token, time.Now())
+					if assert.NoError(t, err) {
+						err = repo.Store(adder.RedirectStorage{
+							Code:  code,
+							Token: token,
+							URL:   url,
+						})
+
+						assert.ErrorIs(t, err, adder.ErrDuplicate)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		code    = "code"
+		token   = "token"
+		url     = "https://example.com"
+		updated = "https://example.org"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				err = repo.Store(adder.RedirectStorage{
+					Code:  code,
+					Token: token,
+					URL:   url,
+				})
+				if assert.NoError(t, err) {
+					err := repo.Update(domain.Default, code, token+token, updated, time.Now())
+					assert.ErrorIs(t, err, updater.ErrNotFound)
+
+					err = repo.Update(domain.Default, code, token, updated, time.Now())
+					if assert.NoError(t, err) {
+						red, err := repo.Lookup(domain.Default, code, time.Now())
+						if assert.NoError(t, err) {
+							assert.Equal(t, updated, red.URL)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateInvalidatedOrExpired(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		invalidated = "invalidated"
+		expired     = "expired"
+		token       = "token"
+		url         = "https://example.com"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				assert.NoError(t, repo.Store(adder.RedirectStorage{
+					Code:      invalidated,
+					Token:     token,
+					URL:       url,
+					CreatedAt: now,
+				}))
+				assert.NoError(t, repo.Invalidate(domain.Default, invalidated, token, time.Now()))
+				assert.NoError(t, repo.Store(adder.RedirectStorage{
+					Code:      expired,
+					Token:     token,
+					URL:       url,
+					CreatedAt: now,
+					ExpiresAt: now.Add(time.Minute),
+				}))
+
+				err := repo.Update(domain.Default, invalidated, token, url, now)
+				assert.ErrorIs(t, err, updater.ErrNotFound)
+
+				err = repo.Update(domain.Default, expired, token, url, now.Add(time.Hour))
+				assert.ErrorIs(t, err, updater.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestLookupByURL(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		url   = "https://example.com/"
+		token = "token"
+	)
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				now := time.Now()
+
+				_, err := repo.LookupByURL(domain.Default, url)
+				assert.ErrorIs(t, err, adder.ErrNotFound)
+
+				assert.NoError(t, repo.StoreAll([]adder.RedirectStorage{
+					{Code: "invalidated", Token: token, URL: url, CreatedAt: now.Add(-time.Hour)},
+					{Code: "expiring", Token: token, URL: url, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+					{Code: "other", Token: token, URL: "https://example.org/", CreatedAt: now.Add(-time.Hour)},
+					{Code: "newer", Token: token, URL: url, CreatedAt: now},
+					{Code: "older", Token: token, URL: url, CreatedAt: now.Add(-time.Minute), Owner: "key"},
+					{Code: "protected", Token: token, URL: url, CreatedAt: now.Add(-2 * time.Hour), Password: "hash"},
+				}))
+				assert.NoError(t, repo.Invalidate(domain.Default, "invalidated", token, time.Now()))
+
+				found, err := repo.LookupByURL(domain.Default, url)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "older", found.Code)
+					assert.Equal(t, url, found.URL)
+					assert.Equal(t, "key", found.Owner)
+				}
+
+				protected, err := repo.Lookup(domain.Default, "protected", now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, "hash", protected.Password)
+				}
+			}
+		})
+	}
+}
+
+func TestNextSequence(t *testing.T) {
+	ctx := context.Background()
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				first, err := repo.NextSequence()
+				if assert.NoError(t, err) {
+					second, err := repo.NextSequence()
+					if assert.NoError(t, err) {
+						assert.Equal(t, first+1, second)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTop(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		token = "token"
+		url   = "https://example.com"
+	)
+
+	now := time.Now()
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				for _, r := range []adder.RedirectStorage{
+					{Code: "first", Token: token, URL: url, CreatedAt: now},
+					{Code: "second", Token: token, URL: url, CreatedAt: now},
+					{Code: "third", Token: token, URL: url, CreatedAt: now},
+					{Code: "expired", Token: token, URL: url, CreatedAt: now, ExpiresAt: now.Add(time.Minute)},
+				} {
+					assert.NoError(t, repo.Store(r))
+				}
+
+				err := repo.IncrementHits(map[domain.Key]uint64{{Code: "first"}: 5, {Code: "second"}: 2, {Code: "expired"}: 10})
+				if assert.NoError(t, err) {
+					err := repo.IncrementHits(map[domain.Key]uint64{{Code: "second"}: 1, {Code: "unknown"}: 1})
+					if assert.NoError(t, err) {
+						top, err := repo.Top(domain.Default, 2, now.Add(time.Hour))
+						if assert.NoError(t, err) {
+							assert.Equal(t, []ranker.RedirectStorage{
+								{Code: "first", URL: url, Hits: 5},
+								{Code: "second", URL: url, Hits: 3},
+							}, top)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDomains(t *testing.T) {
+	ctx := context.Background()
+
+	const (
+		other = "domains.example"
+		code  = "namespaced"
+		token = "token"
+		url   = "https://example.com/namespaced"
+	)
+
+	now := time.Now()
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				// the same code is allowed on different domains
+				assert.NoError(t, repo.Store(adder.RedirectStorage{Code: code, Token: token, URL: url, CreatedAt: now}))
+				assert.NoError(t, repo.Store(adder.RedirectStorage{Domain: other, Code: code, Token: token, URL: url + "/other", CreatedAt: now}))
+				assert.ErrorIs(t, repo.Store(adder.RedirectStorage{Domain: other, Code: code, Token: token, URL: url, CreatedAt: now}), adder.ErrDuplicate)
+
+				red, err := repo.Lookup(other, code, now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, url+"/other", red.URL)
+				}
+
+				_, err = repo.Lookup(other, "unknown", now)
+				assert.ErrorIs(t, err, lookup.ErrNotFound)
+
+				found, err := repo.LookupByURL(other, url)
+				assert.ErrorIs(t, err, adder.ErrNotFound)
+
+				found, err = repo.LookupByURL(other, url+"/other")
+				if assert.NoError(t, err) {
+					assert.Equal(t, other, found.Domain)
+				}
+
+				err = repo.IncrementHits(map[domain.Key]uint64{{Domain: other, Code: code}: 2})
+				if assert.NoError(t, err) {
+					top, err := repo.Top(other, 10, now)
+					if assert.NoError(t, err) {
+						assert.Equal(t, []ranker.RedirectStorage{{Code: code, URL: url + "/other", Hits: 2}}, top)
+					}
+				}
+
+				// the invalidation of a code leaves the other domains alone
+				assert.NoError(t, repo.Invalidate(other, code, token, now))
+
+				_, err = repo.Lookup(other, code, now)
+				assert.ErrorIs(t, err, lookup.ErrNotFound)
+
+				red, err = repo.Lookup(domain.Default, code, now)
+				if assert.NoError(t, err) {
+					assert.Equal(t, url, red.URL)
+				}
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				assert.NoError(t, repo.Ping(ctx))
+
+				// a closed database is unreachable
+				if assert.NoError(t, close()) && ri.name != "memory" {
+					assert.Error(t, repo.Ping(ctx))
+				}
+			}
+		})
+	}
+}
+
+func TestListingsExcludeProtected(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+
+	for _, ri := range repositoryImplementations {
+		ri := ri // pin
+
+		t.Run(ri.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo, close, err := ri.new(ctx, ri.config)
+			if assert.NoError(t, err) {
+				defer close()
+
+				for _, r := range []adder.RedirectStorage{
+					{Code: "protected", Token: "token", URL: "https://example.com/secret", Password: "hash", CreatedAt: now},
+					{Code: "protected-scheduled", Token: "token", URL: "https://example.com/launch", Password: "hash", CreatedAt: now, NotBefore: now.Add(time.Hour)},
+					{
+						Code: "protected-variants", Token: "token", URL: "https://example.com/", Password: "hash", CreatedAt: now,
+						Variants: targeting.Variants{{URL: "https://example.com/a", Weight: 1}},
+					},
+				} {
+					assert.NoError(t, repo.Store(r))
+				}
+
+				if assert.NoError(t, repo.IncrementHits(map[domain.Key]uint64{{Code: "protected"}: 10})) {
+					top, err := repo.Top(domain.Default, 10, now)
+					if assert.NoError(t, err) {
+						assert.Empty(t, top)
+					}
+				}
+
+				scheduled, err := repo.Scheduled(domain.Default, now)
+				if assert.NoError(t, err) {
+					assert.Empty(t, scheduled)
+				}
+
+				_, err = repo.Variants(domain.Default, "protected-variants", now)
+				assert.ErrorIs(t, err, ranker.ErrNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN expires_at;
\ No newline at end of file
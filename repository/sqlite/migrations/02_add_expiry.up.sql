@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN expires_at TEXT NULL;
\ No newline at end of file
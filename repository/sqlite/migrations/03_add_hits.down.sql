@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN hits;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN hits INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS redirects_url;
\ No newline at end of file
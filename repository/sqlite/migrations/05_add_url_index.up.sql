@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS redirects_url ON redirects (url);
\ No newline at end of file
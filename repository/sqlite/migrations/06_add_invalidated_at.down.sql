@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN invalidated_at;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE redirects ADD COLUMN invalidated_at TEXT NULL;
+-- the grace period of the redirects invalidated before starts with the migration
+UPDATE redirects SET invalidated_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now') WHERE active = 0;
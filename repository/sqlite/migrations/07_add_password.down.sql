@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN password;
\ No newline at end of file
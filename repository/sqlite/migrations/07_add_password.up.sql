@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN password TEXT NOT NULL DEFAULT '';
\ No newline at end of file
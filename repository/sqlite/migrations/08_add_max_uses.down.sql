@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN max_uses;ALTER TABLE redirects DROP COLUMN uses;
\ No newline at end of file
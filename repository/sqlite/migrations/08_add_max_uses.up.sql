@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN max_uses INTEGER NOT NULL DEFAULT 0;ALTER TABLE redirects ADD COLUMN uses INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN not_before;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN not_before TEXT NULL;
\ No newline at end of file
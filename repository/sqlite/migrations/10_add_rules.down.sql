@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN rules;
\ No newline at end of file
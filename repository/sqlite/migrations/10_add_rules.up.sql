@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN rules TEXT NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS variant_hits;
+ALTER TABLE redirects DROP COLUMN variants;
\ No newline at end of file
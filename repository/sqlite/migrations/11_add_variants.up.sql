@@ -0,0 +1,7 @@
+ALTER TABLE redirects ADD COLUMN variants TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS variant_hits (
+  code TEXT NOT NULL,
+  variant INTEGER NOT NULL,
+  hits INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (code, variant)
+);
@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN passthrough;
\ No newline at end of file
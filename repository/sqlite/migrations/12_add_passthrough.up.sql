@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN passthrough BOOLEAN NOT NULL DEFAULT 0 CHECK (passthrough IN (0, 1));
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN status_code;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN status_code INTEGER NOT NULL DEFAULT 307;
\ No newline at end of file
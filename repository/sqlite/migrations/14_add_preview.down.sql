@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN preview;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE redirects ADD COLUMN preview BOOLEAN NOT NULL DEFAULT 0 CHECK (preview IN (0, 1));
\ No newline at end of file
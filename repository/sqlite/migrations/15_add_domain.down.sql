@@ -0,0 +1,35 @@
+-- only the redirects of the default domain fit into the namespace without domains
+CREATE TABLE redirects_without_domain (
+  code TEXT PRIMARY KEY,
+  token TEXT NOT NULL,
+  url TEXT NOT NULL,
+  active  BOOLEAN NOT NULL CHECK (active IN (0, 1)),
+  client_info TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  expires_at TEXT NULL,
+  hits INTEGER NOT NULL DEFAULT 0,
+  invalidated_at TEXT NULL,
+  password TEXT NOT NULL DEFAULT '',
+  max_uses INTEGER NOT NULL DEFAULT 0,
+  uses INTEGER NOT NULL DEFAULT 0,
+  not_before TEXT NULL,
+  rules TEXT NOT NULL DEFAULT '',
+  variants TEXT NOT NULL DEFAULT '',
+  passthrough BOOLEAN NOT NULL DEFAULT 0 CHECK (passthrough IN (0, 1)),
+  status_code INTEGER NOT NULL DEFAULT 307,
+  preview BOOLEAN NOT NULL DEFAULT 0 CHECK (preview IN (0, 1))
+);
+INSERT INTO redirects_without_domain (code, token, url, active, client_info, created_at, expires_at, hits, invalidated_at, password, max_uses, uses, not_before, rules, variants, passthrough, status_code, preview) SELECT code, token, url, active, client_info, created_at, expires_at, hits, invalidated_at, password, max_uses, uses, not_before, rules, variants, passthrough, status_code, preview FROM redirects WHERE domain = '';
+DROP TABLE redirects;
+ALTER TABLE redirects_without_domain RENAME TO redirects;
+CREATE INDEX IF NOT EXISTS redirects_url ON redirects (url);
+
+CREATE TABLE variant_hits_without_domain (
+  code TEXT NOT NULL,
+  variant INTEGER NOT NULL,
+  hits INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (code, variant)
+);
+INSERT INTO variant_hits_without_domain (code, variant, hits) SELECT code, variant, hits FROM variant_hits WHERE domain = '';
+DROP TABLE variant_hits;
+ALTER TABLE variant_hits_without_domain RENAME TO variant_hits;
\ No newline at end of file
@@ -0,0 +1,38 @@
+-- the codes are unique per domain, the existing redirects belong to the default domain
+CREATE TABLE redirects_per_domain (
+  domain TEXT NOT NULL DEFAULT '',
+  code TEXT NOT NULL,
+  token TEXT NOT NULL,
+  url TEXT NOT NULL,
+  active  BOOLEAN NOT NULL CHECK (active IN (0, 1)),
+  client_info TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  expires_at TEXT NULL,
+  hits INTEGER NOT NULL DEFAULT 0,
+  invalidated_at TEXT NULL,
+  password TEXT NOT NULL DEFAULT '',
+  max_uses INTEGER NOT NULL DEFAULT 0,
+  uses INTEGER NOT NULL DEFAULT 0,
+  not_before TEXT NULL,
+  rules TEXT NOT NULL DEFAULT '',
+  variants TEXT NOT NULL DEFAULT '',
+  passthrough BOOLEAN NOT NULL DEFAULT 0 CHECK (passthrough IN (0, 1)),
+  status_code INTEGER NOT NULL DEFAULT 307,
+  preview BOOLEAN NOT NULL DEFAULT 0 CHECK (preview IN (0, 1)),
+  PRIMARY KEY (domain, code)
+);
+INSERT INTO redirects_per_domain (code, token, url, active, client_info, created_at, expires_at, hits, invalidated_at, password, max_uses, uses, not_before, rules, variants, passthrough, status_code, preview) SELECT code, token, url, active, client_info, created_at, expires_at, hits, invalidated_at, password, max_uses, uses, not_before, rules, variants, passthrough, status_code, preview FROM redirects;
+DROP TABLE redirects;
+ALTER TABLE redirects_per_domain RENAME TO redirects;
+CREATE INDEX IF NOT EXISTS redirects_url ON redirects (domain, url);
+
+CREATE TABLE variant_hits_per_domain (
+  domain TEXT NOT NULL DEFAULT '',
+  code TEXT NOT NULL,
+  variant INTEGER NOT NULL,
+  hits INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (domain, code, variant)
+);
+INSERT INTO variant_hits_per_domain (code, variant, hits) SELECT code, variant, hits FROM variant_hits;
+DROP TABLE variant_hits;
+ALTER TABLE variant_hits_per_domain RENAME TO variant_hits;
\ No newline at end of file
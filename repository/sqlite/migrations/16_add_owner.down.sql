@@ -0,0 +1 @@
+ALTER TABLE redirects DROP COLUMN owner;
\ No newline at end of file
@@ -10,9 +10,16 @@ import (
 	"errors"
 	"fmt"
 	"hex-microservice/adder"
+	"hex-microservice/domain"
+	"hex-microservice/hashed"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
 	"hex-microservice/repository"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/targeting"
+	"hex-microservice/updater"
 	"strings"
 	"time"
 
@@ -31,7 +38,11 @@ type sqliteRepository struct {
 //go:embed migrations/*.sql
 var fs embed.FS
 
-const tableName = "redirects"
+const (
+	tableName           = "redirects"
+	sequenceTableName   = "sequences"
+	variantHitTableName = "variant_hits"
+)
 
 // databaseUp migrates the database to the latest schema.
 func databaseUp(database *sql.DB) error {
@@ -50,7 +61,8 @@ func databaseUp(database *sql.DB) error {
 		return err
 	}
 
-	if err := m.Up(); err != nil {
+	// an up to date database is fine
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		return err
 	}
 
@@ -69,26 +81,124 @@ func New(parent context.Context, url string) (repository.RedirectRepository, rep
 		return nil, nil, err
 	}
 
+	if err := hashPlaintextTokens(database); err != nil {
+		return nil, nil, err
+	}
+
 	return &sqliteRepository{
 		parent: parent,
 		db:     database,
 	}, database.Close, nil
 }
 
+// hashPlaintextTokens replaces the plaintext tokens of a database of a former
+// version by their salted hashes, the tokens stay valid.
+func hashPlaintextTokens(database *sql.DB) error {
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(fmt.Sprintf(`
+	SELECT
+		domain, code, token
+	FROM '%s'
+	WHERE
+		token NOT LIKE ?
+	`, tableName), hashed.Prefix+"%")
+	if err != nil {
+		return err
+	}
+
+	plaintext := map[domain.Key]string{}
+	for rows.Next() {
+		var (
+			key   domain.Key
+			token string
+		)
+		if err := rows.Scan(&key.Domain, &key.Code, &token); err != nil {
+			rows.Close()
+			return err
+		}
+
+		plaintext[key] = token
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for key, token := range plaintext {
+		hashedToken, err := hashed.Token(token)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE '%s' SET token = ? WHERE domain = ? AND code = ?`, tableName), hashedToken, key.Domain, key.Code); err != nil {
+			return fmt.Errorf("hashing the token of %s: %w", key.Code, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// verifyToken reports whether the token matches the hashed token of the
+// redirect that is selected by the condition.
+func verifyToken(tx *sql.Tx, token, condition string, args ...any) (bool, error) {
+	var stored string
+
+	err := tx.QueryRow(fmt.Sprintf(`SELECT token FROM '%s' WHERE %s`, tableName, condition), args...).Scan(&stored)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return hashed.Verify(stored, token), nil
+}
+
+// nullableTime returns the textual representation of a point in time or NULL
+// for the zero time.
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseNullableTime returns the point in time of its textual representation,
+// NULL is the zero time.
+func parseNullableTime(s sql.NullString) (time.Time, error) {
+	if !s.Valid {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s.String)
+}
+
 // LookupFind is the implementation for repository.RedirectRepository#LookupFind.
-func (s *sqliteRepository) Lookup(code string) (lookup.RedirectStorage, error) {
+func (s *sqliteRepository) Lookup(d, code string, now time.Time) (lookup.RedirectStorage, error) {
 	var red lookup.RedirectStorage
 
 	row := s.db.QueryRow(fmt.Sprintf(`
 	SELECT
-		code, url, created_at
+		code, url, created_at, password, max_uses, uses, not_before, rules, variants, passthrough, preview, status_code
 	FROM '%s'
 	WHERE
-		code = ? AND active = ?
-	`, tableName), code, true)
+		domain = ? AND code = ? AND active = ? AND
+		(expires_at IS NULL OR julianday(expires_at) > julianday(?))
+	`, tableName), d, code, true, now.UTC().Format(time.RFC3339))
 
-	var createdAt string
-	if err := row.Scan(&red.Code, &red.URL, &createdAt); err != nil {
+	var (
+		createdAt string
+		notBefore sql.NullString
+	)
+	if err := row.Scan(&red.Code, &red.URL, &createdAt, &red.Password, &red.MaxUses, &red.Uses, &notBefore, &red.Rules, &red.Variants, &red.Passthrough, &red.Preview, &red.StatusCode); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return red, lookup.ErrNotFound
 		}
@@ -96,81 +206,543 @@ func (s *sqliteRepository) Lookup(code string) (lookup.RedirectStorage, error) {
 		return red, err
 	}
 
-	// Special handling for the timestamp
+	// Special handling for the timestamps
 	var err error
 	red.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
 	if err != nil {
 		return red, fmt.Errorf("repository.LookupFind parsing time: %w", err)
 	}
 
+	red.NotBefore, err = parseNullableTime(notBefore)
+	if err != nil {
+		return red, fmt.Errorf("repository.LookupFind parsing time: %w", err)
+	}
+
 	return red, nil
 }
 
-// Store is the implementation for repository.RedirectRepository#Store.
-func (s *sqliteRepository) Store(red adder.RedirectStorage) error {
-	if _, err := s.db.Exec(fmt.Sprintf(`
+// Use is the implementation for repository.RedirectRepository#Use.
+func (s *sqliteRepository) Use(d, code string, now time.Time) error {
+	// the remaining uses are checked and consumed by a single statement
+	result, err := s.db.Exec(fmt.Sprintf(`
+	UPDATE '%s'
+	SET
+		uses = uses + 1
+	WHERE
+		domain = ? AND code = ? AND active = ? AND
+		(expires_at IS NULL OR julianday(expires_at) > julianday(?)) AND
+		(max_uses = 0 OR uses < max_uses)
+	`, tableName), d, code, true, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// nothing is consumed, either the redirect is gone or exhausted
+	if _, err := s.Lookup(d, code, now); err != nil {
+		return err
+	}
+
+	return lookup.ErrExhausted
+}
+
+var insertStatement = fmt.Sprintf(`
 	INSERT INTO '%s'
-		(code, active, url, token, client_info, created_at)
+		(domain, code, active, url, token, client_info, created_at, expires_at, password, max_uses, not_before, rules, variants, passthrough, preview, status_code, owner)
 	VALUES
-		(?, ?, ?, ?, ?, ?)
-	`, tableName), red.Code, 1, red.URL, red.Token, red.ClientInfo, red.CreatedAt.Format(time.RFC3339)); err != nil {
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) {
-			if errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintPrimaryKey) {
-				return adder.ErrDuplicate
-			}
+		(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, tableName)
+
+// insertArgs returns the arguments of the insertStatement.
+func insertArgs(red adder.RedirectStorage) []any {
+	return []any{red.Domain, red.Code, 1, red.URL, red.Token, red.ClientInfo, red.CreatedAt.Format(time.RFC3339), nullableTime(red.ExpiresAt), red.Password, red.MaxUses, nullableTime(red.NotBefore), red.Rules, red.Variants, red.Passthrough, red.Preview, red.StatusCode, red.Owner}
+}
+
+// insertError maps the errors of the insertStatement.
+func insertError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		if errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintPrimaryKey) {
+			return adder.ErrDuplicate
 		}
-		return err
+	}
+
+	return err
+}
+
+// Store is the implementation for repository.RedirectRepository#Store.
+func (s *sqliteRepository) Store(red adder.RedirectStorage) error {
+	if _, err := s.db.Exec(insertStatement, insertArgs(red)...); err != nil {
+		return insertError(err)
 	}
 
 	return nil
 }
 
-func (r *sqliteRepository) Invalidate(code, token string) error {
-	result, err := r.db.Exec(fmt.Sprintf(`
+// StoreAll is the implementation for repository.RedirectRepository#StoreAll.
+func (s *sqliteRepository) StoreAll(reds []adder.RedirectStorage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	statement, err := tx.Prepare(insertStatement)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer statement.Close()
+
+	for i, red := range reds {
+		if _, err := statement.Exec(insertArgs(red)...); err != nil {
+			tx.Rollback()
+			return &adder.ItemError{Index: i, Err: insertError(err)}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LookupByURL is the implementation for repository.RedirectRepository#LookupByURL.
+func (r *sqliteRepository) LookupByURL(d, url string) (adder.RedirectStorage, error) {
+	var red adder.RedirectStorage
+
+	row := r.db.QueryRow(fmt.Sprintf(`
+	SELECT
+		domain, code, url, token, client_info, created_at, status_code, owner
+	FROM '%s'
+	WHERE
+		domain = ? AND url = ? AND active = ? AND expires_at IS NULL AND password = '' AND max_uses = 0 AND not_before IS NULL AND rules = '' AND variants = '' AND passthrough = 0 AND preview = 0
+	ORDER BY
+		created_at ASC
+	LIMIT 1
+	`, tableName), d, url, true)
+
+	var createdAt string
+	if err := row.Scan(&red.Domain, &red.Code, &red.URL, &red.Token, &red.ClientInfo, &createdAt, &red.StatusCode, &red.Owner); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return red, adder.ErrNotFound
+		}
+
+		return red, err
+	}
+
+	// Special handling for the timestamp
+	var err error
+	red.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return red, fmt.Errorf("repository.LookupByURL parsing time: %w", err)
+	}
+
+	return red, nil
+}
+
+// Update is the implementation for repository.RedirectRepository#Update.
+func (r *sqliteRepository) Update(d, code, token, url string, now time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ok, err := verifyToken(tx, token, `
+		domain = ? AND code = ? AND active = ? AND
+		(expires_at IS NULL OR julianday(expires_at) > julianday(?))
+	`, d, code, true, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return updater.ErrNotFound
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`
 	UPDATE '%s'
 	SET
-		active = ?
+		url = ?
 	WHERE
-		code = ? AND token = ?
-	`, tableName), 0, code, token)
+		domain = ? AND code = ?
+	`, tableName), url, d, code); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) Invalidate(d, code, token string, now time.Time) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	// an invalidated redirect keeps the point in time of its first invalidation
+	ok, err := verifyToken(tx, token, `domain = ? AND code = ? AND active = ?`, d, code, 1)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
+	if !ok {
 		return invalidator.ErrNotFound
 	}
 
-	return nil
+	if _, err := tx.Exec(fmt.Sprintf(`
+	UPDATE '%s'
+	SET
+		active = ?, invalidated_at = ?
+	WHERE
+		domain = ? AND code = ?
+	`, tableName), 0, now.UTC().Format(time.RFC3339), d, code); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-/*
-func (r *sqliteRepository) Delete(code, token string) error {
-	result, err := r.db.Exec(fmt.Sprintf(`
-	DELETE
-  FROM '%s'
+// Restore is the implementation for repository.RedirectRepository#Restore.
+func (r *sqliteRepository) Restore(d, code, token string, invalidatedSince time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		stored        string
+		invalidatedAt sql.NullString
+	)
+
+	err = tx.QueryRow(fmt.Sprintf(`
+	SELECT
+		token, invalidated_at
+	FROM '%s'
 	WHERE
-		code = ? AND token = ?
-	`, tableName), code, token)
+		domain = ? AND code = ? AND active = ?
+	`, tableName), d, code, 0).Scan(&stored, &invalidatedAt)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return restorer.ErrNotFound
+		}
+
 		return err
 	}
 
+	if !hashed.Verify(stored, token) {
+		return restorer.ErrNotFound
+	}
+
+	// the point in time of the invalidation is unknown for a redirect that
+	// was invalidated before it was recorded
+	if !invalidatedAt.Valid {
+		return restorer.ErrWindowClosed
+	}
+
+	t, err := time.Parse(time.RFC3339, invalidatedAt.String)
+	if err != nil {
+		return fmt.Errorf("repository.Restore parsing time: %w", err)
+	}
+
+	if t.Before(invalidatedSince.Truncate(time.Second)) {
+		return restorer.ErrWindowClosed
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`
+	UPDATE '%s'
+	SET
+		active = ?, invalidated_at = NULL
+	WHERE
+		domain = ? AND code = ?
+	`, tableName), 1, d, code); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Purge is the implementation for repository.RedirectRepository#Purge.
+func (r *sqliteRepository) Purge(before time.Time) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(fmt.Sprintf(`
+	DELETE
+	FROM '%s'
+	WHERE
+		(domain, code) IN (SELECT domain, code FROM '%s' WHERE active = ? AND julianday(invalidated_at) < julianday(?))
+	`, variantHitTableName, tableName), 0, before.UTC().Format(time.RFC3339)); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(fmt.Sprintf(`
+	DELETE
+	FROM '%s'
+	WHERE
+		active = ? AND julianday(invalidated_at) < julianday(?)
+	`, tableName), 0, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+
 	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), tx.Commit()
+}
+
+// NextSequence is the implementation for repository.RedirectRepository#NextSequence.
+func (r *sqliteRepository) NextSequence() (uint64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// the update acquires the write lock before the value is read
+	if _, err := tx.Exec(fmt.Sprintf(`
+	UPDATE '%s'
+	SET
+		value = value + 1
+	WHERE
+		name = ?
+	`, sequenceTableName), tableName); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var value uint64
+	if err := tx.QueryRow(fmt.Sprintf(`
+	SELECT
+		value
+	FROM '%s'
+	WHERE
+		name = ?
+	`, sequenceTableName), tableName).Scan(&value); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return value, tx.Commit()
+}
+
+func (r *sqliteRepository) IncrementHits(hits map[domain.Key]uint64) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return deleter.ErrNotFound
+	statement, err := tx.Prepare(fmt.Sprintf(`
+	UPDATE '%s'
+	SET
+		hits = hits + ?
+	WHERE
+		domain = ? AND code = ?
+	`, tableName))
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
+	defer statement.Close()
 
-	return err
+	for key, n := range hits {
+		if _, err := statement.Exec(n, key.Domain, key.Code); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// IncrementVariantHits is the implementation for repository.RedirectRepository#IncrementVariantHits.
+func (r *sqliteRepository) IncrementVariantHits(hits map[domain.Key]map[int]uint64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	statement, err := tx.Prepare(fmt.Sprintf(`
+	INSERT INTO '%s'
+		(domain, code, variant, hits)
+	VALUES
+		(?, ?, ?, ?)
+	ON CONFLICT (domain, code, variant) DO UPDATE SET
+		hits = hits + excluded.hits
+	`, variantHitTableName))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer statement.Close()
+
+	for key, variants := range hits {
+		for variant, n := range variants {
+			if _, err := statement.Exec(key.Domain, key.Code, variant, n); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) Top(d string, limit int, now time.Time) ([]ranker.RedirectStorage, error) {
+	rows, err := r.db.Query(fmt.Sprintf(`
+	SELECT
+		code, url, hits
+	FROM '%s'
+	WHERE
+		domain = ? AND active = ? AND password = '' AND
+		(expires_at IS NULL OR julianday(expires_at) > julianday(?))
+	ORDER BY
+		hits DESC, code ASC
+	LIMIT ?
+	`, tableName), d, true, now.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := make([]ranker.RedirectStorage, 0, limit)
+	for rows.Next() {
+		var red ranker.RedirectStorage
+		if err := rows.Scan(&red.Code, &red.URL, &red.Hits); err != nil {
+			return nil, err
+		}
+
+		top = append(top, red)
+	}
+
+	return top, rows.Err()
+}
+
+// Scheduled is the implementation for repository.RedirectRepository#Scheduled.
+func (r *sqliteRepository) Scheduled(d string, now time.Time) ([]scheduler.RedirectStorage, error) {
+	rows, err := r.db.Query(fmt.Sprintf(`
+	SELECT
+		code, url, created_at, not_before, expires_at
+	FROM '%s'
+	WHERE
+		domain = ? AND active = ? AND password = '' AND julianday(not_before) > julianday(?) AND
+		(expires_at IS NULL OR julianday(expires_at) > julianday(?))
+	ORDER BY
+		julianday(not_before) ASC, code ASC
+	`, tableName), d, true, now.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scheduled := make([]scheduler.RedirectStorage, 0)
+	for rows.Next() {
+		var (
+			red                  scheduler.RedirectStorage
+			createdAt            string
+			notBefore, expiresAt sql.NullString
+		)
+		if err := rows.Scan(&red.Code, &red.URL, &createdAt, &notBefore, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		// Special handling for the timestamps
+		if red.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, fmt.Errorf("repository.Scheduled parsing time: %w", err)
+		}
+
+		if red.NotBefore, err = parseNullableTime(notBefore); err != nil {
+			return nil, fmt.Errorf("repository.Scheduled parsing time: %w", err)
+		}
+
+		if red.ExpiresAt, err = parseNullableTime(expiresAt); err != nil {
+			return nil, fmt.Errorf("repository.Scheduled parsing time: %w", err)
+		}
+
+		scheduled = append(scheduled, red)
+	}
+
+	return scheduled, rows.Err()
+}
+
+// Variants is the implementation for repository.RedirectRepository#Variants.
+func (r *sqliteRepository) Variants(d, code string, now time.Time) ([]ranker.VariantStorage, error) {
+	var stored targeting.Variants
+
+	err := r.db.QueryRow(fmt.Sprintf(`
+	SELECT
+		variants
+	FROM '%s'
+	WHERE
+		domain = ? AND code = ? AND active = ? AND password = '' AND
+		(expires_at IS NULL OR julianday(expires_at) > julianday(?))
+	`, tableName), d, code, true, now.UTC().Format(time.RFC3339)).Scan(&stored)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ranker.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	variants := make([]ranker.VariantStorage, len(stored))
+	for i, v := range stored {
+		variants[i] = ranker.VariantStorage{
+			Variant: i + 1,
+			URL:     v.URL,
+			Weight:  v.Weight,
+		}
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+	SELECT
+		variant, hits
+	FROM '%s'
+	WHERE
+		domain = ? AND code = ?
+	`, variantHitTableName), d, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			variant int
+			hits    uint64
+		)
+		if err := rows.Scan(&variant, &hits); err != nil {
+			return nil, err
+		}
+
+		if variant >= 1 && variant <= len(variants) {
+			variants[variant-1].Hits = hits
+		}
+	}
+
+	return variants, rows.Err()
+}
+
+// Ping is the implementation for repository.RedirectRepository#Ping. It queries
+// the table of the redirects since sqlite opens missing database files lazily.
+func (r *sqliteRepository) Ping(ctx context.Context) error {
+	var one int
+
+	err := r.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT 1 FROM '%s' LIMIT 1`, tableName)).Scan(&one)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
 }
-*/
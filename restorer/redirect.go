@@ -0,0 +1,9 @@
+package restorer
+
+// RedirectQuery is the request query of the restorer service.
+type RedirectQuery struct {
+	// Domain is the namespace of the code, empty for the default domain.
+	Domain string
+	Code   string
+	Token  string
+}
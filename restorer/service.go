@@ -0,0 +1,69 @@
+// Package restorer offers a service to reactivate an invalidated redirect.
+package restorer
+
+import (
+	"errors"
+	"hex-microservice/event"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+var (
+	// ErrNotFound signals that no invalidated redirect with the token is found
+	ErrNotFound = errors.New("redirect not found")
+	// ErrWindowClosed signals that the redirect was invalidated too long ago
+	ErrWindowClosed = errors.New("restore window closed")
+)
+
+// DefaultWindow is the default period an invalidated redirect can be restored.
+const DefaultWindow = 24 * time.Hour
+
+// Repository defines the method the service expects from
+// a repository implementation.
+type Repository interface {
+	// Restore reactivates the invalidated redirect of the domain with the
+	// matching token. A redirect invalidated before the given point in time
+	// raises ErrWindowClosed.
+	Restore(domain, code, token string, invalidatedSince time.Time) error
+}
+
+// Service describes the method the service offers.
+type Service interface {
+	// Restore takes a token to reactivate an invalidated redirect.
+	// Raises an error if the entry couldn't be restored.
+	Restore(q RedirectQuery) error
+}
+
+// service implements the Service interface and holds
+// references.
+type service struct {
+	logger     logr.Logger
+	repository Repository
+	events     event.Publisher
+	window     time.Duration
+}
+
+// New creates a new restorer service, the window is the period after the
+// invalidation a redirect can be restored.
+func New(l logr.Logger, r Repository, p event.Publisher, window time.Duration) Service {
+	return &service{
+		logger:     l,
+		repository: r,
+		events:     p,
+		window:     window,
+	}
+}
+
+// Restore reactivates a redirect by the given token.
+func (s *service) Restore(q RedirectQuery) error {
+	now := time.Now()
+
+	if err := s.repository.Restore(q.Domain, q.Code, q.Token, now.Add(-s.window)); err != nil {
+		return err
+	}
+
+	s.events.Publish(event.Restored(q.Domain, q.Code, now))
+
+	return nil
+}
@@ -2,49 +2,106 @@ package chi
 
 import (
 	"hex-microservice/adder"
+	"hex-microservice/domain"
 	"hex-microservice/health"
+	mw "hex-microservice/http/middleware"
 	"hex-microservice/http/rest/stdlib"
 	"hex-microservice/http/url"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 	"net/http"
-	"time"
 
 	org "github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-logr/logr"
 )
 
+// catchAll is the route pattern of the rest of the path, chi names its parameter "*".
+const catchAll = "*"
+
 func param(name string) string {
 	return "{" + name + "}"
 }
 
+// paramFunc returns the parameter of the route, the rest of the path is
+// provided as stdlib.UrlParameterPath.
+func paramFunc(r *http.Request, key string) string {
+	if key == stdlib.UrlParameterPath {
+		key = catchAll
+	}
+
+	return org.URLParam(r, key)
+}
+
 // New returns a http.Handler that exposes the service with the chi router.
-func New(log logr.Logger, mappedURL string, mappedPath string, healthPath string, hs health.Service, servicePath string, as adder.Service, ls lookup.Service, is invalidator.Service) http.Handler {
+func New(log logr.Logger, mappedURL string, domains []domain.Domain, mappedPath string, healthPath string, hs health.Service, servicePath string, create mw.Middleware, visit mw.Middleware, admin mw.Middleware, as adder.Service, ls lookup.Service, us updater.Service, is invalidator.Service, rss restorer.Service, rs ranker.Service, ss scheduler.Service) http.Handler {
 	router := org.NewRouter()
 	router.NotFound(http.NotFound)
 	router.MethodNotAllowed(http.NotFound)
 
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	// no RealIP, it trusts the forwarded addresses of any client, see the
+	// ClientIP middleware
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.StripSlashes)
 
 	serviceMappedUrl := url.Join(mappedURL, mappedPath, servicePath)
-	handler := stdlib.New(log, hs, as, ls, is, org.URLParam)
+	handler := stdlib.New(log, domain.MappedURLs(domains, mappedPath, servicePath), hs, as, ls, us, is, rss, rs, ss, paramFunc)
 
+	// the health path is kept as an alias of the liveness
 	router.Get(url.AbsPath(mappedPath, healthPath),
-		handler.Health(time.Now()))
+		handler.HealthLive())
+
+	router.Get(url.AbsPath(mappedPath, healthPath, stdlib.UrlPathLive),
+		handler.HealthLive())
+
+	router.Get(url.AbsPath(mappedPath, healthPath, stdlib.UrlPathReady),
+		handler.HealthReady())
+
+	router.Get(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathTop),
+		handler.RedirectTop(serviceMappedUrl))
+
+	router.Get(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathStats),
+		admin.HandlerFunc(handler.RedirectStats(serviceMappedUrl)))
+
+	router.Get(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathScheduled),
+		admin.HandlerFunc(handler.RedirectScheduled(serviceMappedUrl)))
 
 	router.Get(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode)),
-		handler.RedirectGet(serviceMappedUrl))
+		visit.HandlerFunc(handler.RedirectGet(serviceMappedUrl)))
+
+	router.Get(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), stdlib.UrlPathVariants),
+		handler.RedirectVariants(serviceMappedUrl))
+
+	router.Get(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), stdlib.UrlPathQR),
+		visit.HandlerFunc(handler.RedirectQR(serviceMappedUrl)))
+
+	// the path after the code is passed through
+	router.Get(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), catchAll),
+		visit.HandlerFunc(handler.RedirectGet(serviceMappedUrl)))
 
 	router.Post(url.AbsPath(mappedPath, servicePath),
-		handler.RedirectPost(serviceMappedUrl))
+		create.HandlerFunc(handler.RedirectPost(serviceMappedUrl)))
+
+	router.Post(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathBatch),
+		create.HandlerFunc(handler.RedirectBatch(serviceMappedUrl)))
+
+	router.Post(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode)),
+		visit.HandlerFunc(handler.RedirectUnlock(serviceMappedUrl)))
+
+	router.Patch(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken)),
+		handler.RedirectPatch(serviceMappedUrl))
 
 	router.Delete(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken)),
 		handler.RedirectInvalidate(serviceMappedUrl))
 
+	router.Post(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken), stdlib.UrlPathRestore),
+		handler.RedirectRestore(serviceMappedUrl))
+
 	return router
 }
@@ -2,13 +2,18 @@ package gin
 
 import (
 	"hex-microservice/adder"
+	"hex-microservice/domain"
 	"hex-microservice/health"
+	"hex-microservice/http/middleware"
 	"hex-microservice/http/rest/ginimp"
 	"hex-microservice/http/url"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 	"net/http"
-	"time"
 
 	org "github.com/gin-gonic/gin"
 	"github.com/go-logr/logr"
@@ -18,27 +23,90 @@ func param(name string) string {
 	return ":" + name
 }
 
+func catchAll(name string) string {
+	return "*" + name
+}
+
+// reserved dispatches reserved path segments to dedicated handlers, because
+// gin does not support a catch-all and a static path segment on the same level.
+func reserved(name string, fallback org.HandlerFunc, handlers map[string]org.HandlerFunc) org.HandlerFunc {
+	return func(c *org.Context) {
+		if h, ok := handlers[c.Param(name)]; ok {
+			h(c)
+			return
+		}
+
+		fallback(c)
+	}
+}
+
+// wrap applies a router agnostic middleware to a gin handler, the request
+// passed on by the middleware is handed to the handler.
+func wrap(m middleware.Middleware, h org.HandlerFunc) org.HandlerFunc {
+	return func(c *org.Context) {
+		m(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			c.Request = r
+			h(c)
+		})).ServeHTTP(c.Writer, c.Request)
+	}
+}
+
 // newHttpRouter returns a http.Handler that adapts the service with the use of the httprouter router.
-func New(log logr.Logger, mappedURL string, mappedPath string, healthPath string, hs health.Service, servicePath string, as adder.Service, ls lookup.Service, is invalidator.Service) http.Handler {
+func New(log logr.Logger, mappedURL string, domains []domain.Domain, mappedPath string, healthPath string, hs health.Service, servicePath string, create middleware.Middleware, visit middleware.Middleware, admin middleware.Middleware, as adder.Service, ls lookup.Service, us updater.Service, is invalidator.Service, rss restorer.Service, rs ranker.Service, ss scheduler.Service) http.Handler {
 	router := org.Default()
 	router.HandleMethodNotAllowed = false
 	router.Use(org.Logger())
 	router.Use(org.Recovery())
 
 	serviceMappedUrl := url.Join(mappedURL, mappedPath, servicePath)
-	handler := ginimp.New(log, hs, as, ls, is)
+	handler := ginimp.New(log, domain.MappedURLs(domains, mappedPath, servicePath), hs, as, ls, us, is, rss, rs, ss)
 
+	// the health path is kept as an alias of the liveness
 	router.GET(url.AbsPath(mappedPath, healthPath),
-		handler.Health(time.Now()))
+		handler.HealthLive())
+
+	router.GET(url.AbsPath(mappedPath, healthPath, ginimp.UrlPathLive),
+		handler.HealthLive())
+
+	router.GET(url.AbsPath(mappedPath, healthPath, ginimp.UrlPathReady),
+		handler.HealthReady())
+
+	router.GET(url.AbsPath(mappedPath, servicePath, ginimp.UrlPathTop),
+		handler.RedirectTop(serviceMappedUrl))
+
+	router.GET(url.AbsPath(mappedPath, servicePath, ginimp.UrlPathStats),
+		wrap(admin, handler.RedirectStats(serviceMappedUrl)))
+
+	router.GET(url.AbsPath(mappedPath, servicePath, ginimp.UrlPathScheduled),
+		wrap(admin, handler.RedirectScheduled(serviceMappedUrl)))
 
 	router.GET(url.AbsPath(mappedPath, servicePath, param(ginimp.UrlParameterCode)),
-		handler.RedirectGet(serviceMappedUrl))
+		wrap(visit, handler.RedirectGet(serviceMappedUrl)))
+
+	// the path after the code is passed through, except for the reserved path segments
+	router.GET(url.AbsPath(mappedPath, servicePath, param(ginimp.UrlParameterCode), catchAll(ginimp.UrlParameterPath)),
+		reserved(ginimp.UrlParameterPath, wrap(visit, handler.RedirectGet(serviceMappedUrl)), map[string]org.HandlerFunc{
+			"/" + ginimp.UrlPathVariants: handler.RedirectVariants(serviceMappedUrl),
+			"/" + ginimp.UrlPathQR:       wrap(visit, handler.RedirectQR(serviceMappedUrl)),
+		}))
 
 	router.POST(url.AbsPath(mappedPath, servicePath),
-		handler.RedirectPost(serviceMappedUrl))
+		wrap(create, handler.RedirectPost(serviceMappedUrl)))
+
+	router.POST(url.AbsPath(mappedPath, servicePath, ginimp.UrlPathBatch),
+		wrap(create, handler.RedirectBatch(serviceMappedUrl)))
+
+	router.POST(url.AbsPath(mappedPath, servicePath, param(ginimp.UrlParameterCode)),
+		wrap(visit, handler.RedirectUnlock(serviceMappedUrl)))
+
+	router.PATCH(url.AbsPath(mappedPath, servicePath, param(ginimp.UrlParameterCode), param(ginimp.UrlParameterToken)),
+		handler.RedirectPatch(serviceMappedUrl))
 
 	router.DELETE(url.AbsPath(mappedPath, servicePath, param(ginimp.UrlParameterCode), param(ginimp.UrlParameterToken)),
 		handler.RedirectInvalidate(serviceMappedUrl))
 
+	router.POST(url.AbsPath(mappedPath, servicePath, param(ginimp.UrlParameterCode), param(ginimp.UrlParameterToken), ginimp.UrlPathRestore),
+		handler.RedirectRestore(serviceMappedUrl))
+
 	return router
 }
@@ -2,13 +2,18 @@ package gorillamux
 
 import (
 	"hex-microservice/adder"
+	"hex-microservice/domain"
 	"hex-microservice/health"
+	mw "hex-microservice/http/middleware"
 	"hex-microservice/http/rest/stdlib"
 	"hex-microservice/http/url"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-logr/logr"
@@ -23,36 +28,92 @@ func param(name string) string {
 	return "{" + name + "}"
 }
 
-func New(log logr.Logger, mappedURL string, mappedPath string, healthPath string, hs health.Service, servicePath string, as adder.Service, ls lookup.Service, is invalidator.Service) http.Handler {
+func catchAll(name string) string {
+	return "{" + name + ":.+}"
+}
+
+func New(log logr.Logger, mappedURL string, domains []domain.Domain, mappedPath string, healthPath string, hs health.Service, servicePath string, create mw.Middleware, visit mw.Middleware, admin mw.Middleware, as adder.Service, ls lookup.Service, us updater.Service, is invalidator.Service, rss restorer.Service, rs ranker.Service, ss scheduler.Service) http.Handler {
 	router := org.NewRouter()
 	router.StrictSlash(true)
 	router.NotFoundHandler = http.NotFoundHandler()
 	router.MethodNotAllowedHandler = http.NotFoundHandler()
 
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	// no RealIP, it trusts the forwarded addresses of any client, see the
+	// ClientIP middleware
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.StripSlashes)
 
 	serviceMappedUrl := url.Join(mappedURL, mappedPath, servicePath)
-	handler := stdlib.New(log, hs, as, ls, is, paramFunc)
+	handler := stdlib.New(log, domain.MappedURLs(domains, mappedPath, servicePath), hs, as, ls, us, is, rss, rs, ss, paramFunc)
 
+	// the health path is kept as an alias of the liveness
 	router.HandleFunc(url.AbsPath(mappedPath, healthPath),
-		handler.Health(time.Now())).
+		handler.HealthLive()).
+		Methods(http.MethodGet)
+
+	router.HandleFunc(url.AbsPath(mappedPath, healthPath, stdlib.UrlPathLive),
+		handler.HealthLive()).
+		Methods(http.MethodGet)
+
+	router.HandleFunc(url.AbsPath(mappedPath, healthPath, stdlib.UrlPathReady),
+		handler.HealthReady()).
+		Methods(http.MethodGet)
+
+	// NOTE: static routes must be registered before the routes with parameters
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathTop),
+		handler.RedirectTop(serviceMappedUrl)).
+		Methods(http.MethodGet)
+
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathStats),
+		admin.HandlerFunc(handler.RedirectStats(serviceMappedUrl))).
 		Methods(http.MethodGet)
 
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathScheduled),
+		admin.HandlerFunc(handler.RedirectScheduled(serviceMappedUrl))).
+		Methods(http.MethodGet)
+
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, stdlib.UrlPathBatch),
+		create.HandlerFunc(handler.RedirectBatch(serviceMappedUrl))).
+		Methods(http.MethodPost)
+
 	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode)),
-		handler.RedirectGet(serviceMappedUrl)).
+		visit.HandlerFunc(handler.RedirectGet(serviceMappedUrl))).
+		Methods(http.MethodGet)
+
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode)),
+		visit.HandlerFunc(handler.RedirectUnlock(serviceMappedUrl))).
+		Methods(http.MethodPost)
+
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), stdlib.UrlPathVariants),
+		handler.RedirectVariants(serviceMappedUrl)).
+		Methods(http.MethodGet)
+
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), stdlib.UrlPathQR),
+		visit.HandlerFunc(handler.RedirectQR(serviceMappedUrl))).
+		Methods(http.MethodGet)
+
+	// the path after the code is passed through
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), catchAll(stdlib.UrlParameterPath)),
+		visit.HandlerFunc(handler.RedirectGet(serviceMappedUrl))).
 		Methods(http.MethodGet)
 
 	router.HandleFunc(url.AbsPath(mappedPath, servicePath),
-		handler.RedirectPost(serviceMappedUrl)).
+		create.HandlerFunc(handler.RedirectPost(serviceMappedUrl))).
 		Methods(http.MethodPost)
 
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken)),
+		handler.RedirectPatch(serviceMappedUrl)).
+		Methods(http.MethodPatch)
+
 	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken)),
 		handler.RedirectInvalidate(serviceMappedUrl)).
 		Methods(http.MethodDelete)
 
+	router.HandleFunc(url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken), stdlib.UrlPathRestore),
+		handler.RedirectRestore(serviceMappedUrl)).
+		Methods(http.MethodPost)
+
 	return router
 }
@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"hex-microservice/adder"
+	"hex-microservice/domain"
 	"hex-microservice/health"
+	"hex-microservice/http/middleware"
 	"hex-microservice/http/rest/stdlib"
 	"hex-microservice/http/url"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -26,7 +31,16 @@ const (
 const varsKey = "UrlParameter"
 
 func match(r *http.Request, path string, vars ...string) *http.Request {
-	matches := strings.Split(path, "/")
+	return withVars(r, strings.Split(path, "/"), vars...)
+}
+
+// matchRest is like match, but the last variable takes the rest of the path
+// including its slashes.
+func matchRest(r *http.Request, path string, vars ...string) *http.Request {
+	return withVars(r, strings.SplitN(path, "/", len(vars)), vars...)
+}
+
+func withVars(r *http.Request, matches []string, vars ...string) *http.Request {
 	lenMatches := len(matches)
 	lenVars := len(vars)
 
@@ -95,22 +109,43 @@ type goRouter struct {
 
 	serviceMappedUrl string
 
-	healthPath  string
-	servicePath string
+	healthPath    string
+	livePath      string
+	readyPath     string
+	servicePath   string
+	topPath       string
+	statsPath     string
+	scheduledPath string
+	batchPath     string
 
 	handler stdlib.Handler
+	// create decorates the handlers that create redirects
+	create middleware.Middleware
+	// visit decorates the handlers that redirect
+	visit middleware.Middleware
+	// admin decorates the handlers of the listings
+	admin middleware.Middleware
 }
 
 // New creates a new router inspired by: https://benhoyt.com/writings/web-service-stdlib/.
-func New(log logr.Logger, mappedURL string, mappedPath string, healthPath string, hs health.Service, servicePath string, as adder.Service, ls lookup.Service, is invalidator.Service) http.Handler {
+func New(log logr.Logger, mappedURL string, domains []domain.Domain, mappedPath string, healthPath string, hs health.Service, servicePath string, create middleware.Middleware, visit middleware.Middleware, admin middleware.Middleware, as adder.Service, ls lookup.Service, us updater.Service, is invalidator.Service, rss restorer.Service, rs ranker.Service, ss scheduler.Service) http.Handler {
 	return &goRouter{
 		log:              log,
 		serviceMappedUrl: url.Join(mappedURL, mappedPath, servicePath),
 
-		healthPath:  url.AbsPath(mappedPath, healthPath),
-		servicePath: url.AbsPath(mappedPath, servicePath),
-
-		handler: stdlib.New(log, hs, as, ls, is, paramFunc),
+		healthPath:    url.AbsPath(mappedPath, healthPath),
+		livePath:      url.AbsPath(mappedPath, healthPath, stdlib.UrlPathLive),
+		readyPath:     url.AbsPath(mappedPath, healthPath, stdlib.UrlPathReady),
+		servicePath:   url.AbsPath(mappedPath, servicePath),
+		topPath:       url.AbsPath(mappedPath, servicePath, stdlib.UrlPathTop),
+		statsPath:     url.AbsPath(mappedPath, servicePath, stdlib.UrlPathStats),
+		scheduledPath: url.AbsPath(mappedPath, servicePath, stdlib.UrlPathScheduled),
+		batchPath:     url.AbsPath(mappedPath, servicePath, stdlib.UrlPathBatch),
+
+		handler: stdlib.New(log, domain.MappedURLs(domains, mappedPath, servicePath), hs, as, ls, us, is, rss, rs, ss, paramFunc),
+		create:  create,
+		visit:   visit,
+		admin:   admin,
 	}
 }
 
@@ -119,11 +154,21 @@ func (gr *goRouter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	gr.log.Info("router", "method", r.Method, "path", path)
 
-	// e.g. "/health"
-	if path == gr.healthPath {
+	// e.g. "/health" or "/health/live", the health path is kept as an alias
+	// of the liveness
+	if path == gr.healthPath || path == gr.livePath {
+		switch r.Method {
+		case http.MethodGet:
+			gr.handler.HealthLive()(rw, r)
+			return
+		}
+	}
+
+	// e.g. "/health/ready"
+	if path == gr.readyPath {
 		switch r.Method {
 		case http.MethodGet:
-			gr.handler.Health(time.Now())(rw, r)
+			gr.handler.HealthReady()(rw, r)
 			return
 		}
 	}
@@ -133,7 +178,43 @@ func (gr *goRouter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		if path == gr.servicePath {
 			switch r.Method {
 			case http.MethodPost:
-				gr.handler.RedirectPost(gr.serviceMappedUrl)(rw, r)
+				gr.create.HandlerFunc(gr.handler.RedirectPost(gr.serviceMappedUrl))(rw, r)
+				return
+			}
+		}
+
+		// e.g "/service/_top"
+		if path == gr.topPath {
+			switch r.Method {
+			case http.MethodGet:
+				gr.handler.RedirectTop(gr.serviceMappedUrl)(rw, r)
+				return
+			}
+		}
+
+		// e.g "/service/_stats"
+		if path == gr.statsPath {
+			switch r.Method {
+			case http.MethodGet:
+				gr.admin.HandlerFunc(gr.handler.RedirectStats(gr.serviceMappedUrl))(rw, r)
+				return
+			}
+		}
+
+		// e.g "/service/_scheduled"
+		if path == gr.scheduledPath {
+			switch r.Method {
+			case http.MethodGet:
+				gr.admin.HandlerFunc(gr.handler.RedirectScheduled(gr.serviceMappedUrl))(rw, r)
+				return
+			}
+		}
+
+		// e.g "/service/_batch"
+		if path == gr.batchPath {
+			switch r.Method {
+			case http.MethodPost:
+				gr.create.HandlerFunc(gr.handler.RedirectBatch(gr.serviceMappedUrl))(rw, r)
 				return
 			}
 		}
@@ -141,18 +222,66 @@ func (gr *goRouter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		if r := match(r, withoutPrefix(path, gr.servicePath+"/"), stdlib.UrlParameterCode); r != nil {
 			switch r.Method {
 			case http.MethodGet:
-				gr.handler.RedirectGet(gr.serviceMappedUrl)(rw, r)
+				gr.visit.HandlerFunc(gr.handler.RedirectGet(gr.serviceMappedUrl))(rw, r)
+				return
+			case http.MethodPost:
+				gr.visit.HandlerFunc(gr.handler.RedirectUnlock(gr.serviceMappedUrl))(rw, r)
 				return
 			}
 		}
 
 		if r := match(r, withoutPrefix(path, gr.servicePath+"/"), stdlib.UrlParameterCode, stdlib.UrlParameterToken); r != nil {
 			switch r.Method {
+			case http.MethodPatch:
+				gr.handler.RedirectPatch(gr.serviceMappedUrl)(rw, r)
+				return
 			case http.MethodDelete:
 				gr.handler.RedirectInvalidate(gr.serviceMappedUrl)(rw, r)
 				return
 			}
 		}
+
+		// e.g "/service/{code}/variants"
+		if variantsPath := strings.TrimSuffix(path, "/"+stdlib.UrlPathVariants); variantsPath != path {
+			if r := match(r, withoutPrefix(variantsPath, gr.servicePath+"/"), stdlib.UrlParameterCode); r != nil {
+				switch r.Method {
+				case http.MethodGet:
+					gr.handler.RedirectVariants(gr.serviceMappedUrl)(rw, r)
+					return
+				}
+			}
+		}
+
+		// e.g "/service/{code}/qr"
+		if qrPath := strings.TrimSuffix(path, "/"+stdlib.UrlPathQR); qrPath != path {
+			if r := match(r, withoutPrefix(qrPath, gr.servicePath+"/"), stdlib.UrlParameterCode); r != nil {
+				switch r.Method {
+				case http.MethodGet:
+					gr.visit.HandlerFunc(gr.handler.RedirectQR(gr.serviceMappedUrl))(rw, r)
+					return
+				}
+			}
+		}
+
+		// e.g "/service/{code}/{token}/restore"
+		if restorePath := strings.TrimSuffix(path, "/"+stdlib.UrlPathRestore); restorePath != path {
+			if r := match(r, withoutPrefix(restorePath, gr.servicePath+"/"), stdlib.UrlParameterCode, stdlib.UrlParameterToken); r != nil {
+				switch r.Method {
+				case http.MethodPost:
+					gr.handler.RedirectRestore(gr.serviceMappedUrl)(rw, r)
+					return
+				}
+			}
+		}
+
+		// e.g "/service/{code}/extra/path", the path after the code is passed through
+		if r := matchRest(r, withoutPrefix(path, gr.servicePath+"/"), stdlib.UrlParameterCode, stdlib.UrlParameterPath); r != nil {
+			switch r.Method {
+			case http.MethodGet:
+				gr.visit.HandlerFunc(gr.handler.RedirectGet(gr.serviceMappedUrl))(rw, r)
+				return
+			}
+		}
 	}
 
 	jsonError(rw, http.StatusNotFound, ErrorNotFound, nil)
@@ -89,3 +89,13 @@ func TestNoMatchRoutes(t *testing.T) {
 func TestNoMatch(t *testing.T) {
 	assert.Equal(t, defaultValueNotDefined, paramFunc(&http.Request{}, "foo"))
 }
+
+func TestMatchRest(t *testing.T) {
+	r := matchRest(&http.Request{}, "foo/bar/baz", "id", "rest")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "foo", paramFunc(r, "id"))
+		assert.Equal(t, "bar/baz", paramFunc(r, "rest"))
+	}
+
+	assert.Nil(t, matchRest(&http.Request{}, "foo", "id", "rest"))
+}
@@ -2,13 +2,18 @@ package httprouter
 
 import (
 	"hex-microservice/adder"
+	"hex-microservice/domain"
 	"hex-microservice/health"
+	"hex-microservice/http/middleware"
 	"hex-microservice/http/rest/stdlib"
 	"hex-microservice/http/url"
 	"hex-microservice/invalidator"
 	"hex-microservice/lookup"
+	"hex-microservice/ranker"
+	"hex-microservice/restorer"
+	"hex-microservice/scheduler"
+	"hex-microservice/updater"
 	"net/http"
-	"time"
 
 	"github.com/go-logr/logr"
 	org "github.com/julienschmidt/httprouter"
@@ -22,25 +27,72 @@ func param(name string) string {
 	return ":" + name
 }
 
+func catchAll(name string) string {
+	return "*" + name
+}
+
+// reserved dispatches reserved path segments to dedicated handlers. The value
+// of the parameter is used as the path segment, because httprouter does not
+// support static and parameterized path segments on the same level.
+func reserved(name string, fallback http.Handler, handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := handlers[paramFunc(r, name)]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		fallback.ServeHTTP(w, r)
+	})
+}
+
 // newHttpRouter returns a http.Handler that adapts the service with the use of the httprouter router.
-func New(log logr.Logger, mappedURL string, mappedPath string, healthPath string, hs health.Service, servicePath string, as adder.Service, ls lookup.Service, is invalidator.Service) http.Handler {
+func New(log logr.Logger, mappedURL string, domains []domain.Domain, mappedPath string, healthPath string, hs health.Service, servicePath string, create middleware.Middleware, visit middleware.Middleware, admin middleware.Middleware, as adder.Service, ls lookup.Service, us updater.Service, is invalidator.Service, rss restorer.Service, rs ranker.Service, ss scheduler.Service) http.Handler {
 	router := org.New()
 	router.HandleMethodNotAllowed = false
 
 	serviceMappedUrl := url.Join(mappedURL, mappedPath, servicePath)
-	handler := stdlib.New(log, hs, as, ls, is, paramFunc)
+	handler := stdlib.New(log, domain.MappedURLs(domains, mappedPath, servicePath), hs, as, ls, us, is, rss, rs, ss, paramFunc)
 
+	// the health path is kept as an alias of the liveness
 	router.Handler(http.MethodGet, url.AbsPath(mappedPath, healthPath),
-		handler.Health(time.Now()))
+		handler.HealthLive())
+
+	router.Handler(http.MethodGet, url.AbsPath(mappedPath, healthPath, stdlib.UrlPathLive),
+		handler.HealthLive())
+
+	router.Handler(http.MethodGet, url.AbsPath(mappedPath, healthPath, stdlib.UrlPathReady),
+		handler.HealthReady())
 
 	router.Handler(http.MethodGet, url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode)),
-		handler.RedirectGet(serviceMappedUrl))
+		reserved(stdlib.UrlParameterCode, visit(handler.RedirectGet(serviceMappedUrl)), map[string]http.Handler{
+			stdlib.UrlPathTop:       handler.RedirectTop(serviceMappedUrl),
+			stdlib.UrlPathStats:     admin(handler.RedirectStats(serviceMappedUrl)),
+			stdlib.UrlPathScheduled: admin(handler.RedirectScheduled(serviceMappedUrl)),
+		}))
+
+	// the path after the code is passed through, except for the reserved path segments
+	router.Handler(http.MethodGet, url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), catchAll(stdlib.UrlParameterPath)),
+		reserved(stdlib.UrlParameterPath, visit(handler.RedirectGet(serviceMappedUrl)), map[string]http.Handler{
+			"/" + stdlib.UrlPathVariants: handler.RedirectVariants(serviceMappedUrl),
+			"/" + stdlib.UrlPathQR:       visit(handler.RedirectQR(serviceMappedUrl)),
+		}))
 
 	router.Handler(http.MethodPost, url.AbsPath(mappedPath, servicePath),
-		handler.RedirectPost(serviceMappedUrl))
+		create(handler.RedirectPost(serviceMappedUrl)))
+
+	router.Handler(http.MethodPost, url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode)),
+		reserved(stdlib.UrlParameterCode, visit(handler.RedirectUnlock(serviceMappedUrl)), map[string]http.Handler{
+			stdlib.UrlPathBatch: create(handler.RedirectBatch(serviceMappedUrl)),
+		}))
+
+	router.Handler(http.MethodPatch, url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken)),
+		handler.RedirectPatch(serviceMappedUrl))
 
 	router.Handler(http.MethodDelete, url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken)),
 		handler.RedirectInvalidate(serviceMappedUrl))
 
+	router.Handler(http.MethodPost, url.AbsPath(mappedPath, servicePath, param(stdlib.UrlParameterCode), param(stdlib.UrlParameterToken), stdlib.UrlPathRestore),
+		handler.RedirectRestore(serviceMappedUrl))
+
 	return router
 }
@@ -0,0 +1,22 @@
+package scheduler
+
+import "time"
+
+// RedirectStorage is the storage view for the scheduler service.
+type RedirectStorage struct {
+	Code      string
+	URL       string
+	CreatedAt time.Time
+	NotBefore time.Time
+	// ExpiresAt is the zero time if the redirect never expires.
+	ExpiresAt time.Time
+}
+
+// RedirectResult is the result of the scheduler service.
+type RedirectResult struct {
+	Code      string
+	URL       string
+	CreatedAt time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+}
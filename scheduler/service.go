@@ -0,0 +1,54 @@
+// Package scheduler offers a service to list the scheduled redirects, that
+// don't resolve before their activation.
+package scheduler
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Repository defines the method the service expects from
+// a repository implementation.
+type Repository interface {
+	// Scheduled returns the active redirects of the domain that aren't
+	// activated at the given point in time, ordered by their activation.
+	Scheduled(domain string, now time.Time) ([]RedirectStorage, error)
+}
+
+// Service describes the method the service offers.
+type Service interface {
+	// Scheduled returns the redirects of the domain that are not yet
+	// activated.
+	Scheduled(domain string) ([]RedirectResult, error)
+}
+
+// service implements the Service interface and holds
+// references.
+type service struct {
+	logger     logr.Logger
+	repository Repository
+}
+
+// New creates a new scheduler service.
+func New(l logr.Logger, r Repository) Service {
+	return &service{
+		logger:     l,
+		repository: r,
+	}
+}
+
+// Scheduled returns the redirects that are not yet activated.
+func (s *service) Scheduled(domain string) ([]RedirectResult, error) {
+	stored, err := s.repository.Scheduled(domain, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RedirectResult, len(stored))
+	for i, r := range stored {
+		results[i] = fromRedirectStorageToRedirectResult(r)
+	}
+
+	return results, nil
+}
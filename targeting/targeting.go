@@ -0,0 +1,362 @@
+// Package targeting offers the conditional destinations of a redirect. The
+// rules of a redirect are evaluated in their order against the attributes of
+// the request, the first matching rule determines the destination. The
+// variants of an experiment split the visitors by weight.
+package targeting
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrRuleInvalid signals that a rule or a variant is not valid.
+var ErrRuleInvalid = errors.New("rule invalid")
+
+// limits of the weights of the variants, they keep the total weight in the
+// range of an int
+const (
+	MaxWeight      = 10000
+	MaxTotalWeight = 100000
+)
+
+// device classes derived from the user agent
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// Request holds the attributes of a request the rules match on.
+type Request struct {
+	AcceptLanguage string
+	UserAgent      string
+	Referer        string
+	Query          url.Values
+}
+
+// Rule is a conditional destination. All given conditions have to match, a
+// rule without any condition is not valid.
+type Rule struct {
+	// Language matches the preferred language of the Accept-Language header,
+	// e.g. "de" matches "de-AT" and "de".
+	Language string `json:"language,omitempty" msgpack:"language,omitempty"`
+	// Device matches the device class of the User-Agent header.
+	Device string `json:"device,omitempty" msgpack:"device,omitempty"`
+	// Referer matches the host of the Referer header, either exactly or as
+	// wildcard like "*.example.com" that matches every subdomain.
+	Referer string `json:"referer,omitempty" msgpack:"referer,omitempty"`
+	// Query matches query parameters with the given values.
+	Query map[string]string `json:"query,omitempty" msgpack:"query,omitempty"`
+	// URL is the destination of the matching requests.
+	URL string `json:"url" msgpack:"url"`
+}
+
+// Rules are the ordered rules of a redirect, the url of the redirect is the
+// fallback if no rule matches. Rules are stored as JSON.
+type Rules []Rule
+
+// Validate checks that every rule has a destination and at least one
+// known condition.
+func (rs Rules) Validate() error {
+	for i, r := range rs {
+		if u, err := url.ParseRequestURI(r.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("targeting rule %d without valid url: %w", i, ErrRuleInvalid)
+		}
+
+		if r.Language == "" && r.Device == "" && r.Referer == "" && len(r.Query) == 0 {
+			return fmt.Errorf("targeting rule %d without condition: %w", i, ErrRuleInvalid)
+		}
+
+		switch r.Device {
+		case "", DeviceMobile, DeviceTablet, DeviceDesktop, DeviceBot:
+		default:
+			return fmt.Errorf("targeting rule %d unknown device %q: %w", i, r.Device, ErrRuleInvalid)
+		}
+	}
+
+	return nil
+}
+
+// Destination returns the url of the first rule that matches the request.
+func (rs Rules) Destination(req Request) (string, bool) {
+	if len(rs) == 0 {
+		return "", false
+	}
+
+	// the attributes are derived once for all rules
+	language := PreferredLanguage(req.AcceptLanguage)
+	device := DeviceClass(req.UserAgent)
+	referer := refererHost(req.Referer)
+
+	for _, r := range rs {
+		if r.Language != "" && !matchesLanguage(r.Language, language) {
+			continue
+		}
+
+		if r.Device != "" && r.Device != device {
+			continue
+		}
+
+		if r.Referer != "" && !matchesHost(strings.ToLower(r.Referer), referer) {
+			continue
+		}
+
+		if !matchesQuery(r.Query, req.Query) {
+			continue
+		}
+
+		return r.URL, true
+	}
+
+	return "", false
+}
+
+// Value implements driver.Valuer, no rules are stored as empty string.
+func (rs Rules) Value() (driver.Value, error) {
+	if len(rs) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (rs *Rules) Scan(src any) error {
+	b, err := scanned(src)
+	if err != nil {
+		return fmt.Errorf("targeting.Rules %w", err)
+	}
+
+	if len(b) == 0 {
+		*rs = nil
+		return nil
+	}
+
+	return json.Unmarshal(b, rs)
+}
+
+// PreferredLanguage returns the lowercased language of the Accept-Language
+// header with the highest quality, empty if there is none.
+func PreferredLanguage(header string) string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			var err error
+			if quality, err = strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err != nil {
+				continue
+			}
+		}
+
+		if quality > 0 {
+			languages = append(languages, weighted{tag: strings.ToLower(tag), quality: quality})
+		}
+	}
+
+	if len(languages) == 0 {
+		return ""
+	}
+
+	// the order of the header breaks the ties
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	return languages[0].tag
+}
+
+// DeviceClass returns the device class of the User-Agent header. Unknown user
+// agents are desktops.
+func DeviceClass(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case containsAny(ua, "bot", "crawler", "spider", "slurp"):
+		return DeviceBot
+	case containsAny(ua, "ipad", "tablet") || (strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return DeviceTablet
+	case containsAny(ua, "mobi", "iphone", "ipod", "android", "windows phone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+// matchesLanguage reports whether the language is the tag or a subtag of it.
+func matchesLanguage(tag, language string) bool {
+	tag = strings.ToLower(tag)
+
+	return language == tag || strings.HasPrefix(language, tag+"-")
+}
+
+// refererHost returns the lowercased host of the referer without port.
+func refererHost(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// matchesHost reports whether the host matches the pattern, a wildcard only
+// matches subdomains.
+func matchesHost(pattern, host string) bool {
+	if host == "" {
+		return false
+	}
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+
+	return host == pattern
+}
+
+// matchesQuery reports whether every expected parameter has the value.
+func matchesQuery(expected map[string]string, query url.Values) bool {
+	for key, value := range expected {
+		if query.Get(key) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Variant is a weighted destination of an experiment, the visitors are
+// distributed across the variants by their weights.
+type Variant struct {
+	URL    string `json:"url" msgpack:"url"`
+	Weight int    `json:"weight" msgpack:"weight"`
+}
+
+// Variants are the destinations of an experiment, the variants are numbered
+// by their position starting with 1. Variants are stored as JSON.
+type Variants []Variant
+
+// Validate checks that every variant has a destination and a positive weight
+// of at most MaxWeight, the weights sum up to at most MaxTotalWeight.
+func (vs Variants) Validate() error {
+	total := 0
+	for i, v := range vs {
+		if u, err := url.ParseRequestURI(v.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("targeting variant %d without valid url: %w", i+1, ErrRuleInvalid)
+		}
+
+		if v.Weight < 1 {
+			return fmt.Errorf("targeting variant %d without positive weight: %w", i+1, ErrRuleInvalid)
+		}
+
+		if v.Weight > MaxWeight {
+			return fmt.Errorf("targeting variant %d weight above %d: %w", i+1, MaxWeight, ErrRuleInvalid)
+		}
+
+		total += v.Weight
+		if total > MaxTotalWeight {
+			return fmt.Errorf("targeting variants total weight above %d: %w", MaxTotalWeight, ErrRuleInvalid)
+		}
+	}
+
+	return nil
+}
+
+// Pick returns the number of the variant the value in the range of the total
+// weight falls into, e.g. the weights 70 and 30 map 0-69 to 1 and 70-99 to 2.
+func (vs Variants) Pick(n int) int {
+	for i, v := range vs {
+		if n < v.Weight {
+			return i + 1
+		}
+
+		n -= v.Weight
+	}
+
+	return len(vs)
+}
+
+// TotalWeight returns the sum of the weights.
+func (vs Variants) TotalWeight() int {
+	total := 0
+	for _, v := range vs {
+		total += v.Weight
+	}
+
+	return total
+}
+
+// Value implements driver.Valuer, no variants are stored as empty string.
+func (vs Variants) Value() (driver.Value, error) {
+	if len(vs) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(vs)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (vs *Variants) Scan(src any) error {
+	b, err := scanned(src)
+	if err != nil {
+		return fmt.Errorf("targeting.Variants %w", err)
+	}
+
+	if len(b) == 0 {
+		*vs = nil
+		return nil
+	}
+
+	return json.Unmarshal(b, vs)
+}
+
+// scanned returns the bytes of a scanned text column.
+func scanned(src any) ([]byte, error) {
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("scan of %T", src)
+	}
+}
@@ -0,0 +1,152 @@
+package targeting
+
+import (
+	"math"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	userAgentIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	userAgentIPad    = "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	userAgentAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	userAgentTablet  = "Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	userAgentDesktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	userAgentBot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func TestDeviceClass(t *testing.T) {
+	for userAgent, device := range map[string]string{
+		userAgentIPhone:  DeviceMobile,
+		userAgentIPad:    DeviceTablet,
+		userAgentAndroid: DeviceMobile,
+		userAgentTablet:  DeviceTablet,
+		userAgentDesktop: DeviceDesktop,
+		userAgentBot:     DeviceBot,
+		"":               DeviceDesktop,
+	} {
+		assert.Equal(t, device, DeviceClass(userAgent), userAgent)
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	for header, language := range map[string]string{
+		"":                               "",
+		"de-AT":                          "de-at",
+		"en-US,en;q=0.9,de;q=0.8":        "en-us",
+		"en;q=0.5, de;q=0.8":             "de",
+		"*, fr":                          "fr",
+		"de;q=0, it":                     "it",
+		"nl;q=0.7, sv;q=0.7":             "nl",
+		"es;q=invalid, pt-BR;q=0.1":      "pt-br",
+		"  ja ; q=1.0 ,  ko ; q=0.9  ":   "ja",
+		"zh-Hant-TW,zh;q=0.9,en;q=0.8,*": "zh-hant-tw",
+	} {
+		assert.Equal(t, language, PreferredLanguage(header), header)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	rules := Rules{
+		{Device: DeviceMobile, URL: "https://apps.example/"},
+		{Language: "de", URL: "https://example.com/de"},
+		{Referer: "*.partner.example", URL: "https://example.com/partner"},
+		{Query: map[string]string{"campaign": "spring"}, URL: "https://example.com/spring"},
+	}
+
+	for _, tt := range []struct {
+		name string
+		req  Request
+		url  string
+		ok   bool
+	}{
+		{name: "fallback", req: Request{UserAgent: userAgentDesktop}},
+		{name: "device", req: Request{UserAgent: userAgentIPhone, AcceptLanguage: "de"}, url: "https://apps.example/", ok: true},
+		{name: "language", req: Request{UserAgent: userAgentDesktop, AcceptLanguage: "de-CH, en;q=0.5"}, url: "https://example.com/de", ok: true},
+		{name: "other language", req: Request{AcceptLanguage: "dk"}},
+		{name: "referer", req: Request{Referer: "https://www.partner.example/page"}, url: "https://example.com/partner", ok: true},
+		{name: "referer domain", req: Request{Referer: "https://partner.example/page"}},
+		{name: "query", req: Request{Query: url.Values{"campaign": {"spring"}}}, url: "https://example.com/spring", ok: true},
+		{name: "other query", req: Request{Query: url.Values{"campaign": {"fall"}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			u, ok := rules.Destination(tt.req)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.url, u)
+		})
+	}
+}
+
+func TestDestinationAllConditions(t *testing.T) {
+	rules := Rules{{Language: "de", Device: DeviceDesktop, URL: "https://example.com/de"}}
+
+	_, ok := rules.Destination(Request{AcceptLanguage: "de", UserAgent: userAgentIPhone})
+	assert.False(t, ok)
+
+	_, ok = rules.Destination(Request{AcceptLanguage: "de", UserAgent: userAgentDesktop})
+	assert.True(t, ok)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Rules(nil).Validate())
+	assert.NoError(t, Rules{{Device: DeviceTablet, URL: "https://example.com/"}}.Validate())
+	assert.ErrorIs(t, Rules{{URL: "https://example.com/"}}.Validate(), ErrRuleInvalid)
+	assert.ErrorIs(t, Rules{{Device: "watch", URL: "https://example.com/"}}.Validate(), ErrRuleInvalid)
+	assert.ErrorIs(t, Rules{{Language: "de"}}.Validate(), ErrRuleInvalid)
+	assert.ErrorIs(t, Rules{{Language: "de", URL: "example.com"}}.Validate(), ErrRuleInvalid)
+}
+
+func TestValueAndScan(t *testing.T) {
+	rules := Rules{{Language: "de", Query: map[string]string{"a": "b"}, URL: "https://example.com/de"}}
+
+	value, err := rules.Value()
+	if assert.NoError(t, err) {
+		var scanned Rules
+		if assert.NoError(t, scanned.Scan(value)) {
+			assert.Equal(t, rules, scanned)
+		}
+	}
+
+	value, err = Rules(nil).Value()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", value)
+	}
+
+	var scanned Rules
+	if assert.NoError(t, scanned.Scan(nil)) {
+		assert.Nil(t, scanned)
+	}
+}
+
+func TestPick(t *testing.T) {
+	variants := Variants{{URL: "https://example.com/a", Weight: 70}, {URL: "https://example.com/b", Weight: 30}}
+
+	assert.Equal(t, 100, variants.TotalWeight())
+	assert.Equal(t, 1, variants.Pick(0))
+	assert.Equal(t, 1, variants.Pick(69))
+	assert.Equal(t, 2, variants.Pick(70))
+	assert.Equal(t, 2, variants.Pick(99))
+}
+
+func TestValidateVariants(t *testing.T) {
+	assert.NoError(t, Variants(nil).Validate())
+	assert.NoError(t, Variants{{URL: "https://example.com/a", Weight: 1}}.Validate())
+	assert.ErrorIs(t, Variants{{URL: "https://example.com/a"}}.Validate(), ErrRuleInvalid)
+	assert.ErrorIs(t, Variants{{URL: "example.com", Weight: 1}}.Validate(), ErrRuleInvalid)
+
+	// huge weights would overflow the total weight
+	assert.NoError(t, Variants{{URL: "https://example.com/a", Weight: MaxWeight}}.Validate())
+	assert.ErrorIs(t, Variants{{URL: "https://example.com/a", Weight: MaxWeight + 1}}.Validate(), ErrRuleInvalid)
+	assert.ErrorIs(t, Variants{
+		{URL: "https://example.com/a", Weight: math.MaxInt},
+		{URL: "https://example.com/b", Weight: math.MaxInt},
+	}.Validate(), ErrRuleInvalid)
+
+	many := make(Variants, MaxTotalWeight/MaxWeight+1)
+	for i := range many {
+		many[i] = Variant{URL: "https://example.com/", Weight: MaxWeight}
+	}
+	assert.ErrorIs(t, many.Validate(), ErrRuleInvalid)
+}
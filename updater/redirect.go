@@ -0,0 +1,10 @@
+package updater
+
+// RedirectCommand is the request of the updater service.
+type RedirectCommand struct {
+	// Domain is the namespace of the code, empty for the default domain.
+	Domain string
+	Code   string
+	Token  string
+	URL    string `validate:"empty=false & format=url"`
+}
@@ -0,0 +1,115 @@
+// Package updater offers a service to change the destination of a redirect.
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"hex-microservice/canonical"
+	"hex-microservice/event"
+	"time"
+
+	"github.com/go-logr/logr"
+	validate "gopkg.in/dealancer/validate.v2"
+)
+
+var (
+	// ErrNotFound signals that the desired redirect is not found
+	ErrNotFound = errors.New("redirect not found")
+	// ErrRedirectInvalid signals that the new destination is not valid
+	ErrRedirectInvalid = errors.New("Redirect Invalid")
+	// ErrPolicyViolation signals that the new destination is not accepted by the policy
+	ErrPolicyViolation = errors.New("Redirect violates the policy")
+)
+
+// Repository defines the method the service expects from
+// a repository implementation.
+type Repository interface {
+	// Update changes the url of an active redirect of the domain with the
+	// matching token. Expired redirects are treated as not found.
+	Update(domain, code, token, url string, now time.Time) error
+}
+
+// Policy is the port that decides whether a url is accepted as destination.
+type Policy interface {
+	Check(url string) error
+}
+
+// Service describes the method the service offers.
+type Service interface {
+	// Update takes a token to change the url of a Redirect.
+	// Raises an error if the entry couldn't be updated.
+	Update(c RedirectCommand) error
+}
+
+// service implements the Service interface and holds
+// references.
+type service struct {
+	logger     logr.Logger
+	repository Repository
+	events     event.Publisher
+	normalize  bool
+	policy     Policy
+}
+
+// Option configures the optional behavior of the service.
+type Option func(*service)
+
+// WithNormalization enables the canonicalization of the urls.
+func WithNormalization() Option {
+	return func(s *service) {
+		s.normalize = true
+	}
+}
+
+// WithPolicy sets the policy the urls have to comply with, every url is
+// accepted by default.
+func WithPolicy(p Policy) Option {
+	return func(s *service) {
+		s.policy = p
+	}
+}
+
+// New creates a new updater service.
+func New(l logr.Logger, r Repository, p event.Publisher, opts ...Option) Service {
+	s := &service{
+		logger:     l,
+		repository: r,
+		events:     p,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Update changes the url of a redirect by the given token.
+func (s *service) Update(c RedirectCommand) error {
+	if err := validate.Validate(c); err != nil {
+		return fmt.Errorf("service.Update: %w", ErrRedirectInvalid)
+	}
+
+	if s.normalize {
+		var err error
+		if c.URL, err = canonical.URL(c.URL); err != nil {
+			return fmt.Errorf("service.Update: %v: %w", err, ErrRedirectInvalid)
+		}
+	}
+
+	if s.policy != nil {
+		if err := s.policy.Check(c.URL); err != nil {
+			return fmt.Errorf("service.Update: %v: %w", err, ErrPolicyViolation)
+		}
+	}
+
+	now := time.Now()
+
+	if err := s.repository.Update(c.Domain, c.Code, c.Token, c.URL, now); err != nil {
+		return err
+	}
+
+	s.events.Publish(event.Updated(c.Domain, c.Code, c.URL, now))
+
+	return nil
+}